@@ -52,6 +52,7 @@ package atem
 import (
 	"os"
 	"strconv"
+	"strings"
 )
 
 // The few standard func defs the interpreter needs to know of as a minimum, and
@@ -77,10 +78,17 @@ type (
 		// references this arg, the arg's "identity" however is just its index in `Args`
 		Args        []int
 		Body        Expr
-		Meta        []string // ignored and not used in this lib: but still loaded from JSON and (re)emitted by `FuncDef.JsonSrc()`
+		Meta        []string // mostly ignored in this lib (except for `MetaNoMemo`): but still loaded from JSON and (re)emitted by `FuncDef.JsonSrc()`
 		selector    int
 		allArgsUsed bool
 		isMereAlias bool
+		closures    *compiledDef  // for `EngineClosures`, compiled with all others on its first use, see `prepCompiled`
+		bytecode    *BytecodeFunc // for `EngineBytecode`, compiled with all others on its first use, see `prepCompiled`
+		parallel    *compiledDef  // for `EngineParallel`, compiled with all others on its first use
+		recursive   bool          // for `EngineParallel`, see `prepParallel`
+		effects     bool          // for `EngineParallel`, see `prepParallel`
+		memoize     bool          // see `Prog.Memoize`
+		memo        Expr          // see `Prog.Memoize`, guarded by `memosMu`
 	}
 	Expr interface {
 		// JsonSrc emits the re-`LoadFromJson`able representation of this `Expr`.
@@ -122,12 +130,23 @@ const (
 	OpPrt OpCode = -42
 	// Evaluates the 2nd `Expr` with respect to the 1st. If the 1st is `StdFuncNil`, the 2nd encodes any expression to be evaluated in the context of the current `Prog`, else in the context of the `Prog` encoded by the 1st. Encoding is via `StdFuncNil` / `StdFuncCons` lists arranged just like the JSON format.
 	OpEval OpCode = -4242
+	// Aborts the whole evaluation by `panic`king with an `ErrUser` of both `Expr`s (the first one a string-ish `StdFuncCons`tructed linked-list of `ExprNumInt`s for the message, the second any related `Expr`), never returns
+	OpErr OpCode = -1010101
 )
 
 // OpPrtDst is the output sink for all `OpPrt` primitive instructions.
 // Must never be `nil` during any `Prog`s that do potentially invoke `OpPrt`.
 var OpPrtDst = os.Stderr.Write
 
+// ErrUser is what evaluation `panic`s with on `OpErr`, with its 2 operands.
+type ErrUser [2]Expr
+
+// Error implements the `error` interface: the message, a tab, then the other
+// operand (as text if string-ish, else as `JsonSrc`).
+func (me ErrUser) Error() string {
+	return ListOfExprsToString(me[0]) + "\t" + ListOfExprsToString(me[1])
+}
+
 // JsonSrc implements the `Expr` interface.
 func (me ExprNumInt) JsonSrc() string { return strconv.Itoa(int(me)) }
 
@@ -172,6 +191,59 @@ func (me *FuncDef) JsonSrc(dropFuncDefMetas bool) string {
 	return outjson + "],\n\t\t" + me.Body.JsonSrc() + " ]"
 }
 
+// IsMereAlias reports whether this `FuncDef` takes no args and its `Body` is
+// not an `ExprCall`. References to such `FuncDef`s are replaced by `Body` on load.
+func (me *FuncDef) IsMereAlias() bool { return me.isMereAlias }
+
+// IsSelector reports whether this `FuncDef` merely returns one of its args
+// or a call of one arg with some others, as detected on load for the
+// interpreter to short-cut such calls.
+func (me *FuncDef) IsSelector() bool { return me.selector != 0 }
+
+// SelectorArgs returns, for an `IsSelector` `FuncDef`, the 0-based indices of
+// the args it selects: either only the one it returns, or the callee and then
+// (in call order) the args of the call it returns. Such calls are short-cut by
+// the interpreter, never evaluating the args being passed along or not selected.
+func (me *FuncDef) SelectorArgs() (ret []int) {
+	if me.selector < 0 {
+		ret = []int{int(-me.selector) - 2}
+	} else if me.selector > 0 {
+		call := me.Body.(*ExprCall)
+		ret = make([]int, 1+len(call.Args))
+		ret[0] = int(-call.Callee.(ExprArgRef)) - 2
+		for i := range call.Args {
+			ret[len(call.Args)-i] = int(-call.Args[i].(ExprArgRef)) - 2
+		}
+	}
+	return
+}
+
+// MetaSrcLocPrefix starts the `FuncDef.Meta` entry, if any, denoting the source
+// location that the `FuncDef` was compiled from, as emitted by eg. `tl2atem`:
+// `src:module:line:col`, with `line` and `col` 1-based, or 0 if unknown. By
+// convention, it follows the name and the arg names, see `FuncDef.SrcLoc`.
+const MetaSrcLocPrefix = "src:"
+
+// SrcLoc returns the source location denoted by the `MetaSrcLocPrefix` entry
+// of this `FuncDef`, if it has one following the name and the arg names.
+func (me *FuncDef) SrcLoc() (module string, line int, col int, ok bool) {
+	for i := 1 + len(me.Args); i < len(me.Meta); i++ {
+		if loc := me.Meta[i]; strings.HasPrefix(loc, MetaSrcLocPrefix) {
+			loc = loc[len(MetaSrcLocPrefix):]
+			if icol := strings.LastIndexByte(loc, ':'); icol > 0 {
+				if iline := strings.LastIndexByte(loc[:icol], ':'); iline >= 0 {
+					line, errline := strconv.Atoi(loc[iline+1 : icol])
+					col, errcol := strconv.Atoi(loc[icol+1:])
+					if errline == nil && errcol == nil {
+						return loc[:iline], line, col, true
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
 // JsonSrc emits the re-`LoadFromJson`able representation of this `Prog`.
 func (me Prog) JsonSrc(dropFuncDefMetas bool) string {
 	outjson := "[ "
@@ -0,0 +1,273 @@
+package atem
+
+import (
+	"encoding/binary"
+	"strconv"
+	"strings"
+)
+
+// BcOp denotes an instruction of the `EngineBytecode` VM. In a
+// `BytecodeFunc.Code`, each is one byte followed by its operands (if any),
+// each of those a signed varint as per `encoding/binary.PutVarint`.
+type BcOp byte
+
+const (
+	BcRet BcOp = iota
+	BcPushInt
+	BcPushArg
+	BcPushFunc
+	BcPushNil
+	BcPushThunk
+	BcMakeClosure
+	BcPrimOp
+	BcCallN
+	BcApply
+	BcSplice
+)
+
+// BcOps describes all `BcOp`s, and is the source for `BytecodeSpec`.
+var BcOps = [...]struct {
+	Name     string
+	Operands []string
+	Stack    string
+	Doc      string
+}{
+	BcRet:         {"return", nil, "v →", "Returns `v` as the result of the current `BytecodeFunc` body or thunk."},
+	BcPushInt:     {"push-int", []string{"n"}, "→ n", "Pushes the number `n`."},
+	BcPushArg:     {"push-arg", []string{"i"}, "→ arg", "Pushes the current call's `i`-th arg (in call order, ie. `ExprArgRef` `-(i+2)`). Never a thunk, as these are forced on call entry."},
+	BcPushFunc:    {"push-func", []string{"f"}, "→ f", "Pushes the func-ref `f`: a `FuncDef` index if `f >= 0`, else an `OpCode`."},
+	BcPushNil:     {"push-nil", nil, "→ nil", "Pushes the never-to-be-evaluated stand-in for an arg unused (per `FuncDef.Args`) by the callee of a `call-n`."},
+	BcPushThunk:   {"push-thunk", []string{"t"}, "→ thunk", "Pushes a not-yet-evaluated non-atomic call arg: `BytecodeFunc.Thunks[t]` over the current call's args. Only ever consumed by `apply` and `splice`, never by `call-n` or `prim-op`."},
+	BcMakeClosure: {"make-closure", []string{"n", "missing"}, "callee a1 … an → closure", "Pushes a closure value: an `ExprCall` with `IsClosure` of `missing`."},
+	BcPrimOp:      {"prim-op", []string{"op"}, "lhs rhs → result", "Performs the prim-op `OpCode` `op` on the two (evaluated) operands."},
+	BcCallN:       {"call-n", []string{"f", "n"}, "a1 … an → result", "Calls the `n`-ary non-selector `FuncDef` `f`, all args being evaluated (or `push-nil`) already."},
+	BcApply:       {"apply", []string{"n"}, "callee e1 … en → result", "Calls `callee` with the `n` entries (values or thunks), handling closures, nullary `FuncDef`s, selectors, under- and over-saturation just like `EngineInterp`: thunks of used args are evaluated right before the call, those of unused args never."},
+	BcSplice:      {"splice", []string{"n"}, "callee e1 … en →", "Only ends the `Code` of nullary `FuncDef`s whose `Body` is a non-closure call: returns (rather than performs) that call, for `apply` to splice in front of the args to the nullary `FuncDef`."},
+}
+
+// BytecodeFunc is the `EngineBytecode` form of a `FuncDef.Body` (or of
+// the root `Expr` passed to `Prog.Eval`).
+type BytecodeFunc struct {
+	// Code starts with the instructions for the `Body`, ending with `BcRet`
+	// or `BcSplice`, followed by those for each of the `Thunks`.
+	Code []byte
+	// Thunks holds the offsets into `Code` of all the non-atomic call args
+	// occurring in the `Body`, each ending in a `BcRet`.
+	Thunks []int
+
+	thunks []evalCode
+	def    compiledDef
+}
+
+// Bytecode returns the `BytecodeFunc` of the `FuncDef` at `fn`, compiling it
+// (along with all others) on first request. It is the same one that
+// `EngineBytecode` evaluations use.
+// The full instruction set is specified in [bytecode.md](bytecode.md), as
+// generated by `atem disasm -spec`.
+func (me Prog) Bytecode(fn ExprFuncRef) *BytecodeFunc {
+	me.prepCompiled(EngineBytecode)
+	return me[fn].bytecode
+}
+
+func (me Prog) compileBytecode(body Expr, splice bool) *BytecodeFunc {
+	ret, thunks, buf := &BytecodeFunc{}, []Expr{}, make([]byte, binary.MaxVarintLen64)
+	emit := func(op BcOp, operands ...int) {
+		ret.Code = append(ret.Code, byte(op))
+		for _, operand := range operands {
+			ret.Code = append(ret.Code, buf[:binary.PutVarint(buf, int64(operand))]...)
+		}
+	}
+	var expr func(Expr)
+	entries := func(args []Expr) { // args in call order
+		for _, arg := range args {
+			if call, ok := arg.(*ExprCall); ok && call.IsClosure == 0 {
+				emit(BcPushThunk, len(thunks))
+				thunks = append(thunks, call)
+			} else {
+				expr(arg)
+			}
+		}
+	}
+	callParts := func(call *ExprCall) (callee Expr, args []Expr) {
+		args = make([]Expr, len(call.Args))
+		for i := range args {
+			args[i] = call.Args[len(call.Args)-1-i]
+		}
+		return call.Callee, args
+	}
+	expr = func(it Expr) {
+		switch it := it.(type) {
+		case ExprNumInt:
+			emit(BcPushInt, int(it))
+		case ExprArgRef:
+			emit(BcPushArg, int(-it)-2)
+		case ExprFuncRef:
+			emit(BcPushFunc, int(it))
+		case *ExprCall:
+			callee, args := callParts(it)
+			fn, isfn := callee.(ExprFuncRef)
+			if it.IsClosure != 0 {
+				expr(callee)
+				for _, arg := range args {
+					expr(arg)
+				}
+				emit(BcMakeClosure, len(args), it.IsClosure)
+			} else if isfn && fn < 0 && len(args) >= 2 {
+				expr(args[0])
+				expr(args[1])
+				if emit(BcPrimOp, int(fn)); len(args) > 2 {
+					entries(args[2:])
+					emit(BcApply, len(args)-2)
+				}
+			} else if isfn && fn >= 0 && len(me[fn].Args) > 0 && me[fn].selector == 0 && len(args) >= len(me[fn].Args) {
+				usage := me[fn].Args
+				for i := range usage {
+					if usage[i] == 0 {
+						emit(BcPushNil)
+					} else {
+						expr(args[i])
+					}
+				}
+				if emit(BcCallN, int(fn), len(usage)); len(args) > len(usage) {
+					entries(args[len(usage):])
+					emit(BcApply, len(args)-len(usage))
+				}
+			} else {
+				expr(callee)
+				entries(args)
+				emit(BcApply, len(args))
+			}
+		default:
+			panic(it)
+		}
+	}
+
+	if call, _ := body.(*ExprCall); splice {
+		callee, args := callParts(call)
+		expr(callee)
+		entries(args)
+		emit(BcSplice, len(args))
+	} else {
+		expr(body)
+		emit(BcRet)
+	}
+	for i := 0; i < len(thunks); i++ { // `thunks` may grow during the loop
+		ret.Thunks = append(ret.Thunks, len(ret.Code))
+		expr(thunks[i])
+		emit(BcRet)
+	}
+
+	ret.thunks = make([]evalCode, len(ret.Thunks))
+	for i := range ret.thunks {
+		pc := ret.Thunks[i]
+		ret.thunks[i] = func(args []Expr) Expr { return me.runBytecode(ret, pc, args) }
+	}
+	ret.def.body = func(args []Expr) Expr { return me.runBytecode(ret, 0, args) }
+	if splice {
+		ret.def.splice = func() (Expr, []Expr) {
+			call := me.runBytecode(ret, 0, nil).(*ExprCall)
+			return call.Callee, call.Args
+		}
+	}
+	return ret
+}
+
+// runBytecode is the `EngineBytecode` VM loop, running `bc.Code` from `pc` on
+// until `BcRet` or `BcSplice` (the latter's result being no proper `Expr` but
+// an `ExprCall` with `Args` in call order, for `compiledDef.splice`).
+func (me Prog) runBytecode(bc *BytecodeFunc, pc int, args []Expr) Expr {
+	code, stack := bc.Code, make([]Expr, 0, 8)
+	operand := func() int {
+		n, l := binary.Varint(code[pc:])
+		pc += l
+		return int(n)
+	}
+	popN := func(n int) []Expr {
+		ret := make([]Expr, n)
+		copy(ret, stack[len(stack)-n:])
+		stack = stack[:len(stack)-n]
+		return ret
+	}
+	for {
+		op := BcOp(code[pc])
+		pc++
+		switch op {
+		case BcRet:
+			return stack[len(stack)-1]
+		case BcPushInt:
+			stack = append(stack, ExprNumInt(operand()))
+		case BcPushArg:
+			stack = append(stack, args[operand()])
+		case BcPushFunc:
+			stack = append(stack, ExprFuncRef(operand()))
+		case BcPushNil:
+			stack = append(stack, nil)
+		case BcPushThunk:
+			stack = append(stack, &exprThunk{code: bc.thunks[operand()], args: args})
+		case BcMakeClosure:
+			n := operand()
+			closure := &ExprCall{IsClosure: operand(), Args: make([]Expr, n)}
+			for i, arg := range popN(n) {
+				closure.Args[n-1-i] = arg
+			}
+			closure.Callee, stack[len(stack)-1] = stack[len(stack)-1], closure
+		case BcPrimOp:
+			lhs, rhs := stack[len(stack)-2], stack[len(stack)-1]
+			stack = append(stack[:len(stack)-2], me.opResult(ExprFuncRef(operand()), lhs, rhs, EngineBytecode))
+		case BcCallN:
+			fn := ExprFuncRef(operand())
+			fnargs := popN(operand())
+			stack = append(stack, me[fn].bytecode.def.body(fnargs))
+		case BcApply:
+			entries := popN(operand())
+			stack[len(stack)-1] = me.apply(stack[len(stack)-1], entries, EngineBytecode)
+		case BcSplice:
+			entries := popN(operand())
+			return &ExprCall{Callee: stack[len(stack)-1], Args: entries}
+		default:
+			panic(op)
+		}
+	}
+}
+
+// Disasm renders `me.Code` in a human-readable assembly-like listing, one
+// instruction per line prefixed by its offset.
+func (me *BytecodeFunc) Disasm() string {
+	var buf strings.Builder
+	for pc := 0; pc < len(me.Code); {
+		for i, offset := range me.Thunks {
+			if offset == pc {
+				buf.WriteString("thunk " + strconv.Itoa(i) + ":\n")
+			}
+		}
+		op := BcOp(me.Code[pc])
+		buf.WriteString("  " + strconv.Itoa(pc) + "\t" + BcOps[op].Name)
+		pc++
+		for range BcOps[op].Operands {
+			n, l := binary.Varint(me.Code[pc:])
+			buf.WriteString(" " + strconv.FormatInt(n, 10))
+			pc += l
+		}
+		buf.WriteByte('\n')
+	}
+	return buf.String()
+}
+
+// BytecodeSpec renders the `EngineBytecode` instruction set, as per `BcOps`,
+// into a Markdown document.
+func BytecodeSpec() string {
+	var buf strings.Builder
+	buf.WriteString("# atem bytecode\n\n" +
+		"Each `FuncDef` compiles to its own `BytecodeFunc`: a byte `Code` sequence of\n" +
+		"instructions, each an opcode byte followed by its operands (each a signed\n" +
+		"varint), run by a stack VM with the current call's args at hand. Args are\n" +
+		"never evaluated for callees that don't use them (as per `FuncDef.Args`):\n" +
+		"`call-n` gets `push-nil`s for them, while `apply`'s not-yet-evaluated\n" +
+		"`push-thunk` entries are only evaluated when used by the eventual callee.\n\n" +
+		"| Code | Instruction | Operands | Stack | Description |\n" +
+		"|---|---|---|---|---|\n")
+	for op, it := range BcOps {
+		buf.WriteString("| " + strconv.Itoa(op) + " | `" + it.Name + "` | " + strings.Join(it.Operands, ", ") + " | " + it.Stack + " | " + it.Doc + " |\n")
+	}
+	return buf.String()
+}
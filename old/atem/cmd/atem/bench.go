@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+// engines are all `Engine`s selectable via the `ATEM_ENGINE` env var, and compared by `atem bench`.
+var engines = []struct {
+	name   string
+	engine Engine
+}{{"interp", EngineInterp}, {"closures", EngineClosures}, {"bytecode", EngineBytecode}, {"lazy", EngineLazy}, {"parallel", EngineParallel}}
+
+func engineFromEnv() Engine {
+	if name := os.Getenv("ATEM_ENGINE"); name != "" {
+		for _, it := range engines {
+			if it.name == name {
+				return it.engine
+			}
+		}
+		panic("unknown ATEM_ENGINE: " + name)
+	}
+	return EngineInterp
+}
+
+// mainBench implements `atem bench [-n runs] [-memo] prog.json [args...]`: it
+// runs the main `FuncDef` of `prog.json` with every `Engine` in turn, `-n`
+// times each (and, with `-memo`, all that again with `Prog.Memoize` enabled).
+// It fails if any results or `OpPrt` outputs (except for `EngineLazy`) differ
+// from those of the first run, else reports the fastest run time per `Engine`
+// to `stdout`.
+func mainBench(args []string) {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	numruns := flags.Int("n", 5, "number of runs per engine")
+	withmemo := flags.Bool("memo", false, "also run all engines with `atem.Prog.Memoize` enabled")
+	if err := flags.Parse(args); err != nil || flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	src, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+	prog = LoadFromJson(src)
+
+	var prtout bytes.Buffer
+	OpPrtDst = prtout.Write
+	var wantret, wantprt string
+	memos := []bool{false}
+	if *withmemo {
+		memos = append(memos, true)
+	}
+	for im, memo := range memos {
+		prog.Memoize(memo)
+		for ie, it := range engines {
+			name := it.name
+			if memo {
+				name += "+memo"
+			}
+			var fastest time.Duration
+			for i := 0; i < *numruns; i++ {
+				prtout.Reset()
+				prog.ClearMemos()
+				expr := &ExprCall{Callee: ExprFuncRef(len(prog) - 1), Args: []Expr{ListsFrom(os.Environ()), ListsFrom(flags.Args()[1:])}}
+				ret, dur := benchEval(expr, it.engine)
+				if i == 0 || dur < fastest {
+					fastest = dur
+				}
+				if im == 0 && ie == 0 && i == 0 {
+					wantret, wantprt = ret, prtout.String()
+				} else if ret != wantret || (prtout.String() != wantprt && it.engine != EngineLazy) {
+					os.Stderr.WriteString("engine " + name + " run " + strconv.Itoa(i+1) + " differs from engine " + engines[0].name + ":\n" + prtout.String() + ret + "\n")
+					os.Exit(1)
+				}
+			}
+			os.Stdout.WriteString(name + "\t" + fastest.String() + "\n")
+		}
+	}
+}
+
+// benchEval returns the `JsonSrc` of the result (or the `OpErr` message as printed by `main`) and the duration of the `Eval` alone.
+func benchEval(expr Expr, engine Engine) (ret string, dur time.Duration) {
+	t := time.Now()
+	defer func() {
+		if thrown := recover(); thrown != nil {
+			if err, ok := thrown.(ErrUser); !ok {
+				panic(thrown)
+			} else { // as in `main`
+				ret, dur = err.Error(), time.Since(t)
+			}
+		}
+	}()
+	result := prog.Eval(expr, true, EvalWith(engine))
+	dur = time.Since(t)
+	return result.JsonSrc(), dur
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+// mainDisasm implements `atem disasm [-spec] [prog.json]`: it writes to stdout
+// the `atem.EngineBytecode` disassembly of all `FuncDef`s in `prog.json` or,
+// with `-spec`, the Markdown spec of the bytecode instruction set instead.
+func mainDisasm(args []string) {
+	flags := flag.NewFlagSet("disasm", flag.ExitOnError)
+	spec := flags.Bool("spec", false, "write the instruction set spec instead")
+	if err := flags.Parse(args); err != nil || (flags.NArg() != 1) != *spec {
+		flags.Usage()
+		os.Exit(2)
+	} else if *spec {
+		_, _ = os.Stdout.WriteString(BytecodeSpec())
+		return
+	}
+	src, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+
+	prog := LoadFromJson(src)
+	for i := range prog {
+		_, _ = os.Stdout.WriteString(graphLabel(prog, i) + " (" + strconv.Itoa(len(prog[i].Args)) + " args):\n" + prog.Bytecode(ExprFuncRef(i)).Disasm() + "\n")
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+// mainGraph implements `atem graph [-collapse-std] [-opt] prog.json`: it writes
+// to stdout a Graphviz DOT call graph of all `FuncDef`s in `prog.json`. Edges
+// to callees are solid, other (non-callee) references are dashed. Recursion
+// cycles are red, selectors blue and mere aliases grey. With `-opt`, the
+// `atem_opt` executable (expected in `PATH`) is run on `prog.json` to render
+// the before and after of its optimizations as side-by-side clusters.
+func mainGraph(args []string) {
+	flags := flag.NewFlagSet("graph", flag.ExitOnError)
+	collapsestd := flags.Bool("collapse-std", false, "render all std.* defs as a single node")
+	withopt := flags.Bool("opt", false, "render side by side with the atem_opt output")
+	if err := flags.Parse(args); err != nil || flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	src, err := ioutil.ReadFile(flags.Arg(0))
+	if err != nil {
+		panic(err)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("digraph atem {\n\tnode [shape=box, fontname=monospace];\n")
+	if !*withopt {
+		graphWrite(&buf, LoadFromJson(src), "", *collapsestd)
+	} else {
+		cmd := exec.Command("atem_opt")
+		cmd.Stdin, cmd.Stderr = bytes.NewReader(src), os.Stderr
+		srcopt, err := cmd.Output()
+		if err != nil {
+			panic(err)
+		}
+		for i, it := range []struct {
+			label string
+			src   []byte
+		}{{"before", src}, {"after", srcopt}} {
+			buf.WriteString("\tsubgraph cluster_" + it.label + " {\n\tlabel=\"" + it.label + "\";\n")
+			graphWrite(&buf, LoadFromJson(it.src), string('a'+rune(i)), *collapsestd)
+			buf.WriteString("\t}\n")
+		}
+	}
+	buf.WriteString("}\n")
+	_, _ = os.Stdout.Write(buf.Bytes())
+}
+
+func graphWrite(buf *bytes.Buffer, prog Prog, nodeIdPrefix string, collapseStd bool) {
+	nodeid := func(i int) string {
+		if collapseStd && graphIsStd(prog, i) {
+			return strconv.Quote(nodeIdPrefix + "std")
+		}
+		return strconv.Quote(nodeIdPrefix + strconv.Itoa(i))
+	}
+	edges, cyclic := graphEdges(prog)
+
+	if collapseStd {
+		buf.WriteString("\t" + nodeid(int(StdFuncId)) + " [label=\"std.*\", shape=folder];\n")
+	}
+	for i := range prog {
+		if collapseStd && graphIsStd(prog, i) {
+			continue
+		}
+		attrs := "label=" + strconv.Quote(graphLabel(prog, i))
+		if prog[i].IsSelector() {
+			attrs += ", style=filled, fillcolor=lightblue"
+		} else if prog[i].IsMereAlias() {
+			attrs += ", style=\"filled,dashed\", fillcolor=lightgrey"
+		}
+		if cyclic[i] {
+			attrs += ", color=red, penwidth=2"
+		}
+		if i == len(prog)-1 {
+			attrs += ", shape=doubleoctagon"
+		}
+		buf.WriteString("\t" + nodeid(i) + " [" + attrs + "];\n")
+	}
+
+	done := map[string]bool{}
+	for i := range prog {
+		for _, edge := range edges[i] {
+			if collapseStd && graphIsStd(prog, i) && graphIsStd(prog, edge.to) {
+				continue
+			}
+			var attrs []string
+			if !edge.isCallee {
+				attrs = append(attrs, "style=dashed")
+			}
+			if cyclic[i] && graphReaches(edges, edge.to, i) {
+				attrs = append(attrs, "color=red")
+			}
+			if line := "\t" + nodeid(i) + " -> " + nodeid(edge.to) + " [" + strings.Join(attrs, ", ") + "];\n"; !done[line] {
+				done[line] = true
+				buf.WriteString(line)
+			}
+		}
+	}
+}
+
+type graphEdge struct {
+	to       int
+	isCallee bool
+}
+
+// graphEdges collects for every `FuncDef` its outgoing references to other
+// `FuncDef`s (not prim-ops), and marks all those that are part of any cycle.
+func graphEdges(prog Prog) (edges [][]graphEdge, cyclic []bool) {
+	edges, cyclic = make([][]graphEdge, len(prog)), make([]bool, len(prog))
+	for i := range prog {
+		var visit func(Expr, bool)
+		visit = func(expr Expr, isCallee bool) {
+			switch it := expr.(type) {
+			case ExprFuncRef:
+				if it >= 0 {
+					edges[i] = append(edges[i], graphEdge{to: int(it), isCallee: isCallee})
+				}
+			case *ExprCall:
+				visit(it.Callee, true)
+				for _, arg := range it.Args {
+					visit(arg, false)
+				}
+			}
+		}
+		visit(prog[i].Body, false)
+	}
+	for i := range prog {
+		for _, edge := range edges[i] {
+			if graphReaches(edges, edge.to, i) {
+				cyclic[i] = true
+				break
+			}
+		}
+	}
+	return
+}
+
+func graphReaches(edges [][]graphEdge, from int, to int) bool {
+	seen, todo := map[int]bool{from: true}, []int{from}
+	for len(todo) > 0 {
+		cur := todo[len(todo)-1]
+		if todo = todo[:len(todo)-1]; cur == to {
+			return true
+		}
+		for _, edge := range edges[cur] {
+			if !seen[edge.to] {
+				seen[edge.to], todo = true, append(todo, edge.to)
+			}
+		}
+	}
+	return false
+}
+
+func graphLabel(prog Prog, i int) string {
+	if len(prog[i].Meta) == 0 {
+		return "[" + strconv.Itoa(i) + "]"
+	}
+	return prog[i].Meta[0]
+}
+
+func graphIsStd(prog Prog, i int) bool {
+	label := graphLabel(prog, i)
+	return strings.HasPrefix(label[strings.IndexByte(label, ']')+1:], "std.")
+}
@@ -12,15 +12,45 @@
 // file path) as a linked-list of text strings, the second will be the current
 // process environment variables as a linked-list of `NAME=Value` text strings.
 //
+// If next to the `.json` source file there exists a same-named `.prov.json`
+// file, as written by `atem_opt` when given such a file path, it is loaded
+// and used to show original (pre-optimization) func names in trace outputs
+// and in the messages of `atem.OpErr` aborts and other failed evaluations.
+//
+// Alternatively, `atem graph [-collapse-std] [-opt] prog.json` writes a
+// Graphviz DOT call graph of the `Prog` to `stdout` instead of running it.
+//
+// Or, `atem disasm [-spec] [prog.json]` writes the `atem.EngineBytecode`
+// disassembly of all `FuncDef`s, or with `-spec` the bytecode spec instead.
+//
+// Or, `atem repl prog.json` evaluates expressions entered on `stdin`, in
+// JSON or a simple surface syntax, in the context of the `Prog` and writes
+// their results as rendered by `pretty.Print`; enter `:help` for details.
+//
+// Or, `atem test [-update] [dir...]` runs all programs in the `dir`s (default:
+// the current one) in-process against their golden `.expected` outputs, as per
+// `golden.Discover`, reporting diffs; with `-update`, it (re)writes those.
+//
+// The env var `ATEM_ENGINE` selects the `atem.Engine` to run with: `interp`
+// (the default), `closures`, `bytecode`, `lazy` or `parallel` (the only one
+// not run with `GOMAXPROCS` pinned to 1). To compare them, `atem bench [-n runs]
+// [-memo] prog.json [args...]` runs the `Prog` with each in turn (`-n` times,
+// default 5, and with `-memo` all again with `atem.Prog.Memoize` enabled), fails
+// on any differing results or `atem.OpPrt` outputs (the latter not checked for
+// `lazy`), else reports the fastest run time per engine. A non-empty env var
+// `ATEM_MEMO` enables `atem.Prog.Memoize`.
+//
 // ## stdout, stderr, stdin
 //
 // The main `FuncDef` is by default expected to return a linked list of
 // `atem.ExprNumInt`s in the range of 0 .. 255, if it does that is considered the
 // text output to be written to `stdout` and so will it be done. Other returned
-// `Expr`s will have their `.JsonSrc()` written to `stderr` instead. For source
-// programs to force extra writes to `stderr` during their run, the `atem.OpPrt`
-// op-code is to be used. For access to `stdin`, the main `FuncDef` must return
-// a specific predefined linked-list meeting the following characteristics:
+// `Expr`s will be written to `stderr` instead, as rendered by `pretty.Print`.
+// For source programs to force extra writes to `stderr` during their run, the
+// `atem.OpPrt` op-code is to be used. To abort, the `atem.OpErr` op-code: its
+// `atem.ErrUser` message is written to `stderr` and the exit code is 1 (other
+// failures exit with 2 and a Go stack trace). For access to `stdin`, the main `FuncDef`
+// must return a specific predefined linked-list meeting the following characteristics:
 //
 // - it has 4 elements, in order:
 //   1. a valid `ExprFuncRef` (the "handler"),
@@ -36,6 +66,16 @@
 //
 // - the "initial output", a text string linked list of any length incl. zero, will be written to `stdout` before the first read from `stdin` and the first call to "handler".
 //
+// ## snapshots
+//
+// With `atem --snapshot state.bin prog.json [args...]`, the "next state" of
+// every "handler" call is written to `state.bin` (together with a hash of the
+// `atem.Prog`, the "handler" and the "separator char"). A later `atem --resume
+// state.bin` then skips the main `FuncDef` and continues reading `stdin` and
+// calling "handler" right from that state on (and likewise keeps snapshotting
+// into `state.bin`), unless `prog.json` has changed since. Evaluations that
+// are still in progress, such as that of a "handler" call, are not snapshotted.
+//
 package main
 
 import (
@@ -49,13 +89,41 @@ import (
 	"time"
 
 	. "github.com/metaleap/atmo/old/atem"
+	"github.com/metaleap/atmo/old/atem/pretty"
 )
 
 var prog Prog
+var engine Engine
 
 func main() {
-	runtime.LockOSThread()
-	runtime.GOMAXPROCS(1)
+	if len(os.Args) > 1 && os.Args[1] == "graph" {
+		mainGraph(os.Args[2:])
+		return
+	} else if len(os.Args) > 1 && os.Args[1] == "bench" {
+		mainBench(os.Args[2:])
+		return
+	} else if len(os.Args) > 1 && os.Args[1] == "disasm" {
+		mainDisasm(os.Args[2:])
+		return
+	} else if len(os.Args) > 1 && os.Args[1] == "repl" {
+		mainRepl(os.Args[2:])
+		return
+	} else if len(os.Args) > 1 && os.Args[1] == "test" {
+		mainTest(os.Args[2:])
+		return
+	}
+	var resume *snapshot
+	if len(os.Args) > 2 && (os.Args[1] == "--snapshot" || os.Args[1] == "--resume") {
+		isresume := os.Args[1] == "--resume"
+		if snapshotFilePath, os.Args = os.Args[2], append(os.Args[:1:1], os.Args[3:]...); isresume {
+			snap := snapshotRead()
+			resume, os.Args = &snap, []string{os.Args[0], snap.SrcFilePath}
+		}
+	}
+	if engine = engineFromEnv(); engine != EngineParallel {
+		runtime.LockOSThread()
+		runtime.GOMAXPROCS(1)
+	}
 	debug.SetGCPercent(-1)
 	src, err := ioutil.ReadFile(os.Args[1])
 	if err != nil {
@@ -65,26 +133,41 @@ func main() {
 		defer writeTraceFile()
 	}
 	prog = LoadFromJson(src)
+	prog.Memoize(os.Getenv("ATEM_MEMO") != "")
+	provLoadSidecarFileIfAny(os.Args[1])
+	if snapshotFilePath != "" {
+		snapshotPrep(os.Args[1], prog)
+	}
+	if resume != nil && resume.ProgHash != snapshotHash {
+		panic("cannot resume: " + os.Args[1] + " changed since the snapshot was written")
+	}
 	if numargs := len(prog[len(prog)-1].Args); 2 != numargs {
 		panic("Your main FuncDef needs exactly 2 Args but has " + strconv.Itoa(numargs) + ": " + prog[len(prog)-1].JsonSrc(false))
 	}
 	defer func() {
 		thrown := recover()
 		if thrown != nil {
-			if err, ok := thrown.([3]Expr); !ok {
-				panic(thrown)
+			if _, ok := thrown.(ErrUser); ok {
+				os.Stderr.WriteString(provErrMsg(thrown) + "\n")
+				os.Exit(1)
+			} else if _, ok = thrown.(Expr); ok {
+				panic(provErrMsg(thrown))
 			} else {
-				os.Stderr.WriteString(ListOfExprsToString(err[1]) + "\t" + ListOfExprsToString(err[2]) + "\n")
+				panic(thrown)
 			}
 		}
 	}()
+	if resume != nil {
+		stdinHandleOnceOrForever(prog, resume.Handler, resume.SepChar, resume.State)
+		return
+	}
 	expr := &ExprCall{ // we start!
 		Callee: ExprFuncRef(len(prog) - 1), // `main` is always last by convention
 		Args: []Expr{ListsFrom(os.Environ() /*[]string{"!", "?"}*/), // second `main` param: `env`, a list of all env-vars (list of "FOO=Bar" strings)
 			ListsFrom(os.Args[2:]), // first `main` param: `args`, a list of all process args following `atem inputfile`
 		}}
 	t := time.Now().UnixNano()
-	outexpr := prog.Eval(expr, true)
+	outexpr := prog.Eval(expr, true, EvalWith(engine))
 	outlist := ListOfExprs(outexpr)
 	t = time.Now().UnixNano() - t
 	println("T=", time.Duration(t).String())
@@ -92,7 +175,7 @@ func main() {
 	if outbytes := ListToBytes(outlist); outbytes != nil { // by convention we expect a byte-array return from `main`
 		os.Stdout.Write(append(outbytes, '\n'))
 	} else if outlist == nil || !probeIfStdinReaderAndIfSoHandleOnceOrForever(prog, outlist) {
-		os.Stderr.WriteString("RET-EXPR:\t" + outexpr.JsonSrc() + "\n")
+		os.Stderr.WriteString("RET-EXPR:\t" + pretty.Print(prog, outexpr) + "\n")
 	}
 }
 
@@ -103,43 +186,8 @@ func probeIfStdinReaderAndIfSoHandleOnceOrForever(prog Prog, retList []Expr) boo
 				_, okc := retList[3].(*ExprCall)
 				if okf, _ := retList[3].(ExprFuncRef); okc || okf == StdFuncNil {
 					if initialoutput := ListToBytes(ListOfExprs(retList[3])); initialoutput != nil {
-						initialstate, handlenextinput := retList[2], func(prevstate Expr, input []byte) (nextstate Expr) {
-							retexpr := prog.Eval(&ExprCall{Callee: fnhandler, Args: []Expr{ListFrom(input), prevstate}}, true) //  &ExprCall{Callee: fnhandler, Arg: prevstate}, Arg: ListFrom(input)})
-							if retlist := ListOfExprs(retexpr); len(retlist) == 2 {
-								nextstate = retlist[0]
-								if outlist := ListOfExprs(retlist[1]); outlist != nil {
-									os.Stdout.Write(ListToBytes(outlist))
-								} else {
-									os.Stderr.WriteString("RET-EXPR:\t" + retlist[1].JsonSrc() + "\n")
-								}
-							}
-							if nextstate == nil {
-								panic(len(retList))
-							}
-							return
-						}
-
-						if os.Stdout.Write(initialoutput); sepchar == 0 {
-							if allinputatonce, err := ioutil.ReadAll(os.Stdin); err != nil {
-								panic(err)
-							} else {
-								_ = handlenextinput(initialstate, allinputatonce)
-							}
-						} else {
-							stdin := bufio.NewScanner(os.Stdin)
-							if sepchar != '\n' {
-								stdin.Split(stdinReadSplitterBy(byte(sepchar)))
-							}
-							for state := initialstate; stdin.Scan(); {
-								state = handlenextinput(state, stdin.Bytes())
-								if fn, ok := state.(ExprFuncRef); ok && fn == StdFuncId {
-									break // `ok` above required because `StdFuncId` is 0
-								}
-							}
-							if err := stdin.Err(); err != nil {
-								panic(err)
-							}
-						}
+						os.Stdout.Write(initialoutput)
+						stdinHandleOnceOrForever(prog, fnhandler, sepchar, retList[2])
 						return true
 					}
 				}
@@ -149,6 +197,51 @@ func probeIfStdinReaderAndIfSoHandleOnceOrForever(prog Prog, retList []Expr) boo
 	return false
 }
 
+func stdinHandleOnceOrForever(prog Prog, fnhandler ExprFuncRef, sepchar ExprNumInt, initialstate Expr) {
+	handlenextinput := func(prevstate Expr, input []byte) (nextstate Expr) {
+		retexpr := prog.Eval(&ExprCall{Callee: fnhandler, Args: []Expr{ListFrom(input), prevstate}}, true, EvalWith(engine)) //  &ExprCall{Callee: fnhandler, Arg: prevstate}, Arg: ListFrom(input)})
+		if retlist := ListOfExprs(retexpr); len(retlist) == 2 {
+			nextstate = retlist[0]
+			if outlist := ListOfExprs(retlist[1]); outlist != nil {
+				os.Stdout.Write(ListToBytes(outlist))
+			} else {
+				os.Stderr.WriteString("RET-EXPR:\t" + pretty.Print(prog, retlist[1]) + "\n")
+			}
+		}
+		if nextstate == nil {
+			panic(retexpr.JsonSrc())
+		}
+		if snapshotFilePath != "" {
+			snapshotWrite(fnhandler, sepchar, nextstate)
+		}
+		return
+	}
+
+	if fn, ok := initialstate.(ExprFuncRef); ok && fn == StdFuncId {
+		return // only when resuming an already-terminated program
+	} else if sepchar == 0 {
+		if allinputatonce, err := ioutil.ReadAll(os.Stdin); err != nil {
+			panic(err)
+		} else {
+			_ = handlenextinput(initialstate, allinputatonce)
+		}
+	} else {
+		stdin := bufio.NewScanner(os.Stdin)
+		if sepchar != '\n' {
+			stdin.Split(stdinReadSplitterBy(byte(sepchar)))
+		}
+		for state := initialstate; stdin.Scan(); {
+			state = handlenextinput(state, stdin.Bytes())
+			if fn, ok := state.(ExprFuncRef); ok && fn == StdFuncId {
+				break // `ok` above required because `StdFuncId` is 0
+			}
+		}
+		if err := stdin.Err(); err != nil {
+			panic(err)
+		}
+	}
+}
+
 func stdinReadSplitterBy(sep byte) bufio.SplitFunc {
 	return func(data []byte, atEOF bool) (advance int, token []byte, err error) {
 		if i := bytes.IndexByte(data, sep); i >= 0 {
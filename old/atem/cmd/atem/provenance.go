@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	. "github.com/metaleap/atmo/old/atem"
+	"github.com/metaleap/atmo/old/atem/pretty"
+)
+
+// the subset of `atem_opt`'s provenance sidecar format that we care about here
+var provs []struct {
+	Idx  int
+	From []struct{ Name string }
+}
+
+func provLoadSidecarFileIfAny(srcFilePath string) {
+	provs = nil
+	if src, err := ioutil.ReadFile(strings.TrimSuffix(srcFilePath, ".json") + ".prov.json"); err == nil {
+		if err = json.Unmarshal(src, &provs); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func provOrigNames(funcIdx int) (ret []string) {
+	for i := range provs {
+		if provs[i].Idx == funcIdx {
+			for _, origin := range provs[i].From {
+				ret = append(ret, origin.Name)
+			}
+			break
+		}
+	}
+	return
+}
+
+var provPrinter = pretty.Printer{Name: provName}
+
+// provName names `fn` as `pretty.Print` would, followed by the original names
+// of the `FuncDef`s it was derived from if more than just the one of itself.
+func provName(fn ExprFuncRef) (ret string) {
+	ret = "[" + strconv.Itoa(int(fn)) + "]"
+	if meta := prog[fn].Meta; len(meta) > 0 {
+		if name := meta[0][strings.IndexByte(meta[0], ']')+1:]; name != "" {
+			ret = name
+		}
+	}
+	if origs := provOrigNames(int(fn)); len(origs) > 1 || (len(origs) == 1 && origs[0] != ret) {
+		ret += "<" + strings.Join(origs, ",") + ">"
+	}
+	return
+}
+
+// provErrMsg describes what an `Eval` of `prog` `panic`ked with: for `ErrUser`s
+// as `ErrUser.Error` does and for (not callable) `Expr`s as `pretty.Print`
+// does, but in both cases with `provName`s once a sidecar file was loaded.
+func provErrMsg(thrown interface{}) string {
+	provPrinter.Prog = prog
+	switch it := thrown.(type) {
+	case ErrUser:
+		if provs == nil || ListToBytes(ListOfExprs(it[1])) != nil {
+			return it.Error()
+		}
+		return ListOfExprsToString(it[0]) + "\t" + provPrinter.Print(it[1])
+	case Expr:
+		if provs == nil {
+			return "not callable: " + pretty.Print(prog, it)
+		}
+		return "not callable: " + provPrinter.Print(it)
+	}
+	return fmt.Sprintf("%v", thrown)
+}
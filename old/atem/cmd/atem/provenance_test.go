@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+func TestProvErrMsg(t *testing.T) {
+	defer func(p Prog) { prog, provs = p, nil }(prog)
+	prog = LoadFromJson([]byte(`[ [ ["[0]std.same","it"], [1], "0" ]
+, [ ["[1]std.True","t","f"], [1,0], "0" ]
+, [ ["[2]std.False","t","f"], [0,1], "1" ]
+, [ ["[3]std.ListEnd","e","l"], [1,0], "0" ]
+, [ ["[4]std.ListLink","h","t","e","l"], [1,1,0,1], ["3", "0", "1"] ]
+, [ ["[5]check","x"], [1], [[-1010101], [3], [[6], "0"]] ]
+, [ ["[6]merged","x","y"], [1,0], "0" ]
+, [ ["main"], [], [[5], 42] ]
+]`))
+	thrown := func(expr Expr) (ret interface{}) {
+		defer func() { ret = recover() }()
+		_ = prog.Eval(expr, false, EvalWith(EngineClosures))
+		return
+	}
+	errusr, notcallable := thrown(ExprFuncRef(len(prog)-1)), thrown(&ExprCall{Callee: ExprNumInt(1), Args: []Expr{ExprNumInt(2)}})
+	for _, it := range []struct {
+		provs string
+		want  [2]string
+	}{
+		{``, [2]string{"\t[[6], 42]", "not callable: 1"}},
+		{`[{"Idx": 6, "From": [{"Name": "merged"}]}]`, [2]string{"\tmerged(42, ?)", "not callable: 1"}},
+		{`[{"Idx": 6, "From": [{"Name": "merged"}, {"Name": "inlined"}]}]`, [2]string{"\tmerged<merged,inlined>(42, ?)", "not callable: 1"}},
+		{`[{"Idx": 6, "From": [{"Name": "renamed"}]}]`, [2]string{"\tmerged<renamed>(42, ?)", "not callable: 1"}},
+	} {
+		srcfilepath := filepath.Join(t.TempDir(), "prog.json")
+		if it.provs != "" {
+			if err := ioutil.WriteFile(strings.TrimSuffix(srcfilepath, ".json")+".prov.json", []byte(it.provs), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		provLoadSidecarFileIfAny(srcfilepath)
+		for i, thrown := range []interface{}{errusr, notcallable} {
+			if got := provErrMsg(thrown); got != it.want[i] {
+				t.Errorf("%s: expected %q, got %q", it.provs, it.want[i], got)
+			}
+		}
+	}
+}
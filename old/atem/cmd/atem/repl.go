@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/metaleap/atmo/old/atem"
+	"github.com/metaleap/atmo/old/atem/pretty"
+)
+
+const replHelp = `Enter an expression to evaluate, either as JSON (any input starting with '['
+except a lone [], in the FuncDef body format of atem.LoadFromJson) or in
+surface syntax: space-separated juxtaposition of callee and args, with parens
+for nesting, number and "string" literals, true, false, [], funcs by their
+Meta name (or any unambiguous trailing part of it after a '.') or #index, and
+prim-ops by ADD, SUB, MUL, DIV, MOD, EQ, GT, LT, PRT, EVAL, ERR. Or a command:
+  :list [substr]  list all funcs (with names containing substr)
+  :body func      show the body (and source location, if known) of func
+  :reload         reload the program file
+  :time           toggle reporting evaluation durations
+  :quit           exit (as does EOF)
+`
+
+// replOps are all the prim-ops nameable in `atem repl` surface syntax.
+var replOps = []OpCode{OpAdd, OpSub, OpMul, OpDiv, OpMod, OpEq, OpGt, OpLt, OpPrt, OpEval, OpErr}
+
+// mainRepl implements `atem repl prog.json`: it reads expressions (and
+// commands) line by line from stdin, evaluating each in the context of
+// `prog.json` via `Prog.Eval` with `big` of `false`, and writes the results
+// as rendered by `pretty.Print` to stdout. Enter `:help` for all details.
+func mainRepl(args []string) {
+	if len(args) != 1 {
+		os.Stderr.WriteString("usage: atem repl prog.json\n")
+		os.Exit(2)
+	}
+	engine = engineFromEnv()
+	replLoad(args[0])
+
+	timed, stdin := false, bufio.NewScanner(os.Stdin)
+	for os.Stdout.WriteString("> "); stdin.Scan(); os.Stdout.WriteString("> ") {
+		switch line := strings.TrimSpace(stdin.Text()); {
+		case line == "":
+		case line == ":quit" || line == ":q":
+			return
+		case line == ":help" || line == ":h" || line == ":?":
+			os.Stdout.WriteString(replHelp)
+		case line == ":time":
+			timed = !timed
+			os.Stdout.WriteString("timing " + map[bool]string{true: "on", false: "off"}[timed] + "\n")
+		case line == ":reload":
+			replDo(func() { replLoad(args[0]) })
+		case strings.HasPrefix(line, ":list"):
+			substr := strings.TrimSpace(strings.TrimPrefix(line, ":list"))
+			for i := range prog {
+				if name := replName(ExprFuncRef(i)); strings.Contains(name, substr) {
+					os.Stdout.WriteString("#" + strconv.Itoa(i) + "\t" + name + "\t" + strconv.Itoa(len(prog[i].Args)) + " args\n")
+				}
+			}
+		case strings.HasPrefix(line, ":body "):
+			replDo(func() {
+				fn := replResolve(strings.TrimSpace(strings.TrimPrefix(line, ":body ")))
+				head := replName(fn)
+				for i := range prog[fn].Args {
+					head += " " + replArgName(fn, i)
+				}
+				if module, line, col, ok := prog[fn].SrcLoc(); ok {
+					head = "// " + module + ":" + strconv.Itoa(line) + ":" + strconv.Itoa(col) + "\n" + head
+				}
+				body := strings.ReplaceAll(pretty.Print(prog, prog[fn].Body), "\n", "\n    ")
+				os.Stdout.WriteString(head + " =\n    " + body + "\n" + prog[fn].JsonSrc(false) + "\n")
+			})
+		case line[0] == ':':
+			os.Stdout.WriteString("unknown command, see :help\n")
+		default:
+			replDo(func() {
+				var expr Expr
+				if line[0] == '[' && line != "[]" {
+					expr = prog.ExprFromJson([]byte(line))
+				} else {
+					expr = prog.ExprPrep(replParse(line))
+				}
+				t := time.Now()
+				ret := prog.Eval(expr, false, EvalWith(engine))
+				if os.Stdout.WriteString(pretty.Print(prog, ret) + "\n"); timed {
+					os.Stdout.WriteString("T=" + time.Since(t).String() + "\n")
+				}
+			})
+		}
+	}
+	os.Stdout.WriteString("\n")
+}
+
+func replLoad(srcFilePath string) {
+	src, err := ioutil.ReadFile(srcFilePath)
+	if err != nil {
+		panic(err)
+	}
+	prog = LoadFromJson(src)
+	prog.Memoize(os.Getenv("ATEM_MEMO") != "")
+	provLoadSidecarFileIfAny(srcFilePath)
+	os.Stdout.WriteString(srcFilePath + ": " + strconv.Itoa(len(prog)) + " funcs\n")
+}
+
+// replDo runs `do`, reporting any `panic` (including the `ErrUser` ones of
+// failing programs) on stderr instead of exiting.
+func replDo(do func()) {
+	defer func() {
+		if thrown := recover(); thrown != nil {
+			if _, ok := thrown.(ErrUser); ok {
+				os.Stderr.WriteString(provErrMsg(thrown) + "\n")
+			} else {
+				os.Stderr.WriteString("error: " + provErrMsg(thrown) + "\n")
+			}
+		}
+	}()
+	do()
+}
+
+func replName(fn ExprFuncRef) string {
+	if meta := prog[fn].Meta; len(meta) > 0 {
+		if name := meta[0][strings.IndexByte(meta[0], ']')+1:]; name != "" {
+			return name
+		}
+	}
+	return "#" + strconv.Itoa(int(fn))
+}
+
+func replArgName(fn ExprFuncRef, idx int) string {
+	if meta := prog[fn].Meta; idx+1 < len(meta) {
+		return meta[idx+1]
+	}
+	return "@" + strconv.Itoa(idx)
+}
+
+// replResolve finds the func named `name` (or `#index`) as per `replHelp`.
+func replResolve(name string) ExprFuncRef {
+	if strings.HasPrefix(name, "#") {
+		if idx, err := strconv.Atoi(name[1:]); err != nil || idx < 0 || idx >= len(prog) {
+			panic(errors.New("no such func: " + name))
+		} else {
+			return ExprFuncRef(idx)
+		}
+	}
+	var found []ExprFuncRef
+	for i := range prog {
+		if fullname := replName(ExprFuncRef(i)); fullname == name {
+			return ExprFuncRef(i)
+		} else if strings.HasSuffix(fullname, "."+name) {
+			found = append(found, ExprFuncRef(i))
+		}
+	}
+	if len(found) == 0 {
+		panic(errors.New("no such func: " + name))
+	} else if len(found) > 1 {
+		names := make([]string, len(found))
+		for i, fn := range found {
+			names[i] = replName(fn)
+		}
+		panic(errors.New("ambiguous func name " + name + ": " + strings.Join(names, ", ")))
+	}
+	return found[0]
+}
+
+// replParse parses `src` in the surface syntax described in `replHelp`.
+func replParse(src string) Expr {
+	var toks []string
+	for src = strings.TrimSpace(src); src != ""; src = strings.TrimSpace(src) {
+		n := strings.IndexAny(src, " \t()\"")
+		switch {
+		case src[0] == '(' || src[0] == ')':
+			n = 1
+		case src[0] == '"':
+			for n = 1; n < len(src) && src[n] != '"'; n++ {
+				if src[n] == '\\' {
+					n++
+				}
+			}
+			if n++; n > len(src) {
+				panic(errors.New("unterminated string literal"))
+			}
+		case n < 0:
+			n = len(src)
+		}
+		toks, src = append(toks, src[:n]), src[n:]
+	}
+
+	var app func(bool) Expr
+	app = func(nested bool) Expr {
+		var terms []Expr
+		for len(toks) > 0 && toks[0] != ")" {
+			tok := toks[0]
+			toks = toks[1:]
+			if tok == "(" {
+				terms = append(terms, app(true))
+			} else {
+				terms = append(terms, replTerm(tok))
+			}
+		}
+		if nested != (len(toks) > 0) {
+			panic(errors.New("unbalanced parens"))
+		} else if nested {
+			toks = toks[1:]
+		}
+		switch len(terms) {
+		case 0:
+			panic(errors.New("empty expression"))
+		case 1:
+			return terms[0]
+		}
+		call := &ExprCall{Callee: terms[0], Args: make([]Expr, 0, len(terms)-1)}
+		for i := len(terms) - 1; i > 0; i-- {
+			call.Args = append(call.Args, terms[i])
+		}
+		return call
+	}
+	return app(false)
+}
+
+func replTerm(tok string) Expr {
+	if n, err := strconv.Atoi(tok); err == nil {
+		return ExprNumInt(n)
+	} else if tok[0] == '"' {
+		str, err := strconv.Unquote(tok)
+		if err != nil {
+			panic(err)
+		}
+		return ListFrom([]byte(str))
+	}
+	switch tok {
+	case "true":
+		return StdFuncTrue
+	case "false":
+		return StdFuncFalse
+	case "[]":
+		return StdFuncNil
+	}
+	for _, op := range replOps {
+		if pretty.OpName(op) == tok {
+			return ExprFuncRef(op)
+		}
+	}
+	return replResolve(tok)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+// snapshotFilePath is set via `--snapshot` or `--resume`, see `main.go` doc.
+var snapshotFilePath string
+
+// snapshotSrcFilePath and snapshotHash are set once via `snapshotPrep`, rather
+// than on every `snapshotWrite`.
+var snapshotSrcFilePath string
+var snapshotHash [sha256.Size]byte
+
+// snapshot is all that's needed to continue a stdin-handler program after a
+// restart: as `encoding/gob`-written after every "handler" call. Any process
+// args and env vars only matter to the main `FuncDef`, thus aren't included.
+type snapshot struct {
+	SrcFilePath string
+	ProgHash    [sha256.Size]byte
+	Handler     ExprFuncRef
+	SepChar     ExprNumInt
+	State       Expr
+}
+
+func init() {
+	for _, it := range []Expr{ExprNumInt(0), ExprArgRef(0), ExprFuncRef(0), &ExprCall{}} {
+		gob.Register(it)
+	}
+}
+
+func snapshotProgHash(prog Prog) [sha256.Size]byte {
+	return sha256.Sum256([]byte(prog.JsonSrc(true)))
+}
+
+// snapshotPrep notes the absolute `srcFilePath` (so that `--resume` works from
+// any current directory) and the `snapshotProgHash` of `prog`.
+func snapshotPrep(srcFilePath string, prog Prog) {
+	abspath, err := filepath.Abs(srcFilePath)
+	if err != nil {
+		panic(err)
+	}
+	snapshotSrcFilePath, snapshotHash = abspath, snapshotProgHash(prog)
+}
+
+// snapshotWrite replaces the `snapshotFilePath` file only once the new one is
+// fully written, so that no crash or kill can leave behind a corrupted one.
+func snapshotWrite(handler ExprFuncRef, sepChar ExprNumInt, state Expr) {
+	tmpfilepath := snapshotFilePath + ".tmp"
+	file, err := os.Create(tmpfilepath)
+	if err == nil {
+		err = gob.NewEncoder(file).Encode(&snapshot{SrcFilePath: snapshotSrcFilePath, ProgHash: snapshotHash, Handler: handler, SepChar: sepChar, State: state})
+		if errclose := file.Close(); err == nil {
+			err = errclose
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmpfilepath, snapshotFilePath)
+	}
+	if err != nil {
+		panic(err)
+	}
+}
+
+func snapshotRead() (ret snapshot) {
+	file, err := os.Open(snapshotFilePath)
+	if err == nil {
+		err = gob.NewDecoder(file).Decode(&ret)
+		_ = file.Close()
+	}
+	if err != nil {
+		panic(err)
+	}
+	return
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strconv"
+
+	"github.com/metaleap/atmo/old/atem/golden"
+)
+
+// mainTest implements `atem test [-update] [dir...]`: it runs all programs in
+// the `dir`s (default: the current one) as per `golden.Discover`, reporting
+// to `stdout` the diffs of those whose output differs from their `.expected`
+// file and exiting non-zero if any do (or fail to run). With `-update`, all
+// `.expected` files are (re)written instead.
+func mainTest(args []string) {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	update := flags.Bool("update", false, "(re)write all .expected files")
+	if err := flags.Parse(args); err != nil {
+		flags.Usage()
+		os.Exit(2)
+	}
+	dirs := flags.Args()
+	if len(dirs) == 0 {
+		dirs = []string{"."}
+	}
+	engine = engineFromEnv()
+
+	var numpass, numfail, numskip int
+	for _, dir := range dirs {
+		cases, err := golden.Discover(dir)
+		if err != nil {
+			panic(err)
+		}
+		for i := range cases {
+			it := &cases[i]
+			if *update {
+				if err = it.Update(engine); err != nil {
+					numfail++
+					os.Stdout.WriteString("FAIL\t" + err.Error() + "\n")
+				} else {
+					numpass++
+					os.Stdout.WriteString("WROTE\t" + it.SideCarFilePath(".expected") + "\n")
+				}
+			} else if it.Expected == nil {
+				numskip++
+				os.Stdout.WriteString("SKIP\t" + it.SrcFilePath + " (no .expected file)\n")
+			} else if output, err := it.Run(engine); err != nil {
+				numfail++
+				os.Stdout.WriteString("FAIL\t" + err.Error() + "\n")
+			} else if diff := golden.Diff(it.Expected, output); diff != "" {
+				numfail++
+				os.Stdout.WriteString("FAIL\t" + it.SrcFilePath + "\n" + diff)
+			} else {
+				numpass++
+				os.Stdout.WriteString("ok\t" + it.SrcFilePath + "\n")
+			}
+		}
+	}
+	os.Stdout.WriteString(strconv.Itoa(numpass) + " ok, " + strconv.Itoa(numfail) + " failed, " + strconv.Itoa(numskip) + " skipped\n")
+	if numfail > 0 {
+		os.Exit(1)
+	}
+}
@@ -2,10 +2,10 @@ package main
 
 import (
 	"os"
-	"strconv"
 	"strings"
 
 	. "github.com/metaleap/atmo/old/atem"
+	"github.com/metaleap/atmo/old/atem/pretty"
 )
 
 const trace = false
@@ -73,85 +73,24 @@ func writeStep(to *os.File, level int, step *EvalStep) {
 	to.WriteString("\n")
 }
 
-func toStr(expr Expr) (ret string) {
-	if ret = "_"; expr != nil {
-		ret = expr.JsonSrc()
-		switch it := expr.(type) {
-		case ExprFuncRef:
-			if it < 0 {
-				switch OpCode(it) {
-				case OpAdd:
-					ret = "ADD"
-				case OpSub:
-					ret = "SUB"
-				case OpMul:
-					ret = "MUL"
-				case OpDiv:
-					ret = "DIV"
-				case OpMod:
-					ret = "MOD"
-				case OpEq:
-					ret = "EQ"
-				case OpGt:
-					ret = "GT"
-				case OpLt:
-					ret = "LT"
-				case OpPrt:
-					ret = "PRT"
-				default:
-					ret = "ERR"
-				}
-			} else {
-				ret = prog[it].Meta[0]
-				ret = ret[strings.IndexByte(ret, ']')+1:]
-				for _, s := range []string{"std.list.", "std.num.", "std.json.", "std."} {
-					ret = strings.TrimPrefix(ret, s)
-				}
-				for _, s := range []string{"://", "//", ":"} {
-					ret = strings.Replace(ret, s, "_", -1)
-				}
-			}
-		case *ExprCall:
-			if list := listOfExprs(it); list == nil {
-				if ret = ""; it.IsClosure != 0 {
-					ret += strconv.FormatUint(uint64(it.IsClosure), 10) + "#"
-				}
-				ret += "(" + toStr(it.Callee)
-				for i := len(it.Args) - 1; i >= 0; i-- {
-					ret += " " + toStr(it.Args[i])
-				}
-				ret += ")"
-			} else if bytes := ListToBytes(list); bytes != nil {
-				ret = strconv.Quote(string(bytes))
-			} else {
-				ret = "["
-				for _, item := range list {
-					ret += toStr(item) + ", "
-				}
-				ret += "]"
-			}
-		}
-	}
-	return
+var tracePrinter = pretty.Printer{Name: traceName}
+
+func toStr(expr Expr) string {
+	tracePrinter.Prog = prog
+	return tracePrinter.Print(expr)
 }
 
-func listOfExprs(expr Expr) (ret []Expr) {
-	ret = make([]Expr, 0, 1024)
-	for ok, next := true, expr; ok; {
-		ok = false
-		if fnref, _ := next.(ExprFuncRef); fnref == StdFuncNil {
-			break
-		} else if call, okc := next.(*ExprCall); okc && len(call.Args) == 2 {
-			if fnref, _ = call.Callee.(ExprFuncRef); fnref == StdFuncCons {
-				for i := len(call.Args) - 1; i > 0; i-- {
-					ret = append(ret, call.Args[i])
-				}
-				ok, next = true, call.Args[0]
-			}
-		}
-		if !ok {
-			ret = nil
-		}
+func traceName(fn ExprFuncRef) (ret string) {
+	ret = prog[fn].Meta[0]
+	ret = ret[strings.IndexByte(ret, ']')+1:]
+	for _, s := range []string{"std.list.", "std.num.", "std.json.", "std."} {
+		ret = strings.TrimPrefix(ret, s)
+	}
+	for _, s := range []string{"://", "//", ":"} {
+		ret = strings.Replace(ret, s, "_", -1)
+	}
+	if origs := provOrigNames(int(fn)); len(origs) > 1 {
+		ret += "<" + strings.Join(origs, ",") + ">"
 	}
 	return
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+type compilation struct {
+	prog       Prog
+	funcs      []string // all generated C func definitions: first thunks (lazily-evaluated call args), then one per `FuncDef`
+	numThunks  int
+	curStmts   []string // temporaries (in evaluation order) of the C func currently being generated
+	curNumTmps int
+}
+
+func compile(prog Prog) string {
+	me := compilation{prog: prog}
+	defs := make([]string, len(prog))
+	for i := range prog {
+		defs[i] = me.genFunc("f"+strconv.Itoa(i), "/* "+funcComment(&prog[i])+" */\n", prog[i].Body)
+	}
+
+	var buf strings.Builder
+	buf.WriteString(cPreludeSrc)
+	buf.WriteString("\n#define NUM_DEFS " + strconv.Itoa(len(prog)) + "\n\n")
+	for i := 0; i < me.numThunks; i++ {
+		buf.WriteString("static Val t" + strconv.Itoa(i) + "(Val* a);\n")
+	}
+	for i := range prog {
+		buf.WriteString("static Val f" + strconv.Itoa(i) + "(Val* a);\n")
+	}
+	buf.WriteString("\nstatic Val (*const def_funcs[NUM_DEFS])(Val*) = {")
+	for i := range prog {
+		buf.WriteString(cond(i == 0, "", ", ") + "f" + strconv.Itoa(i))
+	}
+	buf.WriteString("};\nstatic const int def_nargs[NUM_DEFS] = {")
+	var usage, offs, sels, seloffs, numsels []string
+	for i := range prog {
+		buf.WriteString(cond(i == 0, "", ", ") + strconv.Itoa(len(prog[i].Args)))
+		offs = append(offs, strconv.Itoa(len(usage)))
+		for _, argusage := range prog[i].Args {
+			usage = append(usage, strconv.Itoa(argusage))
+		}
+		sel := prog[i].SelectorArgs()
+		seloffs, numsels = append(seloffs, strconv.Itoa(len(sels))), append(numsels, strconv.Itoa(len(sel)))
+		for _, argidx := range sel {
+			sels = append(sels, strconv.Itoa(argidx))
+		}
+	}
+	buf.WriteString("};\nstatic const int def_usage_offs[NUM_DEFS] = {" + strings.Join(offs, ", ") + "};\n")
+	buf.WriteString("static const int def_usage[] = {" + strings.Join(append(usage, "0"), ", ") + "}; /* trailing 0 just to never be empty */\n")
+	buf.WriteString("static const int def_nsels[NUM_DEFS] = {" + strings.Join(numsels, ", ") + "}; /* 0 for non-selectors */\n")
+	buf.WriteString("static const int def_sels_offs[NUM_DEFS] = {" + strings.Join(seloffs, ", ") + "};\n")
+	buf.WriteString("static const int def_sels[] = {" + strings.Join(append(sels, "0"), ", ") + "}; /* trailing 0 just to never be empty */\n")
+	buf.WriteString(cRuntimeSrc)
+	for _, src := range me.funcs {
+		buf.WriteString("\n" + src)
+	}
+	for _, src := range defs {
+		buf.WriteString("\n" + src)
+	}
+	return buf.String()
+}
+
+// genFunc emits a C func returning `body`, with all args (of the current `FuncDef`) accessed via `a`.
+func (me *compilation) genFunc(name string, comment string, body Expr) string {
+	outerstmts, outernumtmps := me.curStmts, me.curNumTmps
+	me.curStmts, me.curNumTmps = nil, 0
+	ret := me.genExpr(body)
+	src := comment + "static Val " + name + "(Val* a) {\n"
+	for _, stmt := range me.curStmts {
+		src += "\t" + stmt + "\n"
+	}
+	src += "\treturn " + ret + ";\n}\n"
+	me.curStmts, me.curNumTmps = outerstmts, outernumtmps
+	return src
+}
+
+// genExpr returns a C expression for `expr`: any calls get evaluated into temporaries
+// beforehand, preserving the interpreter's left-to-right evaluation order of call args.
+func (me *compilation) genExpr(expr Expr) string {
+	switch it := expr.(type) {
+	case ExprNumInt:
+		return "NUM(" + strconv.Itoa(int(it)) + ")"
+	case ExprArgRef:
+		return "a[" + strconv.Itoa(int(-it)-2) + "]"
+	case ExprFuncRef:
+		return "FN(" + strconv.Itoa(int(it)) + ")"
+	case *ExprCall:
+		argexprs := make([]Expr, len(it.Args)) // in call order, unlike `it.Args`
+		for i := range it.Args {
+			argexprs[len(argexprs)-1-i] = it.Args[i]
+		}
+		if it.IsClosure > 0 {
+			args := make([]string, len(argexprs))
+			for i := range argexprs {
+				args[i] = me.genExpr(argexprs[i])
+			}
+			return "mkclosure(" + strconv.Itoa(int(it.Callee.(ExprFuncRef))) + ", " + strconv.Itoa(len(args)) + ", (Val[]){" + strings.Join(args, ", ") + "})"
+		}
+		callee, numargs := "", 0
+		if fn, isfn := it.Callee.(ExprFuncRef); isfn && fn < 0 && len(argexprs) >= 2 {
+			numargs = 2
+			lhs := me.genExpr(argexprs[0])
+			callee = me.tmp("op(" + strconv.Itoa(int(fn)) + ", " + lhs + ", " + me.genExpr(argexprs[1]) + ")")
+		} else if isfn && fn >= 0 && len(me.prog[fn].Args) > 0 && !me.prog[fn].IsSelector() && len(argexprs) >= len(me.prog[fn].Args) {
+			numargs = len(me.prog[fn].Args)
+			args := make([]string, numargs)
+			for i := range args {
+				if args[i] = "NIL"; me.prog[fn].Args[i] != 0 { // else unused, so never evaluated
+					args[i] = me.genExpr(argexprs[i])
+				}
+			}
+			callee = me.tmp("f" + strconv.Itoa(int(fn)) + "((Val[]){" + strings.Join(args, ", ") + "})")
+		} else {
+			callee = me.genExpr(it.Callee)
+		}
+		if numargs == len(argexprs) {
+			return callee
+		}
+		lazyargs := make([]string, 0, len(argexprs)-numargs)
+		for _, argexpr := range argexprs[numargs:] {
+			if call, iscall := argexpr.(*ExprCall); iscall && call.IsClosure == 0 {
+				name := "t" + strconv.Itoa(me.numThunks)
+				me.numThunks++
+				me.funcs = append(me.funcs, me.genFunc(name, "", argexpr))
+				lazyargs = append(lazyargs, "{NIL, "+name+", a}")
+			} else {
+				lazyargs = append(lazyargs, "{"+me.genExpr(argexpr)+", NULL, NULL}")
+			}
+		}
+		return me.tmp("apply(" + callee + ", " + strconv.Itoa(len(lazyargs)) + ", (Arg[]){" + strings.Join(lazyargs, ", ") + "})")
+	}
+	panic(expr)
+}
+
+func (me *compilation) tmp(cExpr string) string {
+	name := "v" + strconv.Itoa(me.curNumTmps)
+	me.curNumTmps, me.curStmts = me.curNumTmps+1, append(me.curStmts, "Val "+name+" = "+cExpr+";")
+	return name
+}
+
+func cond(b bool, then string, otherwise string) string {
+	if b {
+		return then
+	}
+	return otherwise
+}
+
+func funcComment(def *FuncDef) (ret string) {
+	if ret = strings.Join(def.Meta, " "); ret == "" {
+		ret = "(no meta)"
+	}
+	return strings.NewReplacer("\n", " ", "\r", " ", "*/", "* /").Replace(ret)
+}
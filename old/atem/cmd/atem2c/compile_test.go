@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/metaleap/atmo/old/atem"
+	"github.com/metaleap/atmo/old/atem/golden"
+)
+
+// TestCompileWithCC compiles all `.opt` programs in `tmpdummies` (those with
+// `.expected` files) to C, builds them with `cc` and runs them, failing on any
+// output differing from that of `Prog.Eval`. Skipped if there's no `cc`. Among
+// these, `selector.opt.json` checks that selectors never evaluate args that
+// `Eval` doesn't, as otherwise its unselected `OpErr` would be hit.
+func TestCompileWithCC(t *testing.T) {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no cc on PATH")
+	}
+	cases, err := golden.Discover(filepath.Join("..", "..", "tmpdummies"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirpath := t.TempDir()
+	for _, it := range cases {
+		if it.Expected == nil || !strings.HasSuffix(it.SrcFilePath, ".opt.json") {
+			continue
+		}
+		want, err := it.Run(EngineInterp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src, err := ioutil.ReadFile(it.SrcFilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := strings.TrimSuffix(filepath.Base(it.SrcFilePath), ".json")
+		csrcfilepath, binfilepath := filepath.Join(dirpath, name+".c"), filepath.Join(dirpath, name)
+		if err = ioutil.WriteFile(csrcfilepath, []byte(compile(LoadFromJson(src))), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if out, err := exec.Command(cc, "-std=c99", "-O1", "-o", binfilepath, csrcfilepath).CombinedOutput(); err != nil {
+			t.Errorf("%s: %v\n%s", name, err, out)
+			continue
+		}
+
+		var got bytes.Buffer
+		cmd := exec.Command(binfilepath, it.Args...)
+		cmd.Env, cmd.Stdin, cmd.Stdout, cmd.Stderr = append([]string{}, it.Env...), bytes.NewReader(it.Stdin), &got, &got
+		if err = cmd.Run(); err != nil {
+			if _, failed := err.(*exec.ExitError); !failed {
+				t.Fatal(err)
+			}
+		}
+		if diff := golden.Diff(want, got.Bytes()); diff != "" {
+			t.Errorf("%s: C output differs from Prog.Eval's:\n%s", name, diff)
+		}
+	}
+}
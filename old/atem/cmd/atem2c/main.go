@@ -0,0 +1,46 @@
+// A compiler from [atem](../../readme.md) `.json` source files to portable C99
+// programs. The single (and required) command arg is the `.json` source file
+// for the `atem.Prog` to `atem.LoadFromJson()`, the generated `.c` source is
+// written to `stdout`, ready for eg. `cc -O2 -o prog prog.c`.
+//
+// Every `FuncDef` becomes a C func taking its args as a `Val` array, `Val`s
+// being tagged nums, func-refs / op-codes and closures. Calls to statically
+// known `FuncDef`s (other than selectors) with enough args become direct C
+// calls, with args not used by the callee never evaluated. All other calls go
+// through the bundled runtime's `apply`, with non-atomic args compiled into
+// separate thunk funcs to likewise only ever evaluate those that end up being
+// needed, short-cutting selectors just like `Eval` does and producing closures
+// for partial applications exactly as `atem.ExprCall` closures with
+// `.IsClosure > 0` during `Eval`. Closures and cons cells are allocated from an
+// arena that is never freed, as atem programs run to completion and then exit.
+// Prim-ops become C operators, `OpPrt` writes to `stderr`, `OpEval` is not
+// supported.
+//
+// The generated program follows the same conventions as `cmd/atem`: the last
+// `FuncDef` is main, gets passed the process args and env as linked-lists of
+// text strings, and its result is written to `stdout` (if a text string) or as
+// `RET-EXPR` to `stderr` (if not), or drives the `stdin` handler protocol. So
+// outputs from both can be diffed against each other.
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+func main() {
+	src, err := ioutil.ReadFile(os.Args[1])
+	if err == nil {
+		prog := LoadFromJson(src)
+		if numargs := len(prog[len(prog)-1].Args); 2 != numargs {
+			panic("Your main FuncDef needs exactly 2 Args but has " + strconv.Itoa(numargs) + ": " + prog[len(prog)-1].JsonSrc(false))
+		}
+		_, err = os.Stdout.WriteString(compile(prog))
+	}
+	if err != nil {
+		panic(err)
+	}
+}
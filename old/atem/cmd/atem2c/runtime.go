@@ -0,0 +1,371 @@
+package main
+
+// cRuntimeSrc is prepended to every generated C program, right after the
+// forward declarations of all generated funcs and thunks and the tables
+// `def_funcs`, `def_nargs`, `def_usage_offs`, `def_usage`, `def_nsels`,
+// `def_sels_offs` and `def_sels`. It provides the
+// tagged `Val` type (as declared in `cPreludeSrc`), an arena allocator (there
+// is no GC: atem programs run to completion and then the process exits),
+// `apply` for all calls to not-statically-known callees (or with
+// not-statically-known arg counts), the prim-ops and the `main` mirroring
+// `cmd/atem`: same process args and env lists, same stdout string output or
+// stderr `RET-EXPR` fallback, same stdin handler protocol.
+const cRuntimeSrc = `
+static char* arena_cur = NULL;
+static size_t arena_left = 0;
+
+static void* alloc(size_t size) {
+	void* ret;
+	size = (size + 15) & ~((size_t)15);
+	if (size > arena_left) {
+		arena_left = (size > ARENA_CHUNK_SIZE) ? size : ARENA_CHUNK_SIZE;
+		if ((arena_cur = malloc(arena_left)) == NULL)
+			fail("out of memory", NULL);
+	}
+	ret = arena_cur;
+	arena_cur += size;
+	arena_left -= size;
+	return ret;
+}
+
+static void fail(const char* msg, const Val* culprit) {
+	fprintf(stderr, "%s", msg);
+	if (culprit != NULL) {
+		fprintf(stderr, ": ");
+		write_json(stderr, *culprit);
+	}
+	fprintf(stderr, "\n");
+	exit(1);
+}
+
+static Val mkclosure(int64_t fn, int nargs, const Val* args) {
+	Val ret = {TAG_CLOSURE, nargs, fn, NULL};
+	ret.args = alloc(nargs * sizeof(Val));
+	memcpy(ret.args, args, nargs * sizeof(Val));
+	return ret;
+}
+
+static int64_t num(Val v) {
+	if (v.tag != TAG_NUM)
+		fail("not a num", &v);
+	return v.num;
+}
+
+static int eq(Val v, Val cmp) {
+	int i;
+	if (v.tag != cmp.tag || v.num != cmp.num || v.nargs != cmp.nargs)
+		return 0;
+	for (i = 0; i < v.nargs; i++)
+		if (!eq(v.args[i], cmp.args[i]))
+			return 0;
+	return 1;
+}
+
+static Val op(int64_t code, Val lhs, Val rhs) {
+	switch (code) {
+	case -1:
+		return NUM(num(lhs) + num(rhs));
+	case -2:
+		return NUM(num(lhs) - num(rhs));
+	case -3:
+		return NUM(num(lhs) * num(rhs));
+	case -4:
+		if (num(rhs) == 0)
+			fail("integer divide by zero", NULL);
+		return NUM(num(lhs) / num(rhs));
+	case -5:
+		if (num(rhs) == 0)
+			fail("integer divide by zero", NULL);
+		return NUM(num(lhs) % num(rhs));
+	case -6:
+		return FN(eq(lhs, rhs) ? 1 : 2);
+	case -7:
+		return FN((num(lhs) < num(rhs)) ? 1 : 2);
+	case -8:
+		return FN((num(lhs) > num(rhs)) ? 1 : 2);
+	case -42:
+		write_list_bytes(stderr, lhs);
+		fprintf(stderr, "\t");
+		write_string(stderr, rhs);
+		fprintf(stderr, "\n");
+		return rhs;
+	case -4242:
+		fail("OpEval is not supported in atem2c outputs", NULL);
+	case -1010101: /* OpErr, same as cmd/atem */
+		write_string(stderr, lhs);
+		fprintf(stderr, "\t");
+		write_string(stderr, rhs);
+		fprintf(stderr, "\n");
+		exit(1);
+	}
+	Val culprit = NUM(code);
+	fail("unknown op-code", &culprit);
+	return culprit;
+}
+
+/* reduces nullary func-refs as the interpreter does for root and callee positions */
+static Val force(Val v) {
+	while (v.tag == TAG_FN && v.num >= 0 && def_nargs[v.num] == 0)
+		v = def_funcs[v.num](NULL);
+	return v;
+}
+
+static Val apply(Val callee, int nargs, const Arg* args) {
+	for (;;) {
+		int64_t fn;
+		int arity, n, i;
+		const int* usage = NULL;
+		Val *all, result;
+		callee = force(callee);
+		if (nargs == 0)
+			return callee;
+		if (callee.tag != TAG_FN && callee.tag != TAG_CLOSURE)
+			fail("not callable", &callee);
+		fn = callee.num;
+		arity = (fn < 0) ? 2 : def_nargs[fn];
+		if (fn >= 0)
+			usage = &def_usage[def_usage_offs[fn]];
+		if (fn >= 0 && def_nsels[fn] > 0 && callee.nargs + nargs >= arity) {
+			/* a selector: as in the interpreter, pass on the selected args without evaluating any */
+			const int* sel = &def_sels[def_sels_offs[fn]];
+			int nrest = callee.nargs + nargs - arity;
+			Arg* given = alloc((callee.nargs + nargs) * sizeof(Arg));
+			Arg* selargs = alloc((def_nsels[fn] - 1 + nrest) * sizeof(Arg));
+			for (i = 0; i < callee.nargs; i++) {
+				given[i].val = callee.args[i];
+				given[i].thunk = NULL;
+			}
+			memcpy(given + callee.nargs, args, nargs * sizeof(Arg));
+			for (i = 1; i < def_nsels[fn]; i++)
+				selargs[i - 1] = given[sel[i]];
+			memcpy(selargs + def_nsels[fn] - 1, given + arity, nrest * sizeof(Arg));
+			callee = (given[sel[0]].thunk == NULL) ? given[sel[0]].val : given[sel[0]].thunk(given[sel[0]].env);
+			args = selargs;
+			nargs = def_nsels[fn] - 1 + nrest;
+			continue;
+		}
+		all = alloc(arity * sizeof(Val));
+		for (i = 0; i < callee.nargs; i++)
+			all[i] = callee.args[i];
+		n = arity - callee.nargs;
+		for (i = 0; i < n && i < nargs; i++) {
+			if (usage != NULL && usage[callee.nargs + i] == 0)
+				all[callee.nargs + i] = NIL;
+			else if (args[i].thunk == NULL)
+				all[callee.nargs + i] = args[i].val;
+			else
+				all[callee.nargs + i] = args[i].thunk(args[i].env);
+		}
+		if (nargs < n) {
+			Val ret = {TAG_CLOSURE, callee.nargs + nargs, fn, all};
+			return ret;
+		}
+		result = (fn < 0) ? op(fn, all[0], all[1]) : def_funcs[fn](all);
+		args += n;
+		if ((nargs -= n) == 0)
+			return result;
+		callee = result;
+	}
+}
+
+static void write_json(FILE* f, Val v) {
+	int i;
+	switch (v.tag) {
+	case TAG_NUM:
+		fprintf(f, "%lld", (long long)v.num);
+		break;
+	case TAG_FN:
+		fprintf(f, "[%lld]", (long long)v.num);
+		break;
+	case TAG_CLOSURE:
+		fprintf(f, "[[%lld]", (long long)v.num);
+		for (i = 0; i < v.nargs; i++) {
+			fprintf(f, ", ");
+			write_json(f, v.args[i]);
+		}
+		fprintf(f, "]");
+		break;
+	default:
+		fprintf(f, "null");
+	}
+}
+
+/* returns the list length if v is a list, else -1. if also is_bytes, then only for all-byte-sized num lists */
+static long list_len(Val v, int is_bytes) {
+	long ret = 0;
+	for (;; ret++) {
+		if (v.tag == TAG_FN && v.num == 3)
+			return ret;
+		if (v.tag != TAG_CLOSURE || v.num != 4 || v.nargs != 2)
+			return -1;
+		if (is_bytes && (v.args[0].tag != TAG_NUM || v.args[0].num < 0 || v.args[0].num > 255))
+			return -1;
+		v = v.args[1];
+	}
+}
+
+static Val list_at(Val v, long idx) {
+	for (; idx > 0; idx--)
+		v = v.args[1];
+	return v.args[0];
+}
+
+static void write_list_bytes(FILE* f, Val v) {
+	if (list_len(v, 1) > 0)
+		for (; v.nargs == 2; v = v.args[1])
+			fputc((int)v.args[0].num, f);
+}
+
+static void write_string(FILE* f, Val v) {
+	if (list_len(v, 1) >= 0)
+		write_list_bytes(f, v);
+	else
+		write_json(f, v);
+}
+
+static Val list_from(const char* str, size_t len) {
+	Val ret = FN(3);
+	size_t i;
+	for (i = len; i > 0; i--) {
+		Val link[2];
+		link[0] = NUM((unsigned char)str[i - 1]);
+		link[1] = ret;
+		ret = mkclosure(4, 2, link);
+	}
+	return ret;
+}
+
+static Val lists_from(char** strs, int num_strs) {
+	Val ret = FN(3);
+	int i;
+	for (i = num_strs; i > 0; i--) {
+		Val link[2];
+		link[0] = list_from(strs[i - 1], strlen(strs[i - 1]));
+		link[1] = ret;
+		ret = mkclosure(4, 2, link);
+	}
+	return ret;
+}
+
+static Val handle_next_input(Val handler, Val prev_state, const char* input, size_t input_len) {
+	Arg args[2];
+	Val ret, out;
+	args[0].val = prev_state;
+	args[0].thunk = NULL;
+	args[1].val = list_from(input, input_len);
+	args[1].thunk = NULL;
+	ret = force(apply(handler, 2, args));
+	if (list_len(ret, 0) != 2)
+		fail("handler must return a list of 2 elements", &ret);
+	if (list_len(out = list_at(ret, 1), 0) >= 0)
+		write_list_bytes(stdout, out);
+	else {
+		fprintf(stderr, "RET-EXPR:\t");
+		write_json(stderr, out);
+		fprintf(stderr, "\n");
+	}
+	fflush(stdout);
+	return list_at(ret, 0);
+}
+
+static int probe_if_stdin_reader_and_if_so_handle_once_or_forever(Val ret) {
+	Val handler, sepchar, state, output;
+	char* buf;
+	size_t len = 0, cap = 4096;
+	int c;
+	if (list_len(ret, 0) != 4)
+		return 0;
+	handler = list_at(ret, 0), sepchar = list_at(ret, 1), state = list_at(ret, 2), output = list_at(ret, 3);
+	if (handler.tag != TAG_FN || handler.num <= 4 || handler.num >= NUM_DEFS - 1 || def_nargs[handler.num] != 2)
+		return 0;
+	if (sepchar.tag != TAG_NUM || sepchar.num < 0 || sepchar.num > 255)
+		return 0;
+	if (list_len(output, 1) < 0)
+		return 0;
+	write_list_bytes(stdout, output);
+	fflush(stdout);
+	buf = malloc(cap);
+	while ((c = getchar()) != EOF) {
+		if (sepchar.num != 0 && c == sepchar.num) {
+			if (c == '\n' && len > 0 && buf[len - 1] == '\r')
+				len--; /* as per Go's bufio.ScanLines used by cmd/atem */
+			state = handle_next_input(handler, state, buf, len);
+			len = 0;
+			if (state.tag == TAG_FN && state.num == 0)
+				return 1;
+		} else {
+			if (len == cap && (buf = realloc(buf, cap *= 2)) == NULL)
+				fail("out of memory", NULL);
+			buf[len++] = (char)c;
+		}
+	}
+	if (sepchar.num == 0 || len > 0)
+		handle_next_input(handler, state, buf, len);
+	return 1;
+}
+
+int main(int argc, char** argv, char** envp) {
+	Arg args[2];
+	Val ret;
+	int num_env = 0;
+	while (envp[num_env] != NULL)
+		num_env++;
+	args[0].val = lists_from(argv + 1, argc - 1);
+	args[0].thunk = NULL;
+	args[1].val = lists_from(envp, num_env);
+	args[1].thunk = NULL;
+	ret = force(apply(FN(NUM_DEFS - 1), 2, args));
+	if (list_len(ret, 1) >= 0) {
+		write_list_bytes(stdout, ret);
+		fprintf(stdout, "\n");
+	} else if (list_len(ret, 0) < 0 || !probe_if_stdin_reader_and_if_so_handle_once_or_forever(ret)) {
+		fprintf(stderr, "RET-EXPR:\t");
+		write_json(stderr, ret);
+		fprintf(stderr, "\n");
+	}
+	return 0;
+}
+`
+
+// cPreludeSrc begins every generated C program.
+const cPreludeSrc = `/* Code generated by atem2c. DO NOT EDIT. */
+
+#include <stdint.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#define TAG_NUM 0
+#define TAG_FN 1
+#define TAG_CLOSURE 2
+#define TAG_NIL 3 /* dropped args, never used by the callee so never evaluated */
+
+#define ARENA_CHUNK_SIZE (64 * 1024 * 1024)
+
+/* a num (in num), a func-ref or op-code (in num), or a closure (func-ref or op-code in num, args in call order) */
+typedef struct Val {
+	int tag;
+	int nargs;
+	int64_t num;
+	struct Val* args;
+} Val;
+
+/* a call arg for apply: either val, or else to be evaluated only if needed via thunk(env) */
+typedef struct Arg {
+	Val val;
+	Val (*thunk)(Val*);
+	Val* env;
+} Arg;
+
+#define NUM(n) ((Val){TAG_NUM, 0, (n), NULL})
+#define FN(n) ((Val){TAG_FN, 0, (n), NULL})
+#define NIL ((Val){TAG_NIL, 0, 0, NULL})
+
+static void fail(const char* msg, const Val* culprit);
+static Val mkclosure(int64_t fn, int nargs, const Val* args);
+static Val op(int64_t code, Val lhs, Val rhs);
+static Val apply(Val callee, int nargs, const Arg* args);
+static void write_json(FILE* f, Val v);
+static void write_list_bytes(FILE* f, Val v);
+static void write_string(FILE* f, Val v);
+`
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+func compile(prog Prog) string {
+	var buf strings.Builder
+	buf.WriteString(goRuntimeSrc)
+	buf.WriteString("\nvar defArgs = [][]int{\n")
+	for i := range prog {
+		buf.WriteString("\t{")
+		for j, argusage := range prog[i].Args {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString(strconv.Itoa(argusage))
+		}
+		buf.WriteString("},\n")
+	}
+	buf.WriteString("}\n\nvar defSels = [][]int{\n")
+	for i := range prog {
+		if sel := prog[i].SelectorArgs(); sel == nil {
+			buf.WriteString("\tnil,\n")
+		} else {
+			buf.WriteString("\t{")
+			for j, argidx := range sel {
+				if j > 0 {
+					buf.WriteString(", ")
+				}
+				buf.WriteString(strconv.Itoa(argidx))
+			}
+			buf.WriteString("},\n")
+		}
+	}
+	buf.WriteString("}\n\nvar defFuncs []func([]Val) Val\n\nfunc init() {\n\tdefFuncs = []func([]Val) Val{\n")
+	for i := range prog {
+		buf.WriteString("\t\tfunc(a []Val) Val { return " + funcName(i) + "(")
+		for j := range prog[i].Args {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString("a[" + strconv.Itoa(j) + "]")
+		}
+		buf.WriteString(") },\n")
+	}
+	buf.WriteString("\t}\n}\n")
+
+	for i := range prog {
+		buf.WriteString("\n// " + funcComment(&prog[i]) + "\nfunc " + funcName(i) + "(")
+		for j := range prog[i].Args {
+			if j > 0 {
+				buf.WriteString(", ")
+			}
+			buf.WriteString("a" + strconv.Itoa(j))
+		}
+		if len(prog[i].Args) > 0 {
+			buf.WriteString(" Val")
+		}
+		buf.WriteString(") Val {\n\treturn " + compileExpr(prog, prog[i].Body) + "\n}\n")
+	}
+	return buf.String()
+}
+
+func compileExpr(prog Prog, expr Expr) string {
+	switch it := expr.(type) {
+	case ExprNumInt:
+		return "Val{Num: " + strconv.Itoa(int(it)) + "}"
+	case ExprArgRef:
+		return "a" + strconv.Itoa(int(-it)-2)
+	case ExprFuncRef:
+		return "Val{Tag: tagFn, Num: " + strconv.Itoa(int(it)) + "}"
+	case *ExprCall:
+		args := make([]string, len(it.Args)) // in call order, unlike `it.Args`
+		for i := range it.Args {
+			args[len(args)-1-i] = compileExpr(prog, it.Args[i])
+		}
+		if it.IsClosure > 0 {
+			return "Val{Tag: tagClosure, Num: " + strconv.Itoa(int(it.Callee.(ExprFuncRef))) + ", Args: []Val{" + strings.Join(args, ", ") + "}}"
+		}
+		callee, numargs := "", -1
+		if fn, isfn := it.Callee.(ExprFuncRef); isfn && fn < 0 && len(args) >= 2 {
+			callee, numargs = "op("+strconv.Itoa(int(fn))+", "+args[0]+", "+args[1]+")", 2
+		} else if isfn && fn >= 0 && len(prog[fn].Args) > 0 && !prog[fn].IsSelector() && len(args) >= len(prog[fn].Args) {
+			numargs = len(prog[fn].Args)
+			for i := 0; i < numargs; i++ {
+				if prog[fn].Args[i] == 0 { // unused, so never evaluated
+					args[i] = "Val{Tag: tagNil}"
+				}
+			}
+			callee = funcName(int(fn)) + "(" + strings.Join(args[:numargs], ", ") + ")"
+		} else {
+			callee, numargs = compileExpr(prog, it.Callee), 0
+		}
+		if numargs == len(args) {
+			return callee
+		}
+		lazyargs := make([]string, 0, len(args)-numargs)
+		for i := numargs; i < len(args); i++ {
+			if call, iscall := it.Args[len(args)-1-i].(*ExprCall); iscall && call.IsClosure == 0 {
+				lazyargs = append(lazyargs, "{thunk: func() Val { return "+args[i]+" }}")
+			} else {
+				lazyargs = append(lazyargs, "{val: "+args[i]+"}")
+			}
+		}
+		return "apply(" + callee + ", []arg{" + strings.Join(lazyargs, ", ") + "})"
+	}
+	panic(expr)
+}
+
+func funcName(idx int) string { return "f" + strconv.Itoa(idx) }
+
+func funcComment(def *FuncDef) (ret string) {
+	if ret = strings.Join(def.Meta, " "); ret == "" {
+		ret = "(no meta)"
+	}
+	return strings.NewReplacer("\n", " ", "\r", " ").Replace(ret)
+}
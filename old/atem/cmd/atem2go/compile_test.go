@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/metaleap/atmo/old/atem"
+	"github.com/metaleap/atmo/old/atem/golden"
+)
+
+// TestCompileWithGo compiles all `.opt` programs in `tmpdummies` (those with
+// `.expected` files) to Go, builds them with `go build` and runs them, failing
+// on any output differing from that of `Prog.Eval`. Skipped if there's no `go`.
+func TestCompileWithGo(t *testing.T) {
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go on PATH")
+	}
+	cases, err := golden.Discover(filepath.Join("..", "..", "tmpdummies"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirpath := t.TempDir()
+	for _, it := range cases {
+		if it.Expected == nil || !strings.HasSuffix(it.SrcFilePath, ".opt.json") {
+			continue
+		}
+		want, err := it.Run(EngineInterp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		src, err := ioutil.ReadFile(it.SrcFilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := strings.TrimSuffix(filepath.Base(it.SrcFilePath), ".json")
+		gosrcfilepath, binfilepath := filepath.Join(dirpath, name+".go"), filepath.Join(dirpath, name)
+		if err = ioutil.WriteFile(gosrcfilepath, []byte(compile(LoadFromJson(src))), 0644); err != nil {
+			t.Fatal(err)
+		}
+		build := exec.Command(gobin, "build", "-o", binfilepath, gosrcfilepath)
+		build.Dir, build.Env = dirpath, append(os.Environ(), "GO111MODULE=off")
+		if out, err := build.CombinedOutput(); err != nil {
+			t.Errorf("%s: %v\n%s", name, err, out)
+			continue
+		}
+
+		var got bytes.Buffer
+		cmd := exec.Command(binfilepath, it.Args...)
+		cmd.Env, cmd.Stdin, cmd.Stdout, cmd.Stderr = append([]string{}, it.Env...), bytes.NewReader(it.Stdin), &got, &got
+		if err = cmd.Run(); err != nil {
+			if _, failed := err.(*exec.ExitError); !failed {
+				t.Fatal(err)
+			}
+		}
+		if diff := golden.Diff(want, got.Bytes()); diff != "" {
+			t.Errorf("%s: Go output differs from Prog.Eval's:\n%s", name, diff)
+		}
+	}
+}
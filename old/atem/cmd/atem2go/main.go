@@ -0,0 +1,43 @@
+// A transpiler from [atem](../../readme.md) `.json` source files to standalone
+// Go programs. The single (and required) command arg is the `.json` source
+// file for the `atem.Prog` to `atem.LoadFromJson()`, the generated `.go`
+// source is written to `stdout`.
+//
+// Every `FuncDef` becomes a Go func over the generated `Val` type, tagging
+// nums, func-refs / op-codes and closures. Calls to statically known `FuncDef`s
+// (other than selectors) with enough args become direct Go calls, with args not
+// used by the callee never evaluated. All other calls go through `apply`, which
+// is passed the args as thunks (unless atomic) to likewise only ever evaluate
+// those that end up being needed, which short-cuts selectors just like `Eval`
+// does, and which produces closures for partial applications exactly as
+// `atem.ExprCall` closures with `.IsClosure > 0` during `Eval`. Prim-ops become
+// native Go arithmetic and comparisons, except `OpEval`.
+//
+// The generated program follows the same conventions as `cmd/atem`: the last
+// `FuncDef` is main, gets passed the process args and env as linked-lists of
+// text strings, and its result is written to `stdout` (if a text string) or as
+// `RET-EXPR` to `stderr` (if not), or drives the `stdin` handler protocol. So
+// outputs from both can be diffed against each other.
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+func main() {
+	src, err := ioutil.ReadFile(os.Args[1])
+	if err == nil {
+		prog := LoadFromJson(src)
+		if numargs := len(prog[len(prog)-1].Args); 2 != numargs {
+			panic("Your main FuncDef needs exactly 2 Args but has " + strconv.Itoa(numargs) + ": " + prog[len(prog)-1].JsonSrc(false))
+		}
+		_, err = os.Stdout.WriteString(compile(prog))
+	}
+	if err != nil {
+		panic(err)
+	}
+}
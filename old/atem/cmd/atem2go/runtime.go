@@ -0,0 +1,308 @@
+package main
+
+// goRuntimeSrc is prepended to every generated Go program. It provides the
+// tagged `Val` type, `apply` for all calls to not-statically-known callees
+// (or with not-statically-known arg counts), the prim-ops and the `main`
+// mirroring `cmd/atem`: same process args and env lists, same stdout
+// string output or stderr `RET-EXPR` fallback, same stdin handler protocol.
+const goRuntimeSrc = `// Code generated by atem2go. DO NOT EDIT.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"runtime/debug"
+	"strconv"
+)
+
+const (
+	tagNum = iota
+	tagFn
+	tagClosure
+	tagNil // dropped args, never used by the callee so never evaluated
+)
+
+// Val is a num (Num), a func-ref or op-code (Num), or a closure (func-ref or op-code
+// in Num, args in Args in call order) as in the atem reference interpreter.
+type Val struct {
+	Tag  int
+	Num  int
+	Args []Val
+}
+
+type arg struct {
+	val   Val
+	thunk func() Val
+}
+
+func (me arg) get() Val {
+	if me.thunk != nil {
+		return me.thunk()
+	}
+	return me.val
+}
+
+type errOp [2]Val
+
+func num(v Val) int {
+	if v.Tag != tagNum {
+		panic("not a num: " + v.jsonSrc())
+	}
+	return v.Num
+}
+
+func boolish(b bool) Val {
+	if b {
+		return Val{Tag: tagFn, Num: 1}
+	}
+	return Val{Tag: tagFn, Num: 2}
+}
+
+func op(code int, lhs Val, rhs Val) Val {
+	switch code {
+	case -1:
+		return Val{Num: num(lhs) + num(rhs)}
+	case -2:
+		return Val{Num: num(lhs) - num(rhs)}
+	case -3:
+		return Val{Num: num(lhs) * num(rhs)}
+	case -4:
+		return Val{Num: num(lhs) / num(rhs)}
+	case -5:
+		return Val{Num: num(lhs) % num(rhs)}
+	case -6:
+		return boolish(eq(lhs, rhs))
+	case -7:
+		return boolish(num(lhs) < num(rhs))
+	case -8:
+		return boolish(num(lhs) > num(rhs))
+	case -42:
+		_, _ = os.Stderr.Write(append(append(append(listToBytes(listOf(lhs)), '\t'), listToString(rhs)...), '\n'))
+		return rhs
+	case -4242:
+		panic("OpEval is not supported in atem2go outputs")
+	case -1010101:
+		panic(errOp{lhs, rhs})
+	}
+	panic("unknown op-code " + strconv.Itoa(code))
+}
+
+func eq(v Val, cmp Val) bool {
+	if v.Tag != cmp.Tag || v.Num != cmp.Num || len(v.Args) != len(cmp.Args) {
+		return false
+	}
+	for i := range v.Args {
+		if !eq(v.Args[i], cmp.Args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// force reduces nullary func-refs as the interpreter does for root and callee positions.
+func force(v Val) Val {
+	for v.Tag == tagFn && v.Num >= 0 && len(defArgs[v.Num]) == 0 {
+		v = defFuncs[v.Num](nil)
+	}
+	return v
+}
+
+func apply(callee Val, args []arg) Val {
+	for {
+		callee = force(callee)
+		if len(args) == 0 {
+			return callee
+		}
+		fn, have := callee.Num, callee.Args
+		if callee.Tag != tagFn && callee.Tag != tagClosure {
+			panic("not callable: " + callee.jsonSrc())
+		}
+		usage, sel := []int{1, 1}, []int(nil)
+		if fn >= 0 {
+			usage, sel = defArgs[fn], defSels[fn]
+		}
+		if sel != nil && len(have)+len(args) >= len(usage) {
+			// a selector: as in the interpreter, pass on the selected args without evaluating any
+			all := make([]arg, len(have), len(have)+len(args))
+			for i := range have {
+				all[i].val = have[i]
+			}
+			all = append(all, args...)
+			selargs := make([]arg, len(sel)-1, len(sel)-1+len(all)-len(usage))
+			for i := range selargs {
+				selargs[i] = all[sel[1+i]]
+			}
+			callee, args = all[sel[0]].get(), append(selargs, all[len(usage):]...)
+			continue
+		}
+		all, n := make([]Val, len(have), len(usage)), len(usage)-len(have)
+		copy(all, have)
+		for i := 0; i < n && i < len(args); i++ {
+			if usage[len(have)+i] == 0 {
+				all = append(all, Val{Tag: tagNil})
+			} else {
+				all = append(all, args[i].get())
+			}
+		}
+		if len(args) < n {
+			return Val{Tag: tagClosure, Num: fn, Args: all}
+		}
+		var result Val
+		if fn < 0 {
+			result = op(fn, all[0], all[1])
+		} else {
+			result = defFuncs[fn](all)
+		}
+		if args = args[n:]; len(args) == 0 {
+			return result
+		}
+		callee = result
+	}
+}
+
+func (me Val) jsonSrc() string {
+	switch me.Tag {
+	case tagNum:
+		return strconv.Itoa(me.Num)
+	case tagFn:
+		return "[" + strconv.Itoa(me.Num) + "]"
+	case tagClosure:
+		ret := "[[" + strconv.Itoa(me.Num) + "]"
+		for _, it := range me.Args {
+			ret += ", " + it.jsonSrc()
+		}
+		return ret + "]"
+	}
+	return "null"
+}
+
+func listOf(v Val) (ret []Val) {
+	ret = make([]Val, 0, 1024)
+	for {
+		if v.Tag == tagFn && v.Num == 3 {
+			return
+		} else if v.Tag != tagClosure || v.Num != 4 || len(v.Args) != 2 {
+			return nil
+		}
+		ret, v = append(ret, v.Args[0]), v.Args[1]
+	}
+}
+
+func listToBytes(list []Val) (ret []byte) {
+	if list != nil {
+		ret = make([]byte, 0, len(list))
+		for _, v := range list {
+			if v.Tag != tagNum || v.Num < 0 || v.Num > 255 {
+				return nil
+			}
+			ret = append(ret, byte(v.Num))
+		}
+	}
+	return
+}
+
+func listToString(v Val) string {
+	if list := listOf(v); list != nil {
+		if bytes := listToBytes(list); bytes != nil {
+			return string(bytes)
+		}
+	}
+	return v.jsonSrc()
+}
+
+func listFrom(str []byte) Val {
+	ret := Val{Tag: tagFn, Num: 3}
+	for i := len(str) - 1; i > -1; i-- {
+		ret = Val{Tag: tagClosure, Num: 4, Args: []Val{{Num: int(str[i])}, ret}}
+	}
+	return ret
+}
+
+func listsFrom(strs []string) Val {
+	ret := Val{Tag: tagFn, Num: 3}
+	for i := len(strs) - 1; i > -1; i-- {
+		ret = Val{Tag: tagClosure, Num: 4, Args: []Val{listFrom([]byte(strs[i])), ret}}
+	}
+	return ret
+}
+
+func main() {
+	debug.SetMaxStack(1 << 32)
+	defer func() {
+		if thrown := recover(); thrown != nil {
+			if err, ok := thrown.(errOp); !ok {
+				panic(thrown)
+			} else {
+				os.Stderr.WriteString(listToString(err[0]) + "\t" + listToString(err[1]) + "\n")
+				os.Exit(1)
+			}
+		}
+	}()
+	outval := force(apply(Val{Tag: tagFn, Num: len(defFuncs) - 1}, []arg{{val: listsFrom(os.Args[1:])}, {val: listsFrom(os.Environ())}}))
+	outlist := listOf(outval)
+	if outbytes := listToBytes(outlist); outbytes != nil {
+		os.Stdout.Write(append(outbytes, '\n'))
+	} else if outlist == nil || !probeIfStdinReaderAndIfSoHandleOnceOrForever(outlist) {
+		os.Stderr.WriteString("RET-EXPR:\t" + outval.jsonSrc() + "\n")
+	}
+}
+
+func probeIfStdinReaderAndIfSoHandleOnceOrForever(retList []Val) bool {
+	if len(retList) != 4 || retList[0].Tag != tagFn || retList[0].Num <= 4 || retList[0].Num >= len(defFuncs)-1 || len(defArgs[retList[0].Num]) != 2 {
+		return false
+	} else if sepchar := retList[1]; sepchar.Tag != tagNum || sepchar.Num < 0 || sepchar.Num > 255 {
+		return false
+	} else if (retList[3].Tag != tagClosure) && !(retList[3].Tag == tagFn && retList[3].Num == 3) {
+		return false
+	} else if initialoutput := listToBytes(listOf(retList[3])); initialoutput == nil {
+		return false
+	} else {
+		handlenextinput := func(prevstate Val, input []byte) (nextstate Val) {
+			retval := force(apply(retList[0], []arg{{val: prevstate}, {val: listFrom(input)}}))
+			if retlist := listOf(retval); len(retlist) == 2 {
+				nextstate = retlist[0]
+				if outlist := listOf(retlist[1]); outlist != nil {
+					os.Stdout.Write(listToBytes(outlist))
+				} else {
+					os.Stderr.WriteString("RET-EXPR:\t" + retlist[1].jsonSrc() + "\n")
+				}
+			} else {
+				panic(len(retList))
+			}
+			return
+		}
+
+		if os.Stdout.Write(initialoutput); sepchar.Num == 0 {
+			if allinputatonce, err := ioutil.ReadAll(os.Stdin); err != nil {
+				panic(err)
+			} else {
+				_ = handlenextinput(retList[2], allinputatonce)
+			}
+		} else {
+			stdin := bufio.NewScanner(os.Stdin)
+			if sepchar.Num != '\n' {
+				stdin.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
+					if i := bytes.IndexByte(data, byte(sepchar.Num)); i >= 0 {
+						advance, token = i+1, data[0:i]
+					} else if atEOF {
+						advance, token = len(data), data
+					}
+					return
+				})
+			}
+			for state := retList[2]; stdin.Scan(); {
+				if state = handlenextinput(state, stdin.Bytes()); state.Tag == tagFn && state.Num == 0 {
+					break
+				}
+			}
+			if err := stdin.Err(); err != nil {
+				panic(err)
+			}
+		}
+		return true
+	}
+}
+`
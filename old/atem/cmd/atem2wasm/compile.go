@@ -0,0 +1,207 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+type compilation struct {
+	prog      Prog
+	funcs     []string // all generated WAT thunk funcs (lazily-evaluated call args)
+	numThunks int
+	cur       *watFunc // the WAT func currently being generated
+}
+
+type watFunc struct {
+	numLocals int
+	body      strings.Builder
+}
+
+// compile emits the WebAssembly text format of the module for `prog`.
+func compile(prog Prog) string {
+	me := compilation{prog: prog}
+	defs := make([]string, len(prog))
+	for i := range prog {
+		defs[i] = me.genFunc("$f"+strconv.Itoa(i), "\t;; "+funcComment(&prog[i])+"\n", prog[i].Body)
+	}
+
+	// linear memory starts with the nil cell, followed by the `FuncDef` tables
+	data := make([]byte, 16, 16+16*len(prog))
+	data[0] = 3
+	var usage, sels []int
+	for i := range prog {
+		data = appendI32(data, len(prog[i].Args))
+	}
+	for i := range prog {
+		data = appendI32(data, len(usage))
+		usage = append(usage, prog[i].Args...)
+	}
+	for i := range prog {
+		data = appendI32(data, len(prog[i].SelectorArgs()))
+	}
+	for i := range prog {
+		data = appendI32(data, len(sels))
+		sels = append(sels, prog[i].SelectorArgs()...)
+	}
+	for _, argusage := range usage {
+		data = appendI32(data, argusage)
+	}
+	for _, argidx := range sels {
+		data = appendI32(data, argidx)
+	}
+	heapstart := (len(data) + 7) &^ 7
+
+	var buf strings.Builder
+	buf.WriteString(";; Code generated by atem2wasm. DO NOT EDIT.\n\n(module\n")
+	buf.WriteString("\t(type $def (func (param i32) (result i32)))\n")
+	buf.WriteString("\t(import \"atem\" \"prt\" (func $prt (param i32 i32)))\n")
+	buf.WriteString("\t(import \"atem\" \"err\" (func $err (param i32 i32 i32)))\n")
+	buf.WriteString("\t(memory $mem " + strconv.Itoa(1+heapstart/65536) + ")\n")
+	buf.WriteString("\t(table $tbl " + strconv.Itoa(len(prog)+me.numThunks) + " funcref)\n")
+	for _, global := range []struct {
+		name string
+		val  int
+	}{{"num_defs", len(prog)}, {"def_nargs", 16}, {"def_usage_offs", 16 + 4*len(prog)}, {"def_nsels", 16 + 8*len(prog)},
+		{"def_sels_offs", 16 + 12*len(prog)}, {"def_usage", 16 + 16*len(prog)}, {"def_sels", 16 + 16*len(prog) + 4*len(usage)}} {
+		buf.WriteString("\t(global $" + global.name + " i32 (i32.const " + strconv.Itoa(global.val) + "))\n")
+	}
+	buf.WriteString("\t(global $heap (mut i32) (i32.const " + strconv.Itoa(heapstart) + "))\n")
+	buf.WriteString("\t(export \"memory\" (memory $mem))\n")
+	for _, name := range watExports {
+		buf.WriteString("\t(export \"" + name + "\" (func $" + name + "))\n")
+	}
+	buf.WriteString("\t(elem (i32.const 0)")
+	for i := range prog {
+		buf.WriteString(" $f" + strconv.Itoa(i))
+	}
+	for i := 0; i < me.numThunks; i++ {
+		buf.WriteString(" $t" + strconv.Itoa(i))
+	}
+	buf.WriteString(")\n\t(data (i32.const 0) \"")
+	for _, b := range data {
+		buf.WriteString("\\" + strconv.FormatUint(uint64(b>>4), 16) + strconv.FormatUint(uint64(b&15), 16))
+	}
+	buf.WriteString("\")\n")
+	buf.WriteString(watRuntimeSrc)
+	for _, src := range me.funcs {
+		buf.WriteString("\n" + src)
+	}
+	for _, src := range defs {
+		buf.WriteString("\n" + src)
+	}
+	buf.WriteString(")\n")
+	return buf.String()
+}
+
+// genFunc emits a WAT func returning `body`, with all args (of the current `FuncDef`) accessed via `$a`.
+func (me *compilation) genFunc(name string, comment string, body Expr) string {
+	outer := me.cur
+	me.cur = &watFunc{}
+	me.genExpr(body)
+	src := comment + "\t(func " + name + " (param $a i32) (result i32)"
+	if me.cur.numLocals > 0 {
+		src += " (local" + strings.Repeat(" i32", me.cur.numLocals) + ")"
+	}
+	src += "\n" + me.cur.body.String() + "\t)\n"
+	me.cur = outer
+	return src
+}
+
+func (me *compilation) emit(instrs ...string) {
+	for _, instr := range instrs {
+		me.cur.body.WriteString("\t\t" + instr + "\n")
+	}
+}
+
+func (me *compilation) local() string {
+	me.cur.numLocals++
+	return strconv.Itoa(me.cur.numLocals) // index 0 is `$a`
+}
+
+// genExpr emits instructions leaving the value of `expr` on the stack, with
+// call args evaluated in the same left-to-right order as by the interpreter.
+func (me *compilation) genExpr(expr Expr) {
+	switch it := expr.(type) {
+	case ExprNumInt:
+		me.emit("i64.const "+strconv.Itoa(int(it)), "call $mknum")
+	case ExprArgRef:
+		me.emit("local.get $a", "i32.load offset="+strconv.Itoa(4*(int(-it)-2)))
+	case ExprFuncRef:
+		me.emit("i32.const "+strconv.Itoa(int(it)), "call $mkfn")
+	case *ExprCall:
+		argexprs := make([]Expr, len(it.Args)) // in call order, unlike `it.Args`
+		for i := range it.Args {
+			argexprs[len(argexprs)-1-i] = it.Args[i]
+		}
+		if it.IsClosure > 0 {
+			tmp := me.local()
+			me.emit("i32.const 2", "i32.const "+strconv.Itoa(len(argexprs)), "i64.const "+strconv.Itoa(int(it.Callee.(ExprFuncRef))), "call $cell", "local.set "+tmp)
+			for i := range argexprs {
+				me.emit("local.get " + tmp)
+				me.genExpr(argexprs[i])
+				me.emit("i32.store offset=" + strconv.Itoa(16+4*i))
+			}
+			me.emit("local.get " + tmp)
+			return
+		}
+		numargs := 0
+		if fn, isfn := it.Callee.(ExprFuncRef); isfn && fn < 0 && len(argexprs) >= 2 {
+			numargs = 2
+			me.emit("i32.const " + strconv.Itoa(int(fn)))
+			me.genExpr(argexprs[0])
+			me.genExpr(argexprs[1])
+			me.emit("call $op")
+		} else if isfn && fn >= 0 && len(me.prog[fn].Args) > 0 && !me.prog[fn].IsSelector() && len(argexprs) >= len(me.prog[fn].Args) {
+			numargs = len(me.prog[fn].Args)
+			tmp := me.local()
+			me.emit("i32.const "+strconv.Itoa(4*numargs), "call $alloc", "local.set "+tmp)
+			for i := 0; i < numargs; i++ {
+				if me.emit("local.get " + tmp); me.prog[fn].Args[i] == 0 { // unused, so never evaluated
+					me.emit("i32.const 0")
+				} else {
+					me.genExpr(argexprs[i])
+				}
+				me.emit("i32.store offset=" + strconv.Itoa(4*i))
+			}
+			me.emit("local.get "+tmp, "call $f"+strconv.Itoa(int(fn)))
+		} else {
+			me.genExpr(it.Callee)
+		}
+		if numargs == len(argexprs) {
+			return
+		}
+		lazyargs, tmp := argexprs[numargs:], me.local()
+		me.emit("i32.const "+strconv.Itoa(12*len(lazyargs)), "call $alloc", "local.set "+tmp)
+		for i, argexpr := range lazyargs {
+			offset := 12 * i
+			if call, iscall := argexpr.(*ExprCall); iscall && call.IsClosure == 0 {
+				name := "$t" + strconv.Itoa(me.numThunks)
+				me.emit("local.get "+tmp, "i32.const "+strconv.Itoa(len(me.prog)+me.numThunks), "i32.store offset="+strconv.Itoa(offset+4))
+				me.emit("local.get "+tmp, "local.get $a", "i32.store offset="+strconv.Itoa(offset+8))
+				me.numThunks++
+				me.funcs = append(me.funcs, me.genFunc(name, "", argexpr))
+			} else {
+				me.emit("local.get " + tmp)
+				me.genExpr(argexpr)
+				me.emit("i32.store offset="+strconv.Itoa(offset), "local.get "+tmp, "i32.const -1", "i32.store offset="+strconv.Itoa(offset+4))
+			}
+		}
+		me.emit("i32.const "+strconv.Itoa(len(lazyargs)), "local.get "+tmp, "call $apply")
+		return
+	default:
+		panic(expr)
+	}
+}
+
+func appendI32(data []byte, i32 int) []byte {
+	return append(data, byte(i32), byte(i32>>8), byte(i32>>16), byte(i32>>24))
+}
+
+func funcComment(def *FuncDef) (ret string) {
+	if ret = strings.Join(def.Meta, " "); ret == "" {
+		ret = "(no meta)"
+	}
+	return strings.NewReplacer("\n", " ", "\r", " ").Replace(ret)
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/metaleap/atmo/old/atem"
+	"github.com/metaleap/atmo/old/atem/golden"
+)
+
+// testCases are all `.opt` programs in `tmpdummies` with `.expected` files.
+func testCases(t *testing.T) (ret []golden.Case) {
+	cases, err := golden.Discover(filepath.Join("..", "..", "tmpdummies"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, it := range cases {
+		if it.Expected != nil && strings.HasSuffix(it.SrcFilePath, ".opt.json") {
+			ret = append(ret, it)
+		}
+	}
+	return
+}
+
+func testCompile(t *testing.T, it *golden.Case) []byte {
+	src, err := ioutil.ReadFile(it.SrcFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return assemble(compile(LoadFromJson(src)))
+}
+
+// TestAssemble decodes the binary modules of all `testCases`, failing on any
+// structural error: malformed or out-of-order sections, unknown instructions,
+// out-of-range indices, unbalanced blocks or sizes not matching the contents.
+func TestAssemble(t *testing.T) {
+	for _, it := range testCases(t) {
+		if err := testDecode(testCompile(t, &it)); err != nil {
+			t.Errorf("%s: %v", it.SrcFilePath, err)
+		}
+	}
+}
+
+// TestRunWithNode runs the modules of all `testCases` in `node` via the
+// `testNodeHost` glue, failing on any output differing from that of
+// `Prog.Eval`. Skipped if there's no `node`.
+func TestRunWithNode(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("no node on PATH")
+	}
+	dirpath := t.TempDir()
+	hostfilepath := filepath.Join(dirpath, "host.js")
+	if err = ioutil.WriteFile(hostfilepath, []byte(testNodeHost), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, it := range testCases(t) {
+		want, err := it.Run(EngineInterp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := strings.TrimSuffix(filepath.Base(it.SrcFilePath), ".json")
+		wasmfilepath := filepath.Join(dirpath, name+".wasm")
+		if err = ioutil.WriteFile(wasmfilepath, testCompile(t, &it), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var got bytes.Buffer
+		cmd := exec.Command(node, append([]string{hostfilepath, wasmfilepath}, it.Args...)...)
+		cmd.Env, cmd.Stdin, cmd.Stdout, cmd.Stderr = append([]string{}, it.Env...), bytes.NewReader(it.Stdin), &got, &got
+		if err = cmd.Run(); err != nil {
+			if _, failed := err.(*exec.ExitError); !failed {
+				t.Fatal(err)
+			}
+		}
+		if diff := golden.Diff(want, got.Bytes()); diff != "" {
+			t.Errorf("%s: wasm output differs from Prog.Eval's:\n%s", name, diff)
+		}
+	}
+}
+
+// testNodeHost runs the module (first arg) with the remaining args and the env
+// by the same conventions as `cmd/atem`, including the `stdin` handler protocol.
+const testNodeHost = `
+const fs = require('fs')
+const out = (fd, str) => fs.writeSync(fd, Buffer.from(str, 'latin1'))
+let ex
+const mem = () => new DataView(ex.memory.buffer)
+const cell = (v) => ({ tag: mem().getInt32(v, true), num: Number(mem().getBigInt64(v + 8, true)),
+	args: Array.from({ length: mem().getInt32(v + 4, true) }, (_, i) => mem().getInt32(v + 16 + 4 * i, true)) })
+const listOf = (v) => {
+	const ret = []
+	for (let c = cell(v); ; c = cell(c.args[1])) {
+		if (c.tag === 1 && c.num === 3) return ret
+		if (c.tag !== 2 || c.num !== 4 || c.args.length !== 2) return null
+		ret.push(c.args[0])
+	}
+}
+const listToBytes = (list) => {
+	if (list === null) return null
+	let ret = ''
+	for (const v of list) {
+		const c = cell(v)
+		if (c.tag !== 0 || c.num < 0 || c.num > 255) return null
+		ret += String.fromCharCode(c.num)
+	}
+	return ret
+}
+const jsonSrc = (v) => {
+	const c = cell(v)
+	switch (c.tag) {
+		case 0: return String(c.num)
+		case 1: return '[' + c.num + ']'
+		case 2: return '[[' + c.num + ']' + c.args.map((a) => ', ' + jsonSrc(a)).join('') + ']'
+	}
+	return 'null'
+}
+const listToString = (v) => { const str = listToBytes(listOf(v)); return (str === null) ? jsonSrc(v) : str }
+const listFrom = (str) => {
+	const ptr = ex.alloc(str.length)
+	new Uint8Array(ex.memory.buffer).set(Buffer.from(str, 'latin1'), ptr)
+	return ex.list_from(ptr, str.length)
+}
+const listsFrom = (strs) => strs.reduceRight((tail, str) => ex.list_link(listFrom(str), tail), ex.list_end())
+const errs = ['', 'not a num', 'not callable', 'division by zero', 'OpEval not supported', 'out of memory', 'unknown op-code']
+
+const imports = { atem: {
+	prt: (lhs, rhs) => out(2, (listToBytes(listOf(lhs)) || '') + '\t' + listToString(rhs) + '\n'),
+	err: (kind, lhs, rhs) => {
+		out(2, (kind === 0) ? (listToString(lhs) + '\t' + listToString(rhs) + '\n') : (errs[kind] + ': ' + jsonSrc(lhs) + '\n'))
+		process.exit(1)
+	},
+} }
+WebAssembly.instantiate(fs.readFileSync(process.argv[2]), imports).then(({ instance }) => {
+	ex = instance.exports
+	const env = Object.entries(process.env).map(([k, v]) => k + '=' + v)
+	const ret = ex.main(listsFrom(process.argv.slice(3)), listsFrom(env)), retlist = listOf(ret), str = listToBytes(retlist)
+	if (str !== null) return out(1, str + '\n')
+	const handler = retlist && (retlist.length === 4) && cell(retlist[0]), sepchar = handler && cell(retlist[1])
+	const initialoutput = sepchar && listToBytes(listOf(retlist[3]))
+	if (!(handler && handler.tag === 1 && handler.num > 4 && sepchar.tag === 0 && initialoutput !== null))
+		return out(2, 'RET-EXPR:\t' + jsonSrc(ret) + '\n')
+	out(1, initialoutput)
+	const stdin = fs.readFileSync(0, 'latin1'), inputs = (sepchar.num === 0) ? [stdin] : stdin.split(String.fromCharCode(sepchar.num))
+	if (sepchar.num !== 0 && inputs[inputs.length - 1] === '') inputs.pop()
+	let state = retlist[2]
+	for (const input of inputs) {
+		const next = listOf(ex.apply2(retlist[0], state, listFrom(input)))
+		const output = listToBytes(listOf(next[1]))
+		out((output === null) ? 2 : 1, (output === null) ? ('RET-EXPR:\t' + jsonSrc(next[1]) + '\n') : output)
+		const c = cell(state = next[0])
+		if (c.tag === 1 && c.num === 0) break
+	}
+})
+`
+
+// testDecode checks the structure of the binary `module` against the
+// WebAssembly spec, covering the same subset as `assemble`.
+func testDecode(module []byte) error {
+	dec := testDecoder{data: module}
+	if !bytes.HasPrefix(module, []byte{0, 'a', 's', 'm', 1, 0, 0, 0}) {
+		return errors.New("bad magic or version")
+	}
+	dec.pos = 8
+	var typeparams, functypes []int // num params per type, type per non-imported func
+	numfuncs, numglobals, numtablefuncs, numcodes, lastsecid := 0, 0, 0, 0, 0
+	exports := map[string]bool{}
+	for dec.pos < len(module) {
+		secid := int(dec.byte())
+		size := dec.uleb()
+		if secid <= lastsecid || secid > 11 {
+			return errors.New("section " + strconv.Itoa(secid) + " out of order")
+		}
+		end := dec.pos + size
+		lastsecid = secid
+		num := dec.uleb()
+		for i := 0; i < num && dec.err == nil; i++ {
+			switch secid {
+			case 1: // types
+				dec.expect(0x60)
+				numparams := dec.uleb()
+				for j := 0; j < numparams; j++ {
+					dec.valtype()
+				}
+				for j, n := 0, dec.uleb(); j < n; j++ {
+					dec.valtype()
+				}
+				typeparams = append(typeparams, numparams)
+			case 2: // imports
+				dec.name()
+				dec.name()
+				dec.expect(0)
+				dec.idx(len(typeparams))
+				numfuncs++
+			case 3: // funcs
+				functypes = append(functypes, dec.idx(len(typeparams)))
+			case 4: // table
+				dec.expect(0x70)
+				dec.expect(0)
+				numtablefuncs = dec.uleb()
+			case 5: // memory
+				dec.expect(0)
+				dec.uleb()
+			case 6: // globals
+				dec.valtype()
+				dec.byte()
+				dec.constExpr(0)
+				numglobals++
+			case 7: // exports
+				name := dec.name()
+				if exports[name] {
+					dec.fail("duplicate export " + name)
+				}
+				exports[name] = true
+				switch kind := dec.byte(); kind {
+				case 0:
+					dec.idx(numfuncs + len(functypes))
+				case 2:
+					dec.idx(1)
+				default:
+					dec.fail("unexpected export kind")
+				}
+			case 9: // elems
+				dec.expect(0)
+				dec.constExpr(numglobals)
+				n := dec.uleb()
+				if n > numtablefuncs {
+					dec.fail("more elems than table slots")
+				}
+				for j := 0; j < n; j++ {
+					dec.idx(numfuncs + len(functypes))
+				}
+			case 10: // code
+				if numcodes++; numcodes > len(functypes) {
+					dec.fail("more codes than funcs")
+				} else {
+					dec.funcBody(typeparams[functypes[numcodes-1]], len(typeparams), numfuncs+len(functypes), numglobals)
+				}
+			case 11: // data
+				dec.expect(0)
+				dec.constExpr(numglobals)
+				dec.pos += dec.uleb()
+			default:
+				dec.fail("unexpected section")
+			}
+		}
+		if dec.err != nil {
+			return errors.New("section " + strconv.Itoa(secid) + ": " + dec.err.Error())
+		} else if dec.pos != end {
+			return errors.New("section " + strconv.Itoa(secid) + ": size mismatch")
+		}
+	}
+	if numcodes != len(functypes) {
+		return errors.New("func and code counts differ")
+	}
+	for _, name := range append([]string{"memory"}, watExports...) {
+		if !exports[name] {
+			return errors.New("missing export " + name)
+		}
+	}
+	return nil
+}
+
+type testDecoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (me *testDecoder) fail(msg string) {
+	if me.err == nil {
+		me.err = errors.New(msg + " at byte " + strconv.Itoa(me.pos))
+	}
+}
+
+func (me *testDecoder) byte() (ret byte) {
+	if me.pos >= len(me.data) {
+		me.fail("unexpected end")
+		return 0x0b
+	}
+	ret, me.pos = me.data[me.pos], me.pos+1
+	return
+}
+
+func (me *testDecoder) expect(b byte) {
+	if me.byte() != b {
+		me.fail("expected " + strconv.Itoa(int(b)))
+	}
+}
+
+func (me *testDecoder) uleb() (ret int) {
+	for shift := 0; me.err == nil; shift += 7 {
+		b := me.byte()
+		if ret |= int(b&0x7f) << shift; b&0x80 == 0 {
+			break
+		}
+	}
+	return
+}
+
+func (me *testDecoder) sleb() {
+	for b := me.byte(); b&0x80 != 0 && me.err == nil; b = me.byte() {
+	}
+}
+
+func (me *testDecoder) idx(max int) int {
+	if idx := me.uleb(); idx < max {
+		return idx
+	}
+	me.fail("index out of range")
+	return 0
+}
+
+func (me *testDecoder) name() string {
+	n := me.uleb()
+	if me.pos+n > len(me.data) {
+		me.fail("name too long")
+		return ""
+	}
+	me.pos += n
+	return string(me.data[me.pos-n : me.pos])
+}
+
+func (me *testDecoder) valtype() {
+	if b := me.byte(); b != 0x7f && b != 0x7e {
+		me.fail("unexpected value type")
+	}
+}
+
+func (me *testDecoder) constExpr(numGlobals int) {
+	switch me.byte() {
+	case 0x41, 0x42:
+		me.sleb()
+	case 0x23:
+		me.idx(numGlobals)
+	default:
+		me.fail("unexpected const expr")
+	}
+	me.expect(0x0b)
+}
+
+func (me *testDecoder) funcBody(numParams int, numTypes int, numFuncs int, numGlobals int) {
+	end := me.uleb()
+	end += me.pos
+	numlocals := numParams
+	for i, n := 0, me.uleb(); i < n; i++ {
+		numlocals += me.uleb()
+		me.valtype()
+	}
+	var blocks []byte // opcodes of all currently open blocks
+	for depth := 1; depth > 0 && me.err == nil && me.pos < end; {
+		switch op := me.byte(); {
+		case op == 0x00 || op == 0x0f || op == 0x1a || op == 0x1b || (op >= 0x45 && op <= 0xbf):
+		case op == 0x02 || op == 0x03 || op == 0x04:
+			if b := me.byte(); b != 0x40 && b != 0x7f && b != 0x7e {
+				me.fail("unexpected block type")
+			}
+			depth, blocks = depth+1, append(blocks, op)
+		case op == 0x05:
+			if len(blocks) == 0 || blocks[len(blocks)-1] != 0x04 {
+				me.fail("else outside of if")
+			}
+		case op == 0x0b:
+			if depth--; len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+		case op == 0x0c || op == 0x0d:
+			me.idx(depth)
+		case op == 0x10:
+			me.idx(numFuncs)
+		case op == 0x11:
+			me.idx(numTypes)
+			me.expect(0)
+		case op >= 0x20 && op <= 0x22:
+			me.idx(numlocals)
+		case op == 0x23 || op == 0x24:
+			me.idx(numGlobals)
+		case op >= 0x28 && op <= 0x3e:
+			me.uleb()
+			me.uleb()
+		case op == 0x3f || op == 0x40:
+			me.expect(0)
+		case op == 0x41 || op == 0x42:
+			me.sleb()
+		default:
+			me.fail("unknown opcode " + strconv.Itoa(int(op)))
+		}
+		if depth == 0 && me.pos != end {
+			me.fail("func body continues after its end")
+		}
+	}
+	if me.pos != end {
+		me.fail("func body size mismatch")
+	}
+}
@@ -0,0 +1,76 @@
+// A compiler from [atem](../../readme.md) `.json` source files to WebAssembly
+// modules, for running atem programs in sandboxes. The single (and required)
+// command arg is the `.json` source file for the `atem.Prog` to
+// `atem.LoadFromJson()`, the generated module is written to `stdout` in the
+// binary format, or with `-wat` in the text format instead.
+//
+// Every `FuncDef` becomes a func taking the address of its args array, values
+// being addresses of tagged heap cells (nums, func-refs / op-codes and
+// closures) in the linear memory, which is never freed: atem programs run to
+// completion and then the instance is discarded. Calls to statically known
+// `FuncDef`s (other than selectors) with enough args become direct calls, with
+// args not used by the callee never evaluated. All other calls go through the
+// bundled runtime's `apply`, with non-atomic args compiled into separate thunk
+// funcs (called via the table) to likewise only ever evaluate those that end up
+// being needed, short-cutting selectors just like `Eval` does and producing
+// closures for partial applications exactly as `atem.ExprCall` closures with
+// `.IsClosure > 0` during `Eval`. Prim-ops become native instructions, `OpEval`
+// is not supported.
+//
+// Hosts provide two imports: `atem.prt(lhs, rhs)` for `OpPrt` and
+// `atem.err(kind, lhs, rhs)`, after which the module traps (via `unreachable`)
+// should the host return at all: `kind` 0 is for `OpErr`, with `lhs` and `rhs`
+// its message and other operand values, 1 is "not a num", 2 "not callable",
+// 3 "division by zero", 4 "OpEval not supported", 5 "out of memory" and 6
+// "unknown op-code". The module exports its `memory` and:
+//
+// - `main(args, env)`: calls the main `FuncDef` (the last one, by the same
+// convention as with `cmd/atem`) with the two given linked-lists of text
+// strings and returns its result
+//
+// - `apply2(callee, arg0, arg1)`: likewise for any other callee, such as the
+// handler in the `stdin` protocol of `cmd/atem`
+//
+// - `list_end()`, `list_link(head, tail)`, `list_from(ptr, len)`: to construct
+// said text strings and lists of them, the latter from `len` bytes that the
+// host first wrote to the linear memory at the address from `alloc(len)`
+//
+// All values are the `i32` addresses of heap cells laid out as: `tag i32` at
+// offset 0 (0 for nums, 1 for func-refs and op-codes, 2 for closures, 3 for
+// the nil cell at address 0), `nargs i32` at 4, `num i64` at 8 (the num, or
+// func-ref or op-code) and for closures `nargs` arg values from 16 onwards.
+// Linked-lists are closures of `StdFuncCons` with 2 args, ended by the
+// func-ref `StdFuncNil`.
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+func main() {
+	wat := flag.Bool("wat", false, "emit the text format instead of the binary format")
+	if flag.Parse(); flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	src, err := ioutil.ReadFile(flag.Arg(0))
+	if err == nil {
+		prog := LoadFromJson(src)
+		if numargs := len(prog[len(prog)-1].Args); 2 != numargs {
+			panic("Your main FuncDef needs exactly 2 Args but has " + strconv.Itoa(numargs) + ": " + prog[len(prog)-1].JsonSrc(false))
+		}
+		if watsrc := compile(prog); *wat {
+			_, err = os.Stdout.WriteString(watsrc)
+		} else {
+			_, err = os.Stdout.Write(assemble(watsrc))
+		}
+	}
+	if err != nil {
+		panic(err)
+	}
+}
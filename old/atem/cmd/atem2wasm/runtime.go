@@ -0,0 +1,314 @@
+package main
+
+// watRuntimeSrc is appended to the module header of every generated module,
+// right before all generated funcs and thunks. It provides the heap (a bump
+// allocator over the linear memory, growing it as needed but never freeing:
+// atem programs run to completion and then the instance is discarded), the
+// prim-ops, `apply` for all calls to not-statically-known callees (or with
+// not-statically-known arg counts) and the exported glue for hosts.
+//
+// Every value is an `i32` address of a heap cell: `tag i32` at offset 0,
+// `nargs i32` at 4, `num i64` at 8 and `nargs` closure args (again `i32` cell
+// addresses, in call order) from 16 onwards. Address 0 is the nil cell. The
+// `apply` args are 12-byte entries of `val i32`, `thunk i32` (table index or
+// -1) and `env i32` (the args of the func that created the thunk).
+const watRuntimeSrc = `
+	(func $alloc (param $size i32) (result i32) (local $ret i32)
+		global.get $heap  local.set $ret
+		global.get $heap  local.get $size  i32.const 7  i32.add  i32.const -8  i32.and  i32.add  global.set $heap
+		block $ok
+			global.get $heap  memory.size  i32.const 16  i32.shl  i32.le_u  br_if $ok
+			global.get $heap  memory.size  i32.const 16  i32.shl  i32.sub  i32.const 16  i32.shr_u  i32.const 1  i32.add
+			memory.grow  i32.const -1  i32.ne  br_if $ok
+			i32.const 5  i32.const 0  i32.const 0  call $err  unreachable
+		end
+		local.get $ret)
+
+	(func $cell (param $tag i32) (param $nargs i32) (param $num i64) (result i32) (local $ret i32)
+		local.get $nargs  i32.const 4  i32.mul  i32.const 16  i32.add  call $alloc  local.tee $ret
+		local.get $tag  i32.store
+		local.get $ret  local.get $nargs  i32.store offset=4
+		local.get $ret  local.get $num  i64.store offset=8
+		local.get $ret)
+
+	(func $mknum (param $n i64) (result i32)
+		i32.const 0  i32.const 0  local.get $n  call $cell)
+
+	(func $mkfn (param $fn i32) (result i32)
+		i32.const 1  i32.const 0  local.get $fn  i64.extend_i32_s  call $cell)
+
+	(func $num (param $v i32) (result i64)
+		local.get $v  i32.load
+		if
+			i32.const 1  local.get $v  i32.const 0  call $err  unreachable
+		end
+		local.get $v  i64.load offset=8)
+
+	(func $eq (param $v i32) (param $cmp i32) (result i32) (local $i i32)
+		local.get $v  i32.load  local.get $cmp  i32.load  i32.ne
+		local.get $v  i32.load offset=4  local.get $cmp  i32.load offset=4  i32.ne  i32.or
+		local.get $v  i64.load offset=8  local.get $cmp  i64.load offset=8  i64.ne  i32.or
+		if
+			i32.const 0  return
+		end
+		block $done
+			loop $next
+				local.get $i  local.get $v  i32.load offset=4  i32.ge_s  br_if $done
+				local.get $v  local.get $i  i32.const 4  i32.mul  i32.add  i32.load offset=16
+				local.get $cmp  local.get $i  i32.const 4  i32.mul  i32.add  i32.load offset=16
+				call $eq  i32.eqz
+				if
+					i32.const 0  return
+				end
+				local.get $i  i32.const 1  i32.add  local.set $i
+				br $next
+			end
+		end
+		i32.const 1)
+
+	(func $op (param $code i32) (param $lhs i32) (param $rhs i32) (result i32)
+		local.get $code  i32.const -1  i32.eq
+		if
+			local.get $lhs  call $num  local.get $rhs  call $num  i64.add  call $mknum  return
+		end
+		local.get $code  i32.const -2  i32.eq
+		if
+			local.get $lhs  call $num  local.get $rhs  call $num  i64.sub  call $mknum  return
+		end
+		local.get $code  i32.const -3  i32.eq
+		if
+			local.get $lhs  call $num  local.get $rhs  call $num  i64.mul  call $mknum  return
+		end
+		local.get $code  i32.const -4  i32.eq  local.get $code  i32.const -5  i32.eq  i32.or
+		if
+			local.get $rhs  call $num  i64.eqz
+			if
+				i32.const 3  local.get $lhs  local.get $rhs  call $err  unreachable
+			end
+			local.get $code  i32.const -4  i32.eq
+			if
+				local.get $lhs  call $num  local.get $rhs  call $num  i64.div_s  call $mknum  return
+			end
+			local.get $lhs  call $num  local.get $rhs  call $num  i64.rem_s  call $mknum  return
+		end
+		local.get $code  i32.const -6  i32.eq
+		if
+			i32.const 1  i32.const 2  local.get $lhs  local.get $rhs  call $eq  select  call $mkfn  return
+		end
+		local.get $code  i32.const -7  i32.eq
+		if
+			i32.const 1  i32.const 2  local.get $lhs  call $num  local.get $rhs  call $num  i64.lt_s  select  call $mkfn  return
+		end
+		local.get $code  i32.const -8  i32.eq
+		if
+			i32.const 1  i32.const 2  local.get $lhs  call $num  local.get $rhs  call $num  i64.gt_s  select  call $mkfn  return
+		end
+		local.get $code  i32.const -42  i32.eq
+		if
+			local.get $lhs  local.get $rhs  call $prt  local.get $rhs  return
+		end
+		local.get $code  i32.const -4242  i32.eq
+		if
+			i32.const 4  local.get $lhs  local.get $rhs  call $err  unreachable
+		end
+		local.get $code  i32.const -1010101  i32.eq
+		if
+			i32.const 0  local.get $lhs  local.get $rhs  call $err  unreachable
+		end
+		i32.const 6  local.get $lhs  local.get $rhs  call $err  unreachable)
+
+	(func $force (param $v i32) (result i32) (local $fn i32)
+		block $done
+			loop $again
+				local.get $v  i32.load  i32.const 1  i32.ne  br_if $done
+				local.get $v  i64.load offset=8  i32.wrap_i64  local.tee $fn  i32.const 0  i32.lt_s  br_if $done
+				global.get $def_nargs  local.get $fn  i32.const 4  i32.mul  i32.add  i32.load  br_if $done
+				i32.const 0  local.get $fn  call_indirect (type $def)  local.set $v
+				br $again
+			end
+		end
+		local.get $v)
+
+	(func $apply (param $callee i32) (param $nargs i32) (param $args i32) (result i32)
+		(local $fn i32) (local $have i32) (local $arity i32) (local $usage i32) (local $clo i32)
+		(local $n i32) (local $i i32) (local $arg i32) (local $val i32) (local $result i32)
+		loop $again
+			local.get $callee  call $force  local.set $callee
+			local.get $nargs  i32.eqz
+			if
+				local.get $callee  return
+			end
+			local.get $callee  i32.load  i32.const 1  i32.sub  i32.const 1  i32.gt_u
+			if
+				i32.const 2  local.get $callee  i32.const 0  call $err  unreachable
+			end
+			local.get $callee  i64.load offset=8  i32.wrap_i64  local.set $fn
+			local.get $callee  i32.load offset=4  local.set $have
+			i32.const 2  local.set $arity
+			i32.const 0  local.set $usage
+			local.get $fn  i32.const 0  i32.ge_s
+			if
+				global.get $def_nargs  local.get $fn  i32.const 4  i32.mul  i32.add  i32.load  local.set $arity
+				global.get $def_usage_offs  local.get $fn  i32.const 4  i32.mul  i32.add  i32.load
+				i32.const 4  i32.mul  global.get $def_usage  i32.add  local.set $usage
+				;; a selector: as in the interpreter, pass on the selected args without evaluating any
+				global.get $def_nsels  local.get $fn  i32.const 4  i32.mul  i32.add  i32.load  local.tee $n  i32.const 0  i32.gt_s
+				local.get $have  local.get $nargs  i32.add  local.get $arity  i32.ge_s  i32.and
+				if
+					local.get $callee  local.get $nargs  local.get $args  local.get $fn  local.get $arity  call $select  local.set $args
+					local.get $n  local.get $have  local.get $nargs  i32.add  local.get $arity  i32.sub  i32.add  i32.const 1  i32.sub  local.set $nargs
+					local.get $args  call $arg_val  local.set $callee
+					local.get $args  i32.const 12  i32.add  local.set $args
+					br $again
+				end
+			end
+			;; the new closure (if still not saturated), else its args become the callee's args
+			i32.const 2  local.get $arity  local.get $fn  i64.extend_i32_s  call $cell  local.set $clo
+			i32.const 0  local.set $i
+			block $copied
+				loop $copy
+					local.get $i  local.get $have  i32.ge_s  br_if $copied
+					local.get $clo  local.get $i  i32.const 4  i32.mul  i32.add
+					local.get $callee  local.get $i  i32.const 4  i32.mul  i32.add  i32.load offset=16
+					i32.store offset=16
+					local.get $i  i32.const 1  i32.add  local.set $i
+					br $copy
+				end
+			end
+			local.get $arity  local.get $have  i32.sub  local.set $n
+			i32.const 0  local.set $i
+			block $filled
+				loop $fill
+					local.get $i  local.get $n  i32.ge_s  br_if $filled
+					local.get $i  local.get $nargs  i32.ge_s  br_if $filled
+					local.get $args  local.get $i  i32.const 12  i32.mul  i32.add  local.set $arg
+					i32.const 0  local.set $val
+					block $got
+						local.get $usage
+						if
+							local.get $usage  local.get $have  local.get $i  i32.add  i32.const 4  i32.mul  i32.add  i32.load
+							i32.eqz  br_if $got ;; unused by the callee, so never evaluated
+						end
+						local.get $arg  call $arg_val  local.set $val
+					end
+					local.get $clo  local.get $have  local.get $i  i32.add  i32.const 4  i32.mul  i32.add  local.get $val  i32.store offset=16
+					local.get $i  i32.const 1  i32.add  local.set $i
+					br $fill
+				end
+			end
+			local.get $nargs  local.get $n  i32.lt_s
+			if
+				local.get $clo  local.get $have  local.get $nargs  i32.add  i32.store offset=4
+				local.get $clo  return
+			end
+			local.get $fn  i32.const 0  i32.lt_s
+			if (result i32)
+				local.get $fn  local.get $clo  i32.load offset=16  local.get $clo  i32.load offset=20  call $op
+			else
+				local.get $clo  i32.const 16  i32.add  local.get $fn  call_indirect (type $def)
+			end
+			local.set $result
+			local.get $args  local.get $n  i32.const 12  i32.mul  i32.add  local.set $args
+			local.get $nargs  local.get $n  i32.sub  local.tee $nargs  i32.eqz
+			if
+				local.get $result  return
+			end
+			local.get $result  local.set $callee
+			br $again
+		end
+		unreachable)
+
+	;; arg_val returns the value of the apply arg entry at $arg, evaluating its thunk if any.
+	(func $arg_val (param $arg i32) (result i32)
+		local.get $arg  i32.load offset=4  i32.const -1  i32.eq
+		if
+			local.get $arg  i32.load  return
+		end
+		local.get $arg  i32.load offset=8  local.get $arg  i32.load offset=4  call_indirect (type $def))
+
+	;; select returns new apply arg entries for a selector call of (closure or func-ref) $callee with
+	;; $nargs entries at $args: first its selected callee, then its selected args, then any excess ones.
+	(func $select (param $callee i32) (param $nargs i32) (param $args i32) (param $fn i32) (param $arity i32) (result i32)
+		(local $have i32) (local $given i32) (local $sel i32) (local $nsel i32) (local $ret i32) (local $i i32)
+		local.get $callee  i32.load offset=4  local.set $have
+		local.get $have  local.get $nargs  i32.add  i32.const 12  i32.mul  call $alloc  local.set $given
+		block $copied
+			loop $copy
+				local.get $i  local.get $have  local.get $nargs  i32.add  i32.ge_s  br_if $copied
+				local.get $i  local.get $have  i32.lt_s
+				if
+					local.get $given  local.get $i  i32.const 12  i32.mul  i32.add
+					local.get $callee  local.get $i  i32.const 4  i32.mul  i32.add  i32.load offset=16  i32.store
+					local.get $given  local.get $i  i32.const 12  i32.mul  i32.add  i32.const -1  i32.store offset=4
+				else
+					local.get $given  local.get $i  i32.const 12  i32.mul  i32.add
+					local.get $args  local.get $i  local.get $have  i32.sub  i32.const 12  i32.mul  i32.add  call $arg_copy
+				end
+				local.get $i  i32.const 1  i32.add  local.set $i
+				br $copy
+			end
+		end
+		global.get $def_nsels  local.get $fn  i32.const 4  i32.mul  i32.add  i32.load  local.set $nsel
+		global.get $def_sels_offs  local.get $fn  i32.const 4  i32.mul  i32.add  i32.load
+		i32.const 4  i32.mul  global.get $def_sels  i32.add  local.set $sel
+		local.get $nsel  local.get $have  i32.add  local.get $nargs  i32.add  local.get $arity  i32.sub  i32.const 12  i32.mul  call $alloc  local.set $ret
+		i32.const 0  local.set $i
+		block $selected
+			loop $next
+				local.get $i  local.get $nsel  i32.ge_s  br_if $selected
+				local.get $ret  local.get $i  i32.const 12  i32.mul  i32.add
+				local.get $given  local.get $sel  local.get $i  i32.const 4  i32.mul  i32.add  i32.load  i32.const 12  i32.mul  i32.add  call $arg_copy
+				local.get $i  i32.const 1  i32.add  local.set $i
+				br $next
+			end
+		end
+		block $rested
+			loop $rest
+				local.get $i  local.get $nsel  i32.sub  local.get $arity  i32.add  local.get $have  local.get $nargs  i32.add  i32.ge_s  br_if $rested
+				local.get $ret  local.get $i  i32.const 12  i32.mul  i32.add
+				local.get $given  local.get $i  local.get $nsel  i32.sub  local.get $arity  i32.add  i32.const 12  i32.mul  i32.add  call $arg_copy
+				local.get $i  i32.const 1  i32.add  local.set $i
+				br $rest
+			end
+		end
+		local.get $ret)
+
+	(func $arg_copy (param $dst i32) (param $src i32)
+		local.get $dst  local.get $src  i32.load  i32.store
+		local.get $dst  local.get $src  i32.load offset=4  i32.store offset=4
+		local.get $dst  local.get $src  i32.load offset=8  i32.store offset=8)
+
+	(func $apply2 (param $callee i32) (param $arg0 i32) (param $arg1 i32) (result i32) (local $args i32)
+		i32.const 24  call $alloc  local.tee $args  local.get $arg0  i32.store
+		local.get $args  i32.const -1  i32.store offset=4
+		local.get $args  local.get $arg1  i32.store offset=12
+		local.get $args  i32.const -1  i32.store offset=16
+		local.get $callee  i32.const 2  local.get $args  call $apply  call $force)
+
+	(func $main (param $args i32) (param $env i32) (result i32)
+		global.get $num_defs  i32.const 1  i32.sub  call $mkfn  local.get $args  local.get $env  call $apply2)
+
+	(func $list_end (result i32)
+		i32.const 3  call $mkfn)
+
+	(func $list_link (param $head i32) (param $tail i32) (result i32) (local $ret i32)
+		i32.const 2  i32.const 2  i64.const 4  call $cell  local.tee $ret  local.get $head  i32.store offset=16
+		local.get $ret  local.get $tail  i32.store offset=20
+		local.get $ret)
+
+	(func $list_from (param $ptr i32) (param $len i32) (result i32) (local $ret i32)
+		call $list_end  local.set $ret
+		block $done
+			loop $next
+				local.get $len  i32.eqz  br_if $done
+				local.get $len  i32.const 1  i32.sub  local.set $len
+				local.get $ptr  local.get $len  i32.add  i32.load8_u  i64.extend_i32_u  call $mknum
+				local.get $ret  call $list_link  local.set $ret
+				br $next
+			end
+		end
+		local.get $ret)
+`
+
+// watExports are all the runtime funcs exported to hosts, in addition to the `memory`.
+var watExports = []string{"main", "apply2", "alloc", "list_end", "list_link", "list_from"}
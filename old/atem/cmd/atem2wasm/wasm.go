@@ -0,0 +1,368 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// assemble translates WAT into the WebAssembly binary format. It only covers
+// the subset that `compile` emits: named funcs, globals and labels, flat
+// (non-folded) instructions, and at most one each of memory, table, elem
+// and data segment.
+func assemble(watSrc string) []byte {
+	me := wasmAsm{names: map[string]int{}, types: map[string]int{}}
+	module := parseSexprs(watSrc)
+	if len(module) != 1 || len(module[0].list) == 0 || module[0].list[0].atom != "module" {
+		panic("expected a single (module ...)")
+	}
+	fields := module[0].list[1:]
+	for _, field := range fields { // first pass: all index spaces, so that all names resolve in the second
+		switch kind := field.list[0].atom; kind {
+		case "type":
+			me.names["type"+field.list[1].atom] = me.typeIdx(field.list[2].list[1:])
+		case "import":
+			me.names["func"+field.list[3].list[1].atom] = me.numFuncs
+			me.numFuncs++
+		case "func":
+			me.names["func"+field.list[1].atom] = me.numFuncs
+			me.numFuncs++
+		case "global":
+			me.names["global"+field.list[1].atom] = me.numGlobals
+			me.numGlobals++
+		case "memory", "table":
+			me.names[kind+field.list[1].atom] = 0
+		}
+	}
+
+	var secimport, secfunc, sectable, secmem, secglobal, secexport, secelem, seccode, secdata wasmVec
+	for _, field := range fields {
+		switch field.list[0].atom {
+		case "import":
+			fn := field.list[3].list
+			secimport.add(wasmStr(unquote(field.list[1].atom)), wasmStr(unquote(field.list[2].atom)), []byte{0}, uleb(me.funcSig(fn[2:], nil)))
+		case "func":
+			locals := map[string]int{}
+			secfunc.add(uleb(me.funcSig(field.list[2:], locals)))
+			seccode.add(wasmSized(me.funcBody(field.list[2:], locals)))
+		case "table":
+			sectable.add([]byte{0x70, 0}, uleb(me.num(field.list[2])))
+		case "memory":
+			secmem.add([]byte{0}, uleb(me.num(field.list[2])))
+		case "global":
+			valtype, mut := field.list[2], byte(0)
+			if valtype.list != nil {
+				valtype, mut = valtype.list[1], 1
+			}
+			secglobal.add([]byte{wasmValType(valtype.atom), mut}, me.constExpr(field.list[3]))
+		case "export":
+			kind := field.list[2].list[0].atom
+			secexport.add(wasmStr(unquote(field.list[1].atom)), []byte{map[string]byte{"func": 0, "table": 1, "memory": 2, "global": 3}[kind]}, uleb(me.names[kind+field.list[2].list[1].atom]))
+		case "elem":
+			var funcs wasmVec
+			for _, name := range field.list[2:] {
+				funcs.add(uleb(me.names["func"+name.atom]))
+			}
+			secelem.add([]byte{0}, me.constExpr(field.list[1]), funcs.bytes())
+		case "data":
+			var data []byte
+			for _, str := range field.list[2:] {
+				data = append(data, unquote(str.atom)...)
+			}
+			secdata.add([]byte{0}, me.constExpr(field.list[1]), wasmStr(string(data)))
+		}
+	}
+
+	ret := []byte{0, 'a', 's', 'm', 1, 0, 0, 0}
+	for i, sec := range []*wasmVec{&me.sectype, &secimport, &secfunc, &sectable, &secmem, &secglobal, &secexport, nil, &secelem, &seccode, &secdata} {
+		if sec != nil && sec.n > 0 {
+			ret = append(append(ret, byte(i+1)), wasmSized(sec.bytes())...)
+		}
+	}
+	return ret
+}
+
+type wasmAsm struct {
+	names                map[string]int // keyed by index space ("func", "global", "type" etc.) plus $name
+	types                map[string]int // keyed by func-type encoding
+	sectype              wasmVec
+	numFuncs, numGlobals int
+}
+
+// funcSig interns the func type of the `(param ...)` and `(result ...)` clauses
+// (or the `(type $name)` clause) at the start of `clauses`, recording param names into `locals` if not `nil`.
+func (me *wasmAsm) funcSig(clauses []*sexpr, locals map[string]int) int {
+	var sig []*sexpr
+	for _, clause := range clauses {
+		if clause.list == nil || (clause.list[0].atom != "param" && clause.list[0].atom != "result" && clause.list[0].atom != "type") {
+			break
+		} else if clause.list[0].atom == "type" {
+			return me.names["type"+clause.list[1].atom]
+		} else if clause.list[0].atom == "param" && len(clause.list) == 3 && strings.HasPrefix(clause.list[1].atom, "$") {
+			if locals != nil {
+				locals[clause.list[1].atom] = len(locals)
+			}
+			sig = append(sig, &sexpr{list: []*sexpr{clause.list[0], clause.list[2]}})
+		} else {
+			for i := 1; locals != nil && clause.list[0].atom == "param" && i < len(clause.list); i++ {
+				locals[strconv.Itoa(len(locals))] = len(locals)
+			}
+			sig = append(sig, clause)
+		}
+	}
+	return me.typeIdx(sig)
+}
+
+func (me *wasmAsm) typeIdx(sig []*sexpr) int {
+	var params, results []byte
+	for _, clause := range sig {
+		for _, valtype := range clause.list[1:] {
+			if clause.list[0].atom == "param" {
+				params = append(params, wasmValType(valtype.atom))
+			} else {
+				results = append(results, wasmValType(valtype.atom))
+			}
+		}
+	}
+	enc := string(append(append(append(append([]byte{0x60}, uleb(len(params))...), params...), uleb(len(results))...), results...))
+	idx, exists := me.types[enc]
+	if !exists {
+		idx = len(me.types)
+		me.types[enc] = idx
+		me.sectype.add([]byte(enc))
+	}
+	return idx
+}
+
+func (me *wasmAsm) funcBody(clauses []*sexpr, locals map[string]int) []byte {
+	var localdecls wasmVec
+	for len(clauses) > 0 && clauses[0].list != nil {
+		if clause := clauses[0].list; clause[0].atom == "local" {
+			if len(clause) == 3 && strings.HasPrefix(clause[1].atom, "$") {
+				locals[clause[1].atom] = len(locals)
+				clause = []*sexpr{clause[0], clause[2]}
+			} else {
+				for range clause[1:] {
+					locals[strconv.Itoa(len(locals))] = len(locals)
+				}
+			}
+			for _, valtype := range clause[1:] {
+				localdecls.add(uleb(1), []byte{wasmValType(valtype.atom)})
+			}
+		}
+		clauses = clauses[1:]
+	}
+
+	code, labels := localdecls.bytes(), []string{}
+	for i := 0; i < len(clauses); i++ {
+		instr := clauses[i].atom
+		op, known := wasmOps[instr]
+		if !known {
+			panic("unsupported instruction: " + instr)
+		}
+		code = append(code, op.code)
+		switch op.imm {
+		case immLocal:
+			i++
+			code = append(code, uleb(me.idx(locals, "", clauses[i].atom))...)
+		case immGlobal, immFunc:
+			i++
+			code = append(code, uleb(me.idx(me.names, map[int]string{immGlobal: "global", immFunc: "func"}[op.imm], clauses[i].atom))...)
+		case immLabel:
+			i++
+			depth, err := strconv.Atoi(clauses[i].atom)
+			for l := len(labels) - 1; err != nil && l >= 0; l-- {
+				if labels[l] == clauses[i].atom {
+					depth, err = len(labels)-1-l, nil
+				}
+			}
+			if err != nil {
+				panic("unknown label: " + clauses[i].atom)
+			}
+			code = append(code, uleb(depth)...)
+		case immI32, immI64:
+			i++
+			code = append(code, sleb(int64(me.num(clauses[i])))...)
+		case immMem:
+			offset := 0
+			if i+1 < len(clauses) && strings.HasPrefix(clauses[i+1].atom, "offset=") {
+				i++
+				offset = me.num(&sexpr{atom: strings.TrimPrefix(clauses[i].atom, "offset=")})
+			}
+			code = append(append(code, op.align), uleb(offset)...)
+		case immBlock:
+			label, blocktype := "", byte(0x40)
+			if i+1 < len(clauses) && strings.HasPrefix(clauses[i+1].atom, "$") {
+				i, label = i+1, clauses[i+1].atom
+			}
+			if i+1 < len(clauses) && clauses[i+1].list != nil {
+				i, blocktype = i+1, wasmValType(clauses[i+1].list[1].atom)
+			}
+			code, labels = append(code, blocktype), append(labels, label)
+		case immEnd:
+			labels = labels[:len(labels)-1]
+		case immCallIndirect:
+			i++
+			code = append(append(code, uleb(me.names["type"+clauses[i].list[1].atom])...), 0)
+		case immMemIdx:
+			code = append(code, 0)
+		}
+	}
+	return append(code, 0x0b)
+}
+
+func (me *wasmAsm) idx(names map[string]int, space string, name string) int {
+	if idx, err := strconv.Atoi(name); err == nil {
+		return idx
+	} else if idx, exists := names[space+name]; exists {
+		return idx
+	}
+	panic("unknown name: " + name)
+}
+
+func (me *wasmAsm) num(atom *sexpr) int {
+	n, err := strconv.Atoi(atom.atom)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func (me *wasmAsm) constExpr(expr *sexpr) []byte {
+	return append(append([]byte{wasmOps[expr.list[0].atom].code}, sleb(int64(me.num(expr.list[1])))...), 0x0b)
+}
+
+const (
+	immNone = iota
+	immLocal
+	immGlobal
+	immFunc
+	immLabel
+	immI32
+	immI64
+	immMem
+	immBlock
+	immEnd
+	immCallIndirect
+	immMemIdx
+)
+
+var wasmOps = map[string]struct {
+	code  byte
+	imm   int
+	align byte
+}{
+	"unreachable": {0x00, immNone, 0}, "block": {0x02, immBlock, 0}, "loop": {0x03, immBlock, 0}, "if": {0x04, immBlock, 0}, "else": {0x05, immNone, 0}, "end": {0x0b, immEnd, 0},
+	"br": {0x0c, immLabel, 0}, "br_if": {0x0d, immLabel, 0}, "return": {0x0f, immNone, 0}, "call": {0x10, immFunc, 0}, "call_indirect": {0x11, immCallIndirect, 0},
+	"drop": {0x1a, immNone, 0}, "select": {0x1b, immNone, 0},
+	"local.get": {0x20, immLocal, 0}, "local.set": {0x21, immLocal, 0}, "local.tee": {0x22, immLocal, 0}, "global.get": {0x23, immGlobal, 0}, "global.set": {0x24, immGlobal, 0},
+	"i32.load": {0x28, immMem, 2}, "i64.load": {0x29, immMem, 3}, "i32.load8_u": {0x2d, immMem, 0}, "i32.store": {0x36, immMem, 2}, "i64.store": {0x37, immMem, 3}, "i32.store8": {0x3a, immMem, 0},
+	"memory.size": {0x3f, immMemIdx, 0}, "memory.grow": {0x40, immMemIdx, 0}, "i32.const": {0x41, immI32, 0}, "i64.const": {0x42, immI64, 0},
+	"i32.eqz": {0x45, immNone, 0}, "i32.eq": {0x46, immNone, 0}, "i32.ne": {0x47, immNone, 0}, "i32.lt_s": {0x48, immNone, 0}, "i32.lt_u": {0x49, immNone, 0}, "i32.gt_s": {0x4a, immNone, 0},
+	"i32.gt_u": {0x4b, immNone, 0}, "i32.le_s": {0x4c, immNone, 0}, "i32.le_u": {0x4d, immNone, 0}, "i32.ge_s": {0x4e, immNone, 0}, "i32.ge_u": {0x4f, immNone, 0},
+	"i64.eqz": {0x50, immNone, 0}, "i64.eq": {0x51, immNone, 0}, "i64.ne": {0x52, immNone, 0}, "i64.lt_s": {0x53, immNone, 0}, "i64.gt_s": {0x55, immNone, 0}, "i64.le_s": {0x57, immNone, 0}, "i64.ge_s": {0x59, immNone, 0},
+	"i32.add": {0x6a, immNone, 0}, "i32.sub": {0x6b, immNone, 0}, "i32.mul": {0x6c, immNone, 0}, "i32.and": {0x71, immNone, 0}, "i32.or": {0x72, immNone, 0}, "i32.shl": {0x74, immNone, 0}, "i32.shr_u": {0x76, immNone, 0},
+	"i64.add": {0x7c, immNone, 0}, "i64.sub": {0x7d, immNone, 0}, "i64.mul": {0x7e, immNone, 0}, "i64.div_s": {0x7f, immNone, 0}, "i64.rem_s": {0x81, immNone, 0},
+	"i32.wrap_i64": {0xa7, immNone, 0}, "i64.extend_i32_s": {0xac, immNone, 0}, "i64.extend_i32_u": {0xad, immNone, 0},
+}
+
+func wasmValType(name string) byte {
+	switch name {
+	case "i32":
+		return 0x7f
+	case "i64":
+		return 0x7e
+	}
+	panic("unsupported value type: " + name)
+}
+
+type wasmVec struct {
+	n   int
+	buf []byte
+}
+
+func (me *wasmVec) add(items ...[]byte) {
+	me.n++
+	for _, item := range items {
+		me.buf = append(me.buf, item...)
+	}
+}
+
+func (me *wasmVec) bytes() []byte { return append(uleb(me.n), me.buf...) }
+
+func wasmSized(content []byte) []byte { return append(uleb(len(content)), content...) }
+
+func wasmStr(s string) []byte { return wasmSized([]byte(s)) }
+
+func uleb(n int) (ret []byte) {
+	for u := uint32(n); ; {
+		b := byte(u & 0x7f)
+		if u >>= 7; u == 0 {
+			return append(ret, b)
+		}
+		ret = append(ret, b|0x80)
+	}
+}
+
+func sleb(n int64) (ret []byte) {
+	for {
+		b := byte(n & 0x7f)
+		n >>= 7
+		if (n == 0 && b&0x40 == 0) || (n == -1 && b&0x40 != 0) {
+			return append(ret, b)
+		}
+		ret = append(ret, b|0x80)
+	}
+}
+
+// sexpr is either an `atom` (also for string literals, with their quotes) or a `list`.
+type sexpr struct {
+	atom string
+	list []*sexpr
+}
+
+func parseSexprs(src string) (ret []*sexpr) {
+	stack := []*sexpr{{list: []*sexpr{}}}
+	for i := 0; i < len(src); i++ {
+		cur := stack[len(stack)-1]
+		switch c := src[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		case c == ';' && i+1 < len(src) && src[i+1] == ';':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == '(':
+			list := &sexpr{list: []*sexpr{}}
+			cur.list, stack = append(cur.list, list), append(stack, list)
+		case c == ')':
+			stack = stack[:len(stack)-1]
+		default:
+			start := i
+			for ; i < len(src) && (c == '"' || !strings.ContainsRune(" \t\r\n()", rune(src[i]))); i++ {
+				if c == '"' && i > start && src[i] == '"' { // no `\"` escapes in `unquote`-able strings
+					break
+				}
+			}
+			if c != '"' {
+				i--
+			}
+			cur.list = append(cur.list, &sexpr{atom: src[start : i+1]})
+		}
+	}
+	return stack[0].list
+}
+
+// unquote decodes a WAT string literal, which `compile` only ever emits with `\hh` escapes.
+func unquote(str string) string {
+	var buf strings.Builder
+	for i := 1; i < len(str)-1; i++ {
+		if str[i] != '\\' {
+			buf.WriteByte(str[i])
+		} else if b, err := strconv.ParseUint(str[i+1:i+3], 16, 8); err == nil {
+			buf.WriteByte(byte(b))
+			i += 2
+		} else {
+			panic(str)
+		}
+	}
+	return buf.String()
+}
@@ -11,6 +11,9 @@ import (
 
 var prog Prog
 
+// reads a `Prog` from stdin and writes its optimized form to stdout. if a
+// file path is given as the first arg, a provenance sidecar JSON file is
+// written to it, see `provenance` for details.
 func main() {
 	src, err := ioutil.ReadAll(os.Stdin)
 	if err == nil {
@@ -20,6 +23,9 @@ func main() {
 		}
 		{
 			prefixNameMetasWithIdxs()
+			if len(os.Args) > 1 {
+				provInit()
+			}
 			for again := true; again; {
 				again = false
 				fixFuncDefArgsUsageNumbers()
@@ -34,13 +40,17 @@ func main() {
 					rewrite_primOpPreCalcs,
 					rewrite_callsToGeqOrLeq,
 					rewrite_minifyNeedlesslyElaborateBoolOpCalls,
+					rewrite_ditchDeadBranches,
 					rewrite_inlineEverSameArgs,
+					rewrite_specializeCallsWithConstArgs,
 					rewrite_inlineOnceCalleds,
 					rewrite_preEvalArgRefLessCalls,
 					rewrite_inlineNullaries,
 					rewrite_commonSubExprs,
 				} {
+					snapshot := provSnapshot()
 					if prog, again = mayberewrite(prog); again {
+						provTouched(snapshot, mayberewrite)
 						break
 					}
 				}
@@ -50,7 +60,9 @@ func main() {
 		for i := range prog {
 			prog[i].Body = convTo(prog[i].Body)
 		}
-		_, err = os.Stdout.WriteString(prog.JsonSrc(false))
+		if _, err = os.Stdout.WriteString(prog.JsonSrc(false)); err == nil && len(os.Args) > 1 {
+			err = provWriteSidecarFile(os.Args[1])
+		}
 	}
 	if err != nil {
 		panic(err)
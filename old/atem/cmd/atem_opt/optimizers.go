@@ -1,6 +1,9 @@
 package main
 
 import (
+	"strconv"
+	"strings"
+
 	. "github.com/metaleap/atmo/old/atem"
 )
 
@@ -54,6 +57,7 @@ func rewrite_ditchDuplicateDefs(src Prog) (ret Prog, didModify bool) {
 			if fnref, ok := expr.(ExprFuncRef); ok {
 				if orig, have := dupls[fnref]; have {
 					didModify = true
+					provDerive(ret, orig, fnref)
 					return orig
 				}
 			}
@@ -98,6 +102,7 @@ func rewrite_inlineNaryFuncAliases(src Prog) (ret Prog, didModify bool) {
 			if fnref, ok := expr.(ExprFuncRef); ok {
 				if numrefs, is := aliasdefs[fnref]; is && numrefs == 1 {
 					didModify, expr = true, ret[fnref].Body
+					provDerive(ret, ExprFuncRef(i), fnref)
 					for i := 0; i < len(ret[fnref].Args); i++ {
 						expr = exprAppl{Callee: StdFuncTrue, Arg: expr}
 					}
@@ -167,6 +172,7 @@ func rewrite_inlineNullaries(src Prog) (ret Prog, didModify bool) {
 			if fnref, _ := expr.(ExprFuncRef); fnref > StdFuncCons {
 				if _, isnullary := descs[int(fnref)]; isnullary {
 					retexpr := ret[int(fnref)].Body
+					provDerive(ret, ExprFuncRef(i), fnref)
 					didModify = didModify || !eq(expr, retexpr)
 					return retexpr
 				}
@@ -252,6 +258,7 @@ func rewrite_inlineOnceCalleds(src Prog) (ret Prog, didModify bool) {
 								}
 							}
 							if could {
+								provDerive(ret, referencer, fn)
 								didModify, expr = true, walk(walk(ret[fn].Body, func(it Expr) Expr {
 									if argref, is := it.(ExprArgRef); is {
 										return exprTmp(argref)
@@ -296,6 +303,7 @@ func rewrite_inlineArgCallers(src Prog) (ret Prog, didModify bool) {
 					if didModify = true; argref != 0 {
 						panic("TODO")
 					} else {
+						provDerive(ret, ExprFuncRef(i), *fnref)
 						call2inline := rewriteInnerMostCallee(ret[*fnref].Body.(exprAppl), func(Expr) Expr { return allargs[0] })
 						expr = rewriteInnerMostCallee(expr.(exprAppl), func(Expr) Expr { return StdFuncId })
 						expr = rewriteCallArgs(expr.(exprAppl), numargs, func(int, Expr) Expr {
@@ -384,6 +392,7 @@ func rewrite_inlineArgsRearrangers(src Prog) (ret Prog, didModify bool) {
 					}
 					// else, done
 					expr, didModify = nuexpr, true
+					provDerive(ret, ExprFuncRef(i), *fnref)
 				}
 			}
 			return expr
@@ -426,6 +435,40 @@ func rewrite_minifyNeedlesslyElaborateBoolOpCalls(src Prog) (ret Prog, didModify
 	return
 }
 
+// from `cond then else` to `then` or `else` whenever `cond` is `StdFuncTrue` / `StdFuncFalse` or an `OpEq` / `OpLt` /
+// `OpGt` call on two num literals: so unlike `rewrite_preEvalArgRefLessCalls`, never evaluating any `FuncDef`s
+// at optimization time, whose calls might well not terminate. any extra args following `then else` are retained
+func rewrite_ditchDeadBranches(src Prog) (ret Prog, didModify bool) {
+	ret = src
+	for i := int(StdFuncCons + 1); i < len(ret); i++ {
+		ret[i].Body = walk(ret[i].Body, func(expr Expr) Expr {
+			if _, fnref, numargs, _, _, allargs := dissectCall(expr, nil); fnref != nil && numargs >= 2 {
+				numcondargs, cond := 0, *fnref
+				if opcode := OpCode(*fnref); opcode == OpEq || opcode == OpLt || opcode == OpGt {
+					lhs, okl := allargs[0].(ExprNumInt)
+					rhs, okr := allargs[1].(ExprNumInt)
+					if numcondargs = 2; numargs < 4 || !(okl && okr) {
+						return expr
+					}
+					if cond = StdFuncFalse; (opcode == OpEq && lhs == rhs) || (opcode == OpLt && lhs < rhs) || (opcode == OpGt && lhs > rhs) {
+						cond = StdFuncTrue
+					}
+				}
+				if cond == StdFuncTrue || cond == StdFuncFalse {
+					if didModify, expr = true, allargs[numcondargs]; cond == StdFuncFalse {
+						expr = allargs[numcondargs+1]
+					}
+					for _, arg := range allargs[numcondargs+2:] {
+						expr = exprAppl{Callee: expr, Arg: arg}
+					}
+				}
+			}
+			return expr
+		})
+	}
+	return
+}
+
 // ie. from foo>=1 to foo>0, 2<=foo to 1<foo etc.
 func rewrite_callsToGeqOrLeq(src Prog) (ret Prog, didModify bool) {
 	ret = src
@@ -624,14 +667,10 @@ func rewrite_inlineEverSameArgs(src Prog) (ret Prog, didModify bool) {
 	return
 }
 
-// rewrites all calls with no arg-refs and no `OpPrt`s with their `Eval` result
+// rewrites all calls with no arg-refs and no `OpPrt`s or `OpErr`s with their `Eval` result
 func rewrite_preEvalArgRefLessCalls(src Prog) (ret Prog, didModify bool) {
 	ret = src
-	conv := make([]FuncDef, len(ret))
-	copy(conv, ret)
-	for i := range conv {
-		conv[i].Body = convTo(conv[i].Body)
-	}
+	conv := convProgTo(ret)
 	for i := int(StdFuncCons + 1); i < len(conv); i++ {
 		var didmodify bool
 		conv[i].Body = walkInPostOrder(conv[i].Body, func(expr Expr) Expr {
@@ -697,3 +736,124 @@ func rewrite_commonSubExprs(src Prog) (ret Prog, didModify bool) {
 	}
 	return
 }
+
+// partial evaluation: for saturated calls supplying `ExprNumInt` / `ExprFuncRef` consts to used args, a clone of
+// the callee is created per distinct combination of such const args (within the `specialize*` budgets), with those
+// args dropped and their consts substituted into the clone's body, then pre-simplified. call sites get rewritten to it
+func rewrite_specializeCallsWithConstArgs(src Prog) (ret Prog, didModify bool) {
+	ret = src
+	specs, numspecs := map[string]ExprFuncRef{}, map[string]int{}
+	for i := StdFuncCons + 1; int(i) < len(ret)-1; i++ {
+		if name := defName(ret, i); strings.Contains(name, "//spec:") {
+			origname := name[:strings.Index(name, "//spec:")]
+			specs[name], numspecs[origname] = i, 1+numspecs[origname]
+		}
+	}
+	var fn ExprFuncRef
+	var consts map[int]Expr
+	var origname, specname string
+	for i := StdFuncCons + 1; int(i) < len(ret) && consts == nil; i++ {
+		_ = walk(ret[i].Body, func(expr Expr) Expr {
+			if consts == nil {
+				if fn, consts, specname = specializableCall(ret, expr); consts != nil {
+					origname = specname[:strings.Index(specname, "//spec:")]
+					if _, have := specs[specname]; !(have || numspecs[origname] < specializeMaxClonesPerFunc) {
+						consts = nil
+					}
+				}
+			}
+			return expr
+		})
+	}
+	if consts == nil {
+		return
+	}
+	specfn, have := specs[specname]
+	if !have {
+		specfn, ret = ExprFuncRef(len(ret)-1), specializedClone(ret, fn, consts, specname)
+	}
+	for i := StdFuncCons + 1; int(i) < len(ret); i++ {
+		ret[i].Body = walk(ret[i].Body, func(expr Expr) Expr {
+			if _, _, name := specializableCall(ret, expr); name == specname {
+				_, _, _, _, _, allargs := dissectCall(expr, nil)
+				didModify, expr = true, specfn
+				for aidx, arg := range allargs {
+					if _, isconst := consts[aidx]; !isconst {
+						expr = exprAppl{Callee: expr, Arg: arg}
+					}
+				}
+			}
+			return expr
+		})
+	}
+	return
+}
+
+// specializableCall returns non-`nil` `consts` if `expr` is a saturated call to a (non-std, non-main, not itself
+// specialized) def small enough for `rewrite_specializeCallsWithConstArgs`, with at least one const arg to a used param
+func specializableCall(prog Prog, expr Expr) (fn ExprFuncRef, consts map[int]Expr, specName string) {
+	_, fnref, _, _, _, allargs := dissectCall(expr, nil)
+	if fnref == nil || *fnref <= StdFuncCons || int(*fnref) >= len(prog)-1 || len(allargs) != len(prog[*fnref].Args) ||
+		strings.Contains(prog[*fnref].Meta[0], "//spec:") || exprSize(prog[*fnref].Body) > specializeMaxBodySize {
+		return
+	}
+	fn, specName = *fnref, defName(prog, *fnref)+"//spec:"
+	for aidx, arg := range allargs {
+		_, isnum := arg.(ExprNumInt)
+		if argfn, isfn := arg.(ExprFuncRef); (isnum || isfn) && prog[fn].Args[aidx] > 0 {
+			if consts == nil {
+				consts = make(map[int]Expr, len(allargs))
+			} else {
+				specName += ","
+			}
+			if consts[aidx], specName = arg, specName+strconv.Itoa(aidx)+"="; isnum || argfn < 0 {
+				specName += arg.JsonSrc()
+			} else { // by name, not index: the latter will shift as defs get ditched
+				specName += "{" + defName(prog, argfn) + "}"
+			}
+		}
+	}
+	return
+}
+
+// specializedClone inserts (right before main, whose refs get fixed up) a copy of the `fn` def with all args in `consts` dropped
+func specializedClone(prog Prog, fn ExprFuncRef, consts map[int]Expr, name string) Prog {
+	clone, argidxs := FuncDef{Meta: []string{"[]" + name}, Args: []int{}}, make(map[int]int, len(prog[fn].Args))
+	for aidx, argusage := range prog[fn].Args {
+		if _, isconst := consts[aidx]; !isconst {
+			argidxs[aidx], clone.Args = len(clone.Args), append(clone.Args, argusage)
+			if len(prog[fn].Meta) == 1+len(prog[fn].Args) {
+				clone.Meta = append(clone.Meta, prog[fn].Meta[1+aidx])
+			}
+		}
+	}
+	clone.Body = walk(prog[fn].Body, func(expr Expr) Expr {
+		if argref, is := expr.(ExprArgRef); is {
+			if aidx := int(-argref) - 2; consts[aidx] != nil {
+				return consts[aidx]
+			} else {
+				return ExprArgRef(-(argidxs[aidx] + 2))
+			}
+		}
+		return expr
+	})
+	for again, simplified := true, append(append(Prog{}, prog[:StdFuncCons+1]...), clone); again; {
+		if simplified, again = rewrite_primOpPreCalcs(simplified); !again {
+			simplified, again = rewrite_minifyNeedlesslyElaborateBoolOpCalls(simplified)
+		}
+		clone = simplified[len(simplified)-1]
+	}
+
+	oldmain, newmain := ExprFuncRef(len(prog)-1), ExprFuncRef(len(prog))
+	prog = append(prog[:oldmain], clone, prog[oldmain])
+	provDerive(prog, oldmain, fn)
+	for i := range prog {
+		prog[i].Body = walk(prog[i].Body, func(expr Expr) Expr {
+			if fnref, ok := expr.(ExprFuncRef); ok && fnref == oldmain {
+				return newmain
+			}
+			return expr
+		})
+	}
+	return prog
+}
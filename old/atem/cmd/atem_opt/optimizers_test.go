@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+// testProg loads a `Prog` of the `std` defs, a `[5]loop x` that never returns
+// and a nullary `main` with the given `mainBody`, in `atem_opt`'s working form.
+func testProg(mainBody string) Prog {
+	prog := LoadFromJson([]byte(`[ [ ["[0]std.same","it"], [1], "0" ]
+, [ ["[1]std.True","t","f"], [1,0], "0" ]
+, [ ["[2]std.False","t","f"], [0,1], "1" ]
+, [ ["[3]std.ListEnd","e","l"], [1,0], "0" ]
+, [ ["[4]std.ListLink","h","t","e","l"], [1,1,0,1], ["3", "0", "1"] ]
+, [ ["[5]loop","x"], [1], [[5], "0"] ]
+, [ ["main"], [], ` + mainBody + ` ]
+]`))
+	for i := range prog {
+		prog[i].Body = convFrom(prog[i].Body)
+	}
+	return prog
+}
+
+func TestDitchDeadBranches(t *testing.T) {
+	op := func(opcode OpCode) string { return "[" + strconv.Itoa(int(opcode)) + "]" }
+	for _, it := range []struct {
+		mainBody string
+		want     string // `JsonSrc` of the rewritten `main` body, if any
+	}{
+		{"[[1], 10, 20]", "10"},
+		{"[[2], 10, 20, 30]", "[20, 30]"},
+		{"[" + op(OpLt) + ", 1, 2, 10, 20]", "10"},
+		{"[" + op(OpGt) + ", 1, 2, [[0], 10], [[0], 20], 30]", "[[0], 20, 30]"},
+		{"[" + op(OpEq) + ", 3, 3, [[5], 1], 20]", "[[5], 1]"},
+		{"[" + op(OpLt) + ", 1, [[0], 2], 10, 20]", ""},           // not a num literal operand
+		{"[" + op(OpAdd) + ", 1, 2, 10, 20]", ""},                 // not a comparison
+		{"[[5], 1, 10, 20]", ""},                                  // would never terminate if pre-evaluated
+		{"[[0], [[5], 1], [[1], 10, 20]]", "[[0], [[5], 1], 10]"}, // also in nested calls
+	} {
+		prog := testProg(it.mainBody)
+		before := convTo(prog[len(prog)-1].Body).JsonSrc()
+		prog, didModify := rewrite_ditchDeadBranches(prog)
+		got := convTo(prog[len(prog)-1].Body).JsonSrc()
+		if it.want == "" && (didModify || got != before) {
+			t.Errorf("%s: expected no rewrite, got %s", it.mainBody, got)
+		} else if it.want != "" && (!didModify || got != it.want) {
+			t.Errorf("%s: expected %s, got %s", it.mainBody, it.want, got)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+// provenance records, per `FuncDef`, which input `FuncDef`s it was derived from
+// (itself, plus any inlined / merged / specialized-from others) and which
+// optimization passes modified it. `FuncDef`s are identified across passes via
+// their `&Meta[0]`, which remains stable throughout any moves, as all passes
+// only ever reslice `Prog`s but never re-allocate existing `FuncDef.Meta`s.
+type provenance struct {
+	Idx    int
+	Name   string
+	From   []provenanceOrigin
+	Passes []string
+}
+
+type provenanceOrigin struct {
+	Idx  int
+	Name string
+}
+
+var provs map[*string]*provenance // stays `nil` unless a sidecar file path was given
+
+func provInit() {
+	provs = make(map[*string]*provenance, len(prog))
+	for i := range prog {
+		if len(prog[i].Meta) > 0 {
+			provs[&prog[i].Meta[0]] = &provenance{Passes: []string{}, From: []provenanceOrigin{{Idx: i, Name: defName(prog, ExprFuncRef(i))}}}
+		}
+	}
+}
+
+func provOf(def *FuncDef) *provenance {
+	if provs == nil || len(def.Meta) == 0 {
+		return nil
+	}
+	p := provs[&def.Meta[0]]
+	if p == nil {
+		p = &provenance{Passes: []string{}}
+		provs[&def.Meta[0]] = p
+	}
+	return p
+}
+
+// provDerive notes that `dst` now (also) embodies `src`, eg. after inlining or merging the latter into the former.
+func provDerive(prog Prog, dst ExprFuncRef, src ExprFuncRef) {
+	if pdst, psrc := provOf(&prog[dst]), provOf(&prog[src]); pdst != nil && psrc != nil && pdst != psrc {
+		for _, origin := range psrc.From {
+			if !provHasOrigin(pdst, origin.Idx) {
+				pdst.From = append(pdst.From, origin)
+			}
+		}
+	}
+}
+
+func provHasOrigin(p *provenance, idx int) bool {
+	for _, origin := range p.From {
+		if origin.Idx == idx {
+			return true
+		}
+	}
+	return false
+}
+
+// provSnapshot captures all current bodies before a `rewrite_*` pass runs, for `provTouched` to compare against afterwards.
+func provSnapshot() map[*string]string {
+	if provs == nil {
+		return nil
+	}
+	snapshot := make(map[*string]string, len(prog))
+	for i := range prog {
+		if len(prog[i].Meta) > 0 {
+			snapshot[&prog[i].Meta[0]] = provBodySrc(prog[i].Body)
+		}
+	}
+	return snapshot
+}
+
+// provBodySrc renders func-refs by name, so that mere renumberings (as by `rewrite_ditchUnusedFuncDefs`) don't count as modifications.
+func provBodySrc(expr Expr) string {
+	switch it := expr.(type) {
+	case exprAppl:
+		return "(" + provBodySrc(it.Callee) + " " + provBodySrc(it.Arg) + ")"
+	case ExprFuncRef:
+		if it >= 0 && len(prog[it].Meta) > 0 {
+			return defName(prog, it)
+		}
+	}
+	return expr.JsonSrc()
+}
+
+func provTouched(snapshot map[*string]string, pass func(Prog) (Prog, bool)) {
+	if provs == nil {
+		return
+	}
+	passname := runtime.FuncForPC(reflect.ValueOf(pass).Pointer()).Name()
+	passname = strings.TrimPrefix(passname[strings.LastIndexByte(passname, '.')+1:], "rewrite_")
+	for i := range prog {
+		if len(prog[i].Meta) > 0 {
+			if before, existed := snapshot[&prog[i].Meta[0]]; (!existed) || before != provBodySrc(prog[i].Body) {
+				if p := provOf(&prog[i]); len(p.Passes) == 0 || p.Passes[len(p.Passes)-1] != passname {
+					p.Passes = append(p.Passes, passname)
+				}
+			}
+		}
+	}
+}
+
+func provWriteSidecarFile(filePath string) error {
+	out := make([]*provenance, 0, len(prog))
+	for i := range prog {
+		if p := provOf(&prog[i]); p != nil {
+			p.Idx, p.Name = i, defName(prog, ExprFuncRef(i))
+			out = append(out, p)
+		}
+	}
+	src, err := json.MarshalIndent(out, "", "\t")
+	if err == nil {
+		err = ioutil.WriteFile(filePath, src, os.ModePerm)
+	}
+	return err
+}
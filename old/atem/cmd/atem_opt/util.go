@@ -1,11 +1,18 @@
 package main
 
 import (
+	"strings"
+
 	. "github.com/metaleap/atmo/old/atem"
 )
 
 var exprNever = exprTmp(123456789)
 
+const (
+	specializeMaxBodySize      = 128 // `exprSize` limit for defs to be cloned by `rewrite_specializeCallsWithConstArgs`
+	specializeMaxClonesPerFunc = 8
+)
+
 func init() { OpPrtDst = func([]byte) (int, error) { panic("caught in `tryEvalArgRefLessCall`") } }
 
 type exprTmp int
@@ -42,6 +49,16 @@ func convTo(expr Expr) Expr {
 	return expr
 }
 
+// convProgTo returns a copy of `prog` in `Eval`-able form, see `rewrite_preEvalArgRefLessCalls` and `tryEvalArgRefLessCall`
+func convProgTo(prog Prog) Prog {
+	ret := make(Prog, len(prog))
+	copy(ret, prog)
+	for i := range ret {
+		ret[i].Body = convTo(ret[i].Body)
+	}
+	return ret
+}
+
 func dissectCall(expr Expr, ignoreCallArgThatIsCallInCount func(exprAppl) bool) (innerMostCallee Expr, innerMostCalleeFnRef *ExprFuncRef, numCallArgs int, numCallArgsThatAreCalls int, numArgRefs int, allArgs []Expr) {
 	for call, okc := expr.(exprAppl); okc; call, okc = call.Callee.(exprAppl) {
 		innerMostCallee, numCallArgs, allArgs = call.Callee, numCallArgs+1, append([]Expr{call.Arg}, allArgs...)
@@ -61,6 +78,10 @@ func dissectCall(expr Expr, ignoreCallArgThatIsCallInCount func(exprAppl) bool)
 	return
 }
 
+func defName(prog Prog, fn ExprFuncRef) string {
+	return prog[fn].Meta[0][1+strings.IndexByte(prog[fn].Meta[0], ']'):]
+}
+
 func doesHaveNonCalleeUses(prog Prog, fn ExprFuncRef) (doesHaveNonCalleeOccurrences bool) {
 	var scrut func(Expr) Expr
 	scrut = func(expr Expr) Expr {
@@ -114,6 +135,15 @@ func fixFuncDefArgsUsageNumbers() {
 	}
 }
 
+// exprSize counts all nodes in `expr`, as visited by `walk`.
+func exprSize(expr Expr) (ret int) {
+	_ = walk(expr, func(it Expr) Expr {
+		ret++
+		return it
+	})
+	return
+}
+
 func rewriteCallArgs(callExpr exprAppl, numCallArgs int, rewriter func(int, Expr) Expr, argIdxs []int) exprAppl {
 	if numCallArgs <= 0 {
 		_, _, numCallArgs, _, _, _ = dissectCall(callExpr, nil)
@@ -155,7 +185,7 @@ func tryEvalArgRefLessCall(prog Prog, expr Expr, preCheckForArgRefs bool) (ret E
 
 		checkforargrefs := func() {
 			_ = walkInPostOrder(ret, func(it Expr) Expr {
-				if _, isargref := it.(ExprArgRef); isargref {
+				if _, isargref := it.(ExprArgRef); isargref || it == ExprFuncRef(OpErr) { // `OpErr`s abort, so must stay for run time
 					panic(it)
 				}
 				return it
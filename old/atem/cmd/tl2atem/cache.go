@@ -0,0 +1,272 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+// cacheVersion goes into every module hash: to be bumped whenever changes to
+// `tl2atem` alter its outputs, so as to invalidate all existing caches.
+const cacheVersion = "1"
+
+// cachedModule is the cache file content for one module: all `FuncDef`s
+// compiled from (or lifted out of) those of its top-level defs that were
+// reachable in any build since it last changed. Others get compiled on demand.
+type cachedModule struct {
+	Hash string
+	// Deps are the other modules that `Defs` refer to.
+	Deps []string
+	// Refs are the names of all `FuncDef`s that `Defs` refer to: the
+	// non-negative `ExprFuncRef`s in `Defs` are indices into `Refs`.
+	Refs []string
+	Defs []cachedDef
+
+	refIdxs map[string]int // only used during `cacheStore`
+}
+
+type cachedDef struct {
+	Meta         []string
+	Args         []int
+	Body         json.RawMessage
+	StdFallbacks []string `json:",omitempty"`
+}
+
+// moduleOf returns the name of the module that defines `name`, that is the
+// longest one of `inModules` prefixing it, or "" if none does.
+func moduleOf(name string) (ret string) {
+	for modname := range inModules {
+		if len(modname) > len(ret) && strings.HasPrefix(name, modname+".") {
+			ret = modname
+		}
+	}
+	return
+}
+
+func cacheHash(src []byte) string {
+	hash := sha256.Sum256(append([]byte(cacheVersion+"\n"), src...))
+	return hex.EncodeToString(hash[:])
+}
+
+// cacheLoad returns all the `cachedModule`s in `dirPath` still valid: those
+// of unchanged `inModules` that depend only on other such ones.
+func cacheLoad(dirPath string) map[string]*cachedModule {
+	ret := make(map[string]*cachedModule, len(inModules))
+	for modname, src := range inModules {
+		if data, err := ioutil.ReadFile(filepath.Join(dirPath, modname+".json")); err == nil {
+			var it cachedModule
+			if json.Unmarshal(data, &it) == nil && it.Hash == cacheHash(src) {
+				ret[modname] = &it
+			}
+		}
+	}
+	for again := true; again; { // dependants of changed modules need recompiling too
+		again = false
+		for modname, it := range ret {
+			for _, dep := range it.Deps {
+				if ret[dep] == nil {
+					again = true
+					delete(ret, modname)
+					break
+				}
+			}
+		}
+	}
+	return ret
+}
+
+// cacheNumSeeded is the number of `FuncDef`s in `outProg` from `cacheSeed`,
+// all others were compiled afresh.
+var cacheNumSeeded int
+
+// cacheSeed appends all `FuncDef`s of `cached` to `outProg`, as if compiled.
+func cacheSeed(cached map[string]*cachedModule) {
+	modnames := make([]string, 0, len(cached))
+	for modname := range cached {
+		modnames = append(modnames, modname)
+	}
+	sort.Strings(modnames)
+	for _, modname := range modnames {
+		for _, def := range cached[modname].Defs {
+			defsDone[def.Meta[0]], outProg = len(outProg), append(outProg, FuncDef{Meta: def.Meta, Args: def.Args})
+			if len(def.StdFallbacks) > 0 {
+				stdFallbacks[def.Meta[0]] = def.StdFallbacks
+			}
+		}
+	}
+	for _, modname := range modnames {
+		it := cached[modname]
+		for _, def := range it.Defs {
+			var body interface{}
+			if err := json.Unmarshal(def.Body, &body); err != nil {
+				panic(err)
+			}
+			outProg[defsDone[def.Meta[0]]].Body = relink(cacheExprFromJson(body), func(fn ExprFuncRef) ExprFuncRef {
+				idx, ok := defsDone[it.Refs[fn]]
+				if !ok {
+					panic("cache of " + modname + " refers to unknown " + it.Refs[fn])
+				}
+				return ExprFuncRef(idx)
+			})
+		}
+	}
+	cacheNumSeeded = len(outProg)
+}
+
+// cacheStore writes all `FuncDef`s in `outProg` of `inModules` not `cached`,
+// or `cached` but with `FuncDef`s compiled afresh, not seeded by `cacheSeed`.
+func cacheStore(dirPath string, cached map[string]*cachedModule) {
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		panic(err)
+	}
+	store := map[string]*cachedModule{}
+	for modname, src := range inModules {
+		if cached[modname] == nil {
+			store[modname] = &cachedModule{Hash: cacheHash(src)}
+		}
+	}
+	for i := cacheNumSeeded; i < len(outProg); i++ {
+		if modname := moduleOf(outProg[i].Meta[0]); cached[modname] != nil && store[modname] == nil {
+			store[modname] = &cachedModule{Hash: cached[modname].Hash}
+		}
+	}
+	for i := range outProg {
+		modname := moduleOf(outProg[i].Meta[0])
+		it := store[modname]
+		if it == nil {
+			continue
+		} else if it.refIdxs == nil {
+			it.refIdxs = map[string]int{}
+		}
+		body := relink(outProg[i].Body, func(fn ExprFuncRef) ExprFuncRef {
+			name := outProg[fn].Meta[0]
+			idx, ok := it.refIdxs[name]
+			if !ok {
+				idx, it.Refs = len(it.Refs), append(it.Refs, name)
+				it.refIdxs[name] = idx
+				if dep := moduleOf(name); dep != modname {
+					isnew := true
+					for _, known := range it.Deps {
+						isnew = isnew && known != dep
+					}
+					if isnew {
+						it.Deps = append(it.Deps, dep)
+					}
+				}
+			}
+			return ExprFuncRef(idx)
+		})
+		it.Defs = append(it.Defs, cachedDef{Meta: outProg[i].Meta, Args: outProg[i].Args, Body: json.RawMessage(body.JsonSrc()),
+			StdFallbacks: stdFallbacks[outProg[i].Meta[0]]})
+	}
+	for modname, it := range store {
+		if data, err := json.Marshal(it); err != nil {
+			panic(err)
+		} else if err = ioutil.WriteFile(filepath.Join(dirPath, modname+".json"), data, os.ModePerm); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// link reorders `outProg` to hold only the `FuncDef`s reachable from the
+// `entries`, starting with the `tl.StdRequiredDefs_*` ones and ending with the
+// `entries` in order (so a sole main one comes last, as required by `atem`),
+// renumbering all `ExprFuncRef`s accordingly.
+func link(entries []string) {
+	var order []int
+	for _, it := range stdRequiredDefs {
+		order = append(order, compileTopDef(it.name)) // all compiled already, so just looked up
+	}
+	entryidxs, newidxs := make(map[int]bool, len(entries)), make(map[int]int, len(outProg))
+	for i, idx := range order {
+		newidxs[idx] = i
+	}
+	for _, name := range entries {
+		entryidxs[compileTopDef(name)] = true
+	}
+	var visit func(Expr)
+	visit = func(expr Expr) {
+		switch it := expr.(type) {
+		case ExprFuncRef:
+			if _, done := newidxs[int(it)]; it >= 0 && !done && !entryidxs[int(it)] {
+				newidxs[int(it)], order = len(order), append(order, int(it))
+				visit(outProg[it].Body)
+			}
+		case *ExprCall:
+			visit(it.Callee)
+			for _, arg := range it.Args {
+				visit(arg)
+			}
+		}
+	}
+	for _, idx := range order {
+		visit(outProg[idx].Body)
+	}
+	for _, name := range entries {
+		visit(outProg[compileTopDef(name)].Body)
+	}
+	for _, name := range entries {
+		idx := compileTopDef(name)
+		if _, done := newidxs[idx]; !done { // not a std one or duplicate
+			newidxs[idx], order = len(order), append(order, idx)
+		}
+	}
+
+	linked := make(Prog, len(order))
+	for i, idx := range order {
+		linked[i] = outProg[idx]
+		linked[i].Body = relink(linked[i].Body, func(fn ExprFuncRef) ExprFuncRef { return ExprFuncRef(newidxs[int(fn)]) })
+	}
+	outProg = linked
+}
+
+// relink returns `expr` with all non-negative `ExprFuncRef`s replaced as per
+// `to`, leaving `expr` itself untouched.
+func relink(expr Expr, to func(ExprFuncRef) ExprFuncRef) Expr {
+	switch it := expr.(type) {
+	case ExprFuncRef:
+		if it >= 0 {
+			return to(it)
+		}
+	case *ExprCall:
+		ret := &ExprCall{Callee: relink(it.Callee, to), Args: make([]Expr, len(it.Args))}
+		for i := range it.Args {
+			ret.Args[i] = relink(it.Args[i], to)
+		}
+		return ret
+	}
+	return expr
+}
+
+// cacheExprFromJson decodes an `Expr` emitted by its `JsonSrc`, unlike
+// `Prog.ExprFromJson` not requiring the full `Prog` and allowing arg-refs.
+func cacheExprFromJson(from interface{}) Expr {
+	switch it := from.(type) {
+	case float64:
+		return ExprNumInt(it)
+	case string:
+		n, err := strconv.Atoi(it)
+		if err != nil {
+			panic(err)
+		}
+		return ExprArgRef(-(n + 2))
+	case []interface{}:
+		if len(it) == 1 {
+			return ExprFuncRef(it[0].(float64))
+		}
+		ret := &ExprCall{Callee: cacheExprFromJson(it[0]), Args: make([]Expr, 0, len(it)-1)}
+		for i := len(it) - 1; i > 0; i-- {
+			ret.Args = append(ret.Args, cacheExprFromJson(it[i]))
+		}
+		return ret
+	}
+	panic(from)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -9,31 +10,134 @@ import (
 	tl "github.com/metaleap/go-machines/toylam"
 )
 
-var defsDone = map[string]int{}
+var (
+	defsDone = map[string]int{}
+	// diags are all problems found by `compile`, as `module:line:col: message`
+	diags []string
+	// stdSuffixes maps all `.`-separated trailing parts of the names of all
+	// `std` top-level defs to those names, for the `std` fallback of `resolve`
+	stdSuffixes map[string][]string
+	// stdFallbacks are, per def name, all `name=qname` resolutions by `resolve`
+	// of its name refs to `std` defs, for `report`
+	stdFallbacks = map[string][]string{}
+	// numLambdaLifts are, per def name, the number of lambdas lifted out of it
+	// so far: their names derive from that, so as to not depend on compilation
+	// order (and hence on which other defs were seeded from the cache)
+	numLambdaLifts = map[string]int{}
+	// freeVarRefs are, per `tl.ExprFunc` added by `liftFreeVars`, the first
+	// reference to the free var it takes, for `freeVarRef`
+	freeVarRefs = map[*tl.ExprFunc]*tl.ExprName{}
+)
+
+// stdRequiredDefs are the `tl.StdRequiredDefs_*`, in `atem.StdFunc*` order,
+// with the number of args `atem` expects of each.
+var stdRequiredDefs = []struct {
+	name    string
+	numArgs int
+}{
+	{tl.StdRequiredDefs_id, 1},
+	{tl.StdRequiredDefs_true, 2},
+	{tl.StdRequiredDefs_false, 2},
+	{tl.StdRequiredDefs_listNil, 2},
+	{tl.StdRequiredDefs_listCons, 4},
+}
+
+// diag records a problem with `expr` (or, if `nil`, the whole def) in the def
+// named `defName`, located as per `srcLoc`.
+func diag(defName string, expr tl.Expr, msg string) {
+	modname, line, col := srcLoc(defName, expr)
+	if modname == "" {
+		modname = defName
+	}
+	msg = modname + ":" + strconv.Itoa(line) + ":" + strconv.Itoa(col) + ": " + msg
+	for _, known := range diags {
+		if known == msg {
+			return
+		}
+	}
+	diags = append(diags, msg)
+}
 
-func compile(mainTopDefQName string) {
-	compileTopDef(tl.StdRequiredDefs_id)
-	compileTopDef(tl.StdRequiredDefs_true)
-	compileTopDef(tl.StdRequiredDefs_false)
-	compileTopDef(tl.StdRequiredDefs_listNil)
-	compileTopDef(tl.StdRequiredDefs_listCons)
+// compile compiles into `outProg` the required std defs and the `entries`,
+// along with all defs reachable from them that weren't seeded from the cache.
+// Its output still needs to be `link`ed. Unless `entriesNumArgs` is negative,
+// all `entries` must take that many args. Any problems found go into `diags`.
+func compile(entries []string, entriesNumArgs int) {
+	required := func(name string, numArgs int) {
+		if idx := compileTopDef(name); idx < 0 {
+			diag(name, nil, "missing required def `"+name+"`")
+		} else if numArgs >= 0 && len(outProg[idx].Args) != numArgs {
+			diag(outProg[idx].Meta[0], nil, "`"+outProg[idx].Meta[0]+"` needs exactly "+strconv.Itoa(numArgs)+" args, not "+strconv.Itoa(len(outProg[idx].Args)))
+		}
+	}
+	for _, it := range stdRequiredDefs {
+		required(it.name, it.numArgs)
+	}
+	for _, name := range entries {
+		required(name, entriesNumArgs)
+	}
+}
 
-	idx, meta := compileTopDef(mainTopDefQName), []string{mainTopDefQName}
-	outProg = append(outProg, outProg[idx])
-	outProg[idx] = FuncDef{Meta: meta, Body: ExprFuncRef(len(outProg) - 1)}
+// markNoMemos adds `MetaNoMemo` to all nullary `FuncDef`s in `outProg` that
+// reference `OpPrt` or any `FuncDef`s (transitively) doing so, such that
+// `Prog.Memoize` keeps their outputs happening on every use, not just the first.
+func markNoMemos() {
+	prts := make([]bool, len(outProg))
+	var refsprt func(Expr) bool
+	refsprt = func(expr Expr) bool {
+		switch it := expr.(type) {
+		case ExprFuncRef:
+			return it == ExprFuncRef(OpPrt) || (it >= 0 && prts[it])
+		case *ExprCall:
+			for _, arg := range it.Args {
+				if refsprt(arg) {
+					return true
+				}
+			}
+			return refsprt(it.Callee)
+		}
+		return false
+	}
+	for again := true; again; {
+		again = false
+		for i := range outProg {
+			if !prts[i] && refsprt(outProg[i].Body) {
+				prts[i], again = true, true
+			}
+		}
+	}
+	for i := range outProg {
+		if prts[i] && len(outProg[i].Args) == 0 {
+			outProg[i].Meta = append(outProg[i].Meta, MetaNoMemo)
+		}
+	}
 }
 
 func compileExpr(expr tl.Expr, curFunc *FuncDef, curFuncsArgs []*tl.ExprFunc) Expr {
 	switch it := expr.(type) {
 	case *tl.ExprLitNum:
 		return ExprNumInt(it.NumVal)
-	case *tl.ExprCall:
-		return &ExprCall{Callee: compileExpr(it.Callee, curFunc, curFuncsArgs), Args: []Expr{compileExpr(it.CallArg, curFunc, curFuncsArgs)}}
+	case *tl.ExprCall: // collect the whole unary call chain into a single n-ary `ExprCall`
+		var callee tl.Expr = it
+		var args []tl.Expr // last arg first, as per `ExprCall.Args`
+		for call, ok := it, true; ok; call, ok = callee.(*tl.ExprCall) {
+			callee, args = call.Callee, append(args, call.CallArg)
+		}
+		ret := &ExprCall{Args: make([]Expr, len(args)), Callee: compileExpr(callee, curFunc, curFuncsArgs)}
+		if sub, _ := ret.Callee.(*ExprCall); sub != nil {
+			ret.Callee, ret.Args = sub.Callee, append(ret.Args, sub.Args...) // eg. lifted lambdas with free-var args
+		}
+		for i := len(args) - 1; i >= 0; i-- {
+			ret.Args[i] = compileExpr(args[i], curFunc, curFuncsArgs)
+		}
+		return ret
 	case *tl.ExprName:
 		if it.IdxOrInstr > 0 {
 			if opcode, ok := instr2op[tl.Instr(it.IdxOrInstr)]; ok {
 				return ExprFuncRef(opcode)
 			}
+			diag(curFunc.Meta[0], it, "unsupported instr `"+it.NameVal+"`")
+			return StdFuncId
 		} else {
 			for i, farg := range curFuncsArgs {
 				if farg.ArgName == it.NameVal {
@@ -41,49 +145,96 @@ func compileExpr(expr tl.Expr, curFunc *FuncDef, curFuncsArgs []*tl.ExprFunc) Ex
 				}
 			}
 			if it.IdxOrInstr == 0 {
-				idx := compileTopDef(it.NameVal)
-				return ExprFuncRef(idx)
+				if idx := compileTopDef(it.NameVal); idx >= 0 {
+					if qname := outProg[idx].Meta[0]; qname != it.NameVal {
+						fallback, known := it.NameVal+"="+qname, false
+						for _, other := range stdFallbacks[curFunc.Meta[0]] {
+							known = known || other == fallback
+						}
+						if !known {
+							stdFallbacks[curFunc.Meta[0]] = append(stdFallbacks[curFunc.Meta[0]], fallback)
+						}
+					}
+					return ExprFuncRef(idx)
+				} else if _, ambiguous := resolve(it.NameVal); len(ambiguous) > 0 {
+					diag(curFunc.Meta[0], it, "ambiguous name `"+it.NameVal+"`, qualify as one of: "+strings.Join(ambiguous, ", "))
+					return StdFuncId
+				}
 			}
+			diag(curFunc.Meta[0], it, "unknown name `"+it.NameVal+"`")
+			return StdFuncId
 		}
 	case *tl.ExprFunc:
-		globalname, globalbody := curFunc.Meta[0]+"//lam:"+it.ArgName+strconv.Itoa(len(inProg.TopDefs)), it
-		expr := tl.Expr(&tl.ExprName{NameVal: globalname})
-		freevars := freeVars(globalbody, map[string]string{}, nil)
-		for _, fvname := range freevars {
-			globalbody = &tl.ExprFunc{ArgName: fvname, Body: globalbody}
+		lamargs, _ := dissectFunc(it) // all directly nested lambdas become a single n-ary global
+		argnames := make([]string, len(lamargs))
+		for i, farg := range lamargs {
+			argnames[i] = farg.ArgName
 		}
+		globalname := curFunc.Meta[0] + "//lam" + strconv.Itoa(numLambdaLifts[curFunc.Meta[0]]) + ":" + strings.Join(argnames, ",")
+		numLambdaLifts[curFunc.Meta[0]]++
+		expr := tl.Expr(&tl.ExprName{NameVal: globalname})
+		freevars := freeVars(curFunc.Meta[0], it, map[string]string{}, nil)
+		globalbody := liftFreeVars(it, freevars)
 		fargs, _ := dissectFunc(globalbody)
 		for _, farg := range fargs[:len(freevars)] {
-			expr = &tl.ExprCall{Callee: expr, CallArg: &tl.ExprName{NameVal: farg.ArgName}}
+			expr = &tl.ExprCall{Callee: expr, CallArg: freeVarRef(farg)}
 		}
 		inProg.TopDefs[globalname] = globalbody
 		return compileExpr(expr, curFunc, curFuncsArgs)
 	}
-	panic(fmt.Sprintf("%T\t%v", expr, expr))
+	diag(curFunc.Meta[0], expr, fmt.Sprintf("unsupported expression: %T %v", expr, expr))
+	return StdFuncId
 }
 
-func compileTopDef(name string) int {
-	idx, done := defsDone[name]
-	if !done {
-		prefstd, topdef, locals := "", inProg.TopDefs[name], inProg.TopDefSepLocals[name]
-		if topdef == nil {
-			if prefstd, topdef = tl.StdModuleName+".", inProg.TopDefs[tl.StdModuleName+"."+name]; topdef == nil {
-				for k, v := range inProg.TopDefs {
-					if strings.HasSuffix(k, "."+name) && strings.HasPrefix(k, tl.StdModuleName+".") {
-						prefstd, topdef = k[:len(k)-len(name)], v
+// resolve returns the qualified name of the top-level def that `name` refers
+// to: `name` itself if defined, else the `std` def named `std.name` or else
+// the one whose name ends in `.name`, if exactly one does. Otherwise, `qName`
+// is "" and `ambiguous` has all the `std` defs whose names end in `.name`.
+func resolve(name string) (qName string, ambiguous []string) {
+	if _, done := defsDone[name]; done || inProg.TopDefs[name] != nil {
+		return name, nil
+	} else if qName = tl.StdModuleName + "." + name; inProg.TopDefs[qName] != nil {
+		return qName, nil
+	}
+	if stdSuffixes == nil {
+		stdSuffixes = map[string][]string{}
+		for tdname := range inProg.TopDefs {
+			if strings.HasPrefix(tdname, tl.StdModuleName+".") && !strings.Contains(tdname, "//") {
+				for i := len(tl.StdModuleName) + 1; ; {
+					suffix := tdname[i:]
+					stdSuffixes[suffix] = append(stdSuffixes[suffix], tdname)
+					dot := strings.IndexByte(suffix, '.')
+					if dot < 0 {
 						break
 					}
+					i += dot + 1
 				}
 			}
-			if idx, done = defsDone[prefstd+name]; done {
-				return idx
-			}
-			locals = inProg.TopDefSepLocals[prefstd+name]
 		}
-		if topdef == nil {
-			panic("name unresolvable: " + name)
+		for _, tdnames := range stdSuffixes {
+			sort.Strings(tdnames)
 		}
-		idx, name = len(outProg), prefstd+name
+	}
+	found := stdSuffixes[name]
+	if len(found) == 1 {
+		return found[0], nil
+	}
+	return "", found
+}
+
+// compileTopDef returns the `outProg` index of the top-level def that `name`
+// refers to as per `resolve`, compiling it first if not yet done, or -1 if
+// there is no such def.
+func compileTopDef(name string) int {
+	idx, done := defsDone[name]
+	if !done {
+		if name, _ = resolve(name); name == "" {
+			return -1
+		} else if idx, done = defsDone[name]; done {
+			return idx
+		}
+		topdef, locals := inProg.TopDefs[name], inProg.TopDefSepLocals[name]
+		idx = len(outProg)
 		outProg, defsDone[name] = append(outProg, FuncDef{Meta: []string{name}}), idx
 
 		result := &outProg[idx]
@@ -106,13 +257,12 @@ func compileTopDef(name string) int {
 							}
 							again, locals = true, append(locals[:i], locals[i+1:]...)
 							break
-						} else {
+						} else { // evaluated once, then shared as an arg by all its referrers, including other locals
+							shrname := &tl.ExprName{NameVal: "//shr:" + local.Name}
 							for j := 0; j < i; j++ {
-								if 0 < locals[j].ReplaceName(local.Name, local.Name) {
-									panic(name + "\t" + local.Name + "\tTODO: finish multiple-use non-atomic-shared-argless-locals topic")
-								}
+								locals[j].Expr = locals[j].Expr.RewriteName(local.Name, shrname)
 							}
-							body = &tl.ExprCall{Callee: &tl.ExprFunc{ArgName: "//shr:" + local.Name, Body: body.RewriteName(local.Name, &tl.ExprName{NameVal: "//shr:" + local.Name})}, CallArg: local.Expr}
+							body = shareLocal(body.RewriteName(local.Name, shrname), shrname.NameVal, local.Expr)
 							again, locals = true, append(locals[:i], locals[i+1:]...)
 							break
 						}
@@ -121,7 +271,7 @@ func compileTopDef(name string) int {
 			}
 		}
 		for i, f := range curfuncsargs {
-			result.Meta = append(result.Meta, f.ArgName)
+			result.Meta = append(result.Meta, strings.TrimPrefix(f.ArgName, "//shr:"))
 			result.Args[i] = body.ReplaceName(f.ArgName, f.ArgName) // just counts occurrences
 			for _, local := range locals {
 				if numrefs := local.Expr.ReplaceName(f.ArgName, f.ArgName); numrefs > 0 {
@@ -130,13 +280,15 @@ func compileTopDef(name string) int {
 			}
 		}
 
+		result.Meta = append(result.Meta, srcLocMeta(name, topdef))
+
 		localgnames := map[string]string{}
 		var lifted func(int, []*tl.ExprFunc)
 		lifted = func(idx int, argsadded []*tl.ExprFunc) {
 			gname := localgnames[locals[idx].Name]
 			var expr tl.Expr = &tl.ExprName{NameVal: gname}
 			for _, farg := range argsadded {
-				expr = &tl.ExprCall{Callee: expr, CallArg: &tl.ExprName{NameVal: farg.ArgName}}
+				expr = &tl.ExprCall{Callee: expr, CallArg: freeVarRef(farg)}
 			}
 			body = body.RewriteName(gname, expr)
 			for j, exprcopy := 0, fullCopy(expr); j <= idx; j++ {
@@ -173,14 +325,9 @@ func compileTopDef(name string) int {
 			}
 		}
 		for i, local := range locals {
-			globalname, globalbody := localgnames[local.Name], local.Expr
-			freevars := freeVars(local.Expr, localgnames, nil)
-			for _, fvname := range freevars {
-				if local.Name == "nX" {
-					println(i, fvname)
-				}
-				globalbody = &tl.ExprFunc{ArgName: fvname, Body: globalbody}
-			}
+			globalname := localgnames[local.Name]
+			freevars := freeVars(name, local.Expr, localgnames, nil)
+			globalbody := liftFreeVars(local.Expr, freevars)
 			inProg.TopDefs[globalname] = globalbody
 			fargs, _ := dissectFunc(globalbody)
 			lifted(i, fargs[:len(freevars)])
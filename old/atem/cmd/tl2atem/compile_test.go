@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+func TestMarkNoMemos(t *testing.T) {
+	defer func(prog Prog) { outProg = prog }(outProg)
+	outProg = LoadFromJson([]byte(`[ [ ["[0]std.same","it"], [1], "0" ]
+, [ ["[1]std.True","t","f"], [1,0], "0" ]
+, [ ["[2]std.False","t","f"], [0,1], "1" ]
+, [ ["[3]std.ListEnd","e","l"], [1,0], "0" ]
+, [ ["[4]std.ListLink","h","t","e","l"], [1,1,0,1], ["3", "0", "1"] ]
+, [ ["[5]log","msg"], [1], [[-42], "0", [3]] ]
+, [ ["[6]logged"], [], [[5], 1] ]
+, [ ["[7]viaLogged"], [], [[0], [6]] ]
+, [ ["[8]quiet"], [], [[0], [[-1], 1, 2]] ]
+, [ ["main","args","env"], [0,0], [[0], [7]] ]
+]`))
+	markNoMemos()
+	for i, want := range []bool{false, false, false, false, false, false, true, true, false, false} {
+		if got := len(outProg[i].Meta) > 0 && outProg[i].Meta[len(outProg[i].Meta)-1] == MetaNoMemo; got != want {
+			t.Errorf("%v: expected MetaNoMemo %v, got %v", outProg[i].Meta, want, got)
+		}
+	}
+}
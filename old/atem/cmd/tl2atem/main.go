@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -12,9 +13,10 @@ import (
 )
 
 var (
-	inProg   tl.Prog
-	outProg  = make(Prog, 0, 1024)
-	instr2op = map[tl.Instr]OpCode{
+	inProg    tl.Prog
+	inModules map[string][]byte
+	outProg   = make(Prog, 0, 1024)
+	instr2op  = map[tl.Instr]OpCode{
 		tl.InstrADD: OpAdd,
 		tl.InstrDIV: OpDiv,
 		tl.InstrEQ:  OpEq,
@@ -24,12 +26,39 @@ var (
 		tl.InstrMUL: OpMul,
 		tl.InstrSUB: OpSub,
 		tl.InstrMSG: OpPrt,
-		tl.InstrERR: -1010101,
+		tl.InstrERR: OpErr,
 	}
 )
 
+// compiles the `.tl` file given as the first arg (along with all other `.tl`
+// files in its directory, as its possible imports) to a same-named `.json`
+// `Prog` in the directory given as the second arg. Per-module compilation
+// results are cached in its `.tl2atem-cache` sub-directory, so that only the
+// modules changed since (and all modules depending on those) get recompiled,
+// and of any module only those defs reachable (as below) in builds so far.
+// All problems found are reported to stderr (with their source locations),
+// in which case nothing is written and the exit code is non-zero.
+//
+// Only the defs reachable from the `main` one of the `.tl` file are included,
+// which comes last. For library builds, `-entries a,b,c` instead includes all
+// those reachable from the named defs (unqualified ones being in the `.tl`
+// file's module), which come last and in that order (minus any duplicates or
+// `std` ones required anyway), with no restrictions on their numbers of args.
+//
+// Nullary defs that (transitively) print via `OpPrt` are marked with
+// `atem.MetaNoMemo`, so that `atem.Prog.Memoize` won't skip those outputs.
+//
+// With `-report`, all included defs are listed to stdout, along with all name
+// refs resolved to `std` defs by fallback and all lambda and local lifts.
 func main() {
-	srcfilepath, dstdirpath := os.Args[1], os.Args[2]
+	flags := flag.NewFlagSet("tl2atem", flag.ExitOnError)
+	entrynames := flags.String("entries", "", "comma-separated names of defs to include instead of main")
+	withreport := flags.Bool("report", false, "list included defs, std fallbacks and lifts to stdout")
+	if err := flags.Parse(os.Args[1:]); err != nil || flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	srcfilepath, dstdirpath := flags.Arg(0), flags.Arg(1)
 	if err := os.MkdirAll(dstdirpath, os.ModePerm); err != nil {
 		panic(err)
 	}
@@ -38,12 +67,12 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
-	modules := make(map[string][]byte, len(files))
+	inModules = make(map[string][]byte, len(files))
 	for _, file := range files {
 		if curfilepath := filepath.Join(srcdirpath, file.Name()); !file.IsDir() {
 			if idxdot := strings.LastIndexByte(file.Name(), '.'); (curfilepath == srcfilepath) || (idxdot > 0 && file.Name()[idxdot:] == ".tl") {
 				if src, err := ioutil.ReadFile(curfilepath); err == nil {
-					modules[file.Name()[:idxdot]] = src
+					inModules[file.Name()[:idxdot]] = src
 				} else {
 					panic(err)
 				}
@@ -51,17 +80,40 @@ func main() {
 		}
 	}
 	srcfilename, srcfileext := filepath.Base(srcfilepath), filepath.Ext(srcfilepath)
-	maintopdefqname := srcfilename[:len(srcfilename)-len(srcfileext)] + ".main"
-	dstfilepath := filepath.Join(dstdirpath,
-		maintopdefqname[:len(maintopdefqname)-len(".main")]+".json")
+	srcmodname := srcfilename[:len(srcfilename)-len(srcfileext)]
+	dstfilepath := filepath.Join(dstdirpath, srcmodname+".json")
+	entries, entriesnumargs := []string{srcmodname + ".main"}, 2
+	if *entrynames != "" {
+		entries, entriesnumargs = strings.Split(*entrynames, ","), -1
+		for i, name := range entries {
+			if moduleOf(name) == "" {
+				entries[i] = srcmodname + "." + name
+			}
+		}
+	}
 
-	inProg.ParseModules(modules, tl.ParseOpts{KeepNameRefs: true, KeepOpRefs: true, KeepRec: true, KeepSepLocals: true})
-	compile(maintopdefqname)
+	inProg.ParseModules(inModules, tl.ParseOpts{KeepNameRefs: true, KeepOpRefs: true, KeepRec: true, KeepSepLocals: true})
+	cachedirpath := filepath.Join(dstdirpath, ".tl2atem-cache")
+	cached := cacheLoad(cachedirpath)
+	cacheSeed(cached)
+	if compile(entries, entriesnumargs); len(diags) > 0 {
+		os.Stderr.WriteString(strings.Join(diags, "\n") + "\n" + strconv.Itoa(len(diags)) + " error(s), nothing written\n")
+		os.Exit(1)
+	}
+	cacheStore(cachedirpath, cached)
+	link(entries)
+	markNoMemos()
+	if *withreport {
+		report()
+	}
 
 	for i := 0; i < len(outProg)-1; i++ {
 		pos := strings.IndexByte(outProg[i].Meta[0], ']')
 		outProg[i].Meta[0] = "[" + strconv.Itoa(i) + "]" + outProg[i].Meta[0][pos+1:]
 	}
 
-	ioutil.WriteFile(dstfilepath, []byte(outProg.JsonSrc(false)), os.ModePerm)
+	if err = ioutil.WriteFile(dstfilepath, []byte(outProg.JsonSrc(false)), os.ModePerm); err != nil {
+		os.Stderr.WriteString(err.Error() + "\n")
+		os.Exit(1)
+	}
 }
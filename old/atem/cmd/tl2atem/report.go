@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// report writes to stdout all `FuncDef`s of the `link`ed `outProg`, followed
+// by all `std` fallback resolutions (by `resolve`) of name refs in them and
+// all lambda and local lifts among them.
+func report() {
+	var defs, fallbacks, lifts []string
+	for i := range outProg {
+		name, idx := outProg[i].Meta[0], "#"+strconv.Itoa(i)
+		defs = append(defs, idx+"\t"+name+"\t"+strconv.Itoa(len(outProg[i].Args))+" args")
+		for _, fallback := range stdFallbacks[name] {
+			fallbacks = append(fallbacks, name+"\t"+strings.Replace(fallback, "=", " -> ", 1))
+		}
+		if pos := strings.Index(name, "//"); pos > 0 {
+			lifts = append(lifts, idx+"\t"+name+"\tlifted out of "+name[:pos])
+		}
+	}
+	for _, section := range []struct {
+		title string
+		lines []string
+	}{{"reachable defs", defs}, {"std fallbacks", fallbacks}, {"lifts", lifts}} {
+		os.Stdout.WriteString(section.title + " (" + strconv.Itoa(len(section.lines)) + "):\n")
+		for _, line := range section.lines {
+			os.Stdout.WriteString("\t" + line + "\n")
+		}
+	}
+}
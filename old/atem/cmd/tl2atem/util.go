@@ -1,8 +1,10 @@
 package main
 
 import (
+	"strconv"
 	"strings"
 
+	. "github.com/metaleap/atmo/old/atem"
 	tl "github.com/metaleap/go-machines/toylam"
 )
 
@@ -14,44 +16,118 @@ func dissectFunc(expr tl.Expr) (outerFuncs []*tl.ExprFunc, innerMostBody tl.Expr
 	return
 }
 
-func freeVars(expr tl.Expr, localNames map[string]string, stash []string) []string {
+// shareLocal binds `expr` to `shrName` for `body` via an immediately-applied
+// lambda, placed inside those of any previously shared locals that `expr`
+// itself refers to, so that these remain in scope.
+func shareLocal(body tl.Expr, shrName string, expr tl.Expr) tl.Expr {
+	if call, _ := body.(*tl.ExprCall); call != nil {
+		if fn, _ := call.Callee.(*tl.ExprFunc); fn != nil && strings.HasPrefix(fn.ArgName, "//shr:") && expr.ReplaceName(fn.ArgName, fn.ArgName) > 0 {
+			return &tl.ExprCall{Callee: &tl.ExprFunc{ArgName: fn.ArgName, Body: shareLocal(fn.Body, shrName, expr)}, CallArg: call.CallArg}
+		}
+	}
+	return &tl.ExprCall{Callee: &tl.ExprFunc{ArgName: shrName, Body: body}, CallArg: expr}
+}
+
+// srcLocMeta returns the `MetaSrcLocPrefix` entry for the `FuncDef` named
+// `name` compiled from `expr`, as per `srcLoc`.
+func srcLocMeta(name string, expr tl.Expr) string {
+	modname, line, col := srcLoc(name, expr)
+	return MetaSrcLocPrefix + modname + ":" + strconv.Itoa(line) + ":" + strconv.Itoa(col)
+}
+
+// srcLoc returns the source location of `expr` in the def named `name`: at the
+// first of its (nested) `tl.ExprFunc`s or its body that has a `tlSrcLoc`, else
+// at the line defining the top-level def that `name` is (or was lifted out of),
+// if found, else at line 0.
+func srcLoc(name string, expr tl.Expr) (modname string, line int, col int) {
+	funcs, body := dissectFunc(expr)
+	for _, fn := range funcs {
+		if line, col = tlSrcLoc(fn); line > 0 {
+			break
+		}
+	}
+	if line == 0 && body != nil {
+		line, col = tlSrcLoc(body)
+	}
+	modname = moduleOf(name)
+	if topdefname := strings.SplitN(name, "//", 2)[0]; line == 0 && modname != "" {
+		for i, ln := range strings.Split(string(inModules[modname]), "\n") {
+			if local := topdefname[len(modname)+1:]; strings.HasPrefix(ln, local+" ") || strings.HasPrefix(ln, local+"\t") {
+				line, col = i+1, 1
+				break
+			}
+		}
+	}
+	return
+}
+
+// tlSrcLoc returns the 1-based line and col of `expr` in its module source, as
+// recorded by the `tl` parser, else zeroes (such as for `tl.Expr`s synthesized
+// here, ie. by `shareLocal` or lambda lifting).
+func tlSrcLoc(expr tl.Expr) (line int, col int) {
+	var loc *tl.SrcLoc
 	switch it := expr.(type) {
+	case *tl.ExprLitNum:
+		loc = &it.Loc
+	case *tl.ExprName:
+		loc = &it.Loc
 	case *tl.ExprCall:
-		stash = freeVars(it.CallArg, localNames, freeVars(it.Callee, localNames, stash))
+		loc = &it.Loc
+	case *tl.ExprFunc:
+		loc = &it.Loc
+	}
+	if loc != nil && loc.LineNr > 0 {
+		line, col = loc.LineNr, loc.LineOffset+1
+	}
+	return
+}
+
+// liftFreeVars wraps `body` in a `tl.ExprFunc` for each of `freeVars`, noting
+// each's first reference in `freeVarRefs`.
+func liftFreeVars(body tl.Expr, freeVars []*tl.ExprName) tl.Expr {
+	for _, fv := range freeVars {
+		fn := &tl.ExprFunc{ArgName: fv.NameVal, Body: body}
+		freeVarRefs[fn], body = fv, fn
+	}
+	return body
+}
+
+// freeVarRef returns a reference to the arg of `farg`, located at the first
+// reference to it if it's one added by `liftFreeVars`, so that any `diag` on
+// it (as an unknown or ambiguous name) points there rather than at the def.
+func freeVarRef(farg *tl.ExprFunc) *tl.ExprName {
+	ret := &tl.ExprName{NameVal: farg.ArgName}
+	if fv := freeVarRefs[farg]; fv != nil {
+		ret.Loc = fv.Loc
+	}
+	return ret
+}
+
+func freeVars(defName string, expr tl.Expr, localNames map[string]string, stash []*tl.ExprName) []*tl.ExprName {
+	switch it := expr.(type) {
+	case *tl.ExprCall:
+		stash = freeVars(defName, it.CallArg, localNames, freeVars(defName, it.Callee, localNames, stash))
 	case *tl.ExprFunc:
 		if _, exists := localNames[it.ArgName]; exists {
-			panic(it.ArgName)
+			diag(defName, it, "arg name `"+it.ArgName+"` shadows an outer one")
+			break
 		}
 		localNames[it.ArgName] = ""
-		stash = freeVars(it.Body, localNames, stash)
+		stash = freeVars(defName, it.Body, localNames, stash)
 		delete(localNames, it.ArgName)
 	case *tl.ExprName:
 		if it.IdxOrInstr <= 0 {
 			if _, exists := localNames[it.NameVal]; !exists {
-				if _, exists = inProg.TopDefs[it.NameVal]; !exists {
-					if _, exists = inProg.TopDefs[tl.StdModuleName+"."+it.NameVal]; !exists {
-						for tdname := range inProg.TopDefs {
-							if strings.HasSuffix(tdname, "."+it.NameVal) && strings.HasPrefix(tdname, tl.StdModuleName+".") {
-								if exists { // name points to colliding std globals eg. std.num.toString vs std.json.toString: error will force qualification
-									exists = false
-									break
-								} else {
-									exists = true
-								}
-							}
-						}
-						if !exists {
-							var found bool
-							for _, fv := range stash {
-								if found = (fv == it.NameVal); found {
-									break
-								}
-							}
-							if !found {
-								stash = append(stash, it.NameVal)
-							}
+				if qname, _ := resolve(it.NameVal); qname == "" { // includes names of colliding std globals eg. std.num.toString vs std.json.toString: error will force qualification
+					var found bool
+					for _, fv := range stash {
+						if found = (fv.NameVal == it.NameVal); found {
+							break
 						}
 					}
+					if !found {
+						stash = append(stash, it)
+					}
 				}
 			}
 		}
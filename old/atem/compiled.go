@@ -0,0 +1,268 @@
+package atem
+
+import (
+	"sync"
+)
+
+// evalCode is the `EngineClosures` (and `EngineParallel`) form of an `Expr`:
+// given the arg values (in call order) of the call whose `FuncDef.Body` the
+// `Expr` belongs to, it evaluates the `Expr` as the interpreter does for
+// non-callee positions, ie. func-refs to nullary `FuncDef`s are not "forced"
+// (that happens in `apply`).
+type evalCode func(args []Expr) Expr
+
+// compiledDef is the compiled form of a `FuncDef`, for all `Engine`s but
+// `EngineInterp` and `EngineLazy`.
+type compiledDef struct {
+	body   evalCode
+	splice func() (callee Expr, args []Expr) // only for nullary `FuncDef`s with a non-closure `ExprCall` as `Body`
+}
+
+// compiledCall is the `EngineClosures` form of a non-closure `ExprCall`.
+type compiledCall struct {
+	callee evalCode
+	args   []evalCode // in call order, unlike `ExprCall.Args`
+	atomic []bool     // for each of `args`: whether it's an arg-ref or a value, to be evaluated right away rather than via `exprThunk`
+}
+
+// compiledPrepMu guards `prepCompiled`, just as `parallelPrepMu` does `prepParallel`.
+var compiledPrepMu sync.Mutex
+
+// exprThunk is a not-yet-evaluated non-atomic call arg, to be evaluated
+// only if needed: they only ever occur inside `apply` args, never in results.
+type exprThunk struct {
+	code evalCode
+	args []Expr
+}
+
+// JsonSrc implements the `Expr` interface.
+func (me *exprThunk) JsonSrc() string { return "null" }
+
+func (me Prog) evalCompiled(expr Expr, engine Engine) Expr {
+	var root Expr
+	if engine == EngineLazy {
+		return me.evalLazy(expr)
+	} else if engine == EngineBytecode {
+		me.prepCompiled(engine)
+		bc := me.compileBytecode(expr, false)
+		root = me.runBytecode(bc, 0, nil)
+	} else if engine == EngineParallel {
+		me.prepParallel()
+		root = me.compile(expr, engine)(nil)
+	} else {
+		me.prepCompiled(engine)
+		root = me.compile(expr, engine)(nil)
+	}
+	return me.apply(root, nil, engine) // the root `expr` is in callee position
+}
+
+// prepCompiled compiles all `FuncDef`s for `EngineClosures` or `EngineBytecode`
+// (unless done so before), so that concurrent `Prog.Eval`s only ever read them.
+func (me Prog) prepCompiled(engine Engine) {
+	compiledPrepMu.Lock()
+	defer compiledPrepMu.Unlock()
+	for i := range me {
+		if def := &me[i]; engine == EngineBytecode && def.bytecode == nil {
+			call, iscall := def.Body.(*ExprCall)
+			def.bytecode = me.compileBytecode(def.Body, len(def.Args) == 0 && iscall && call.IsClosure == 0)
+		} else if engine == EngineClosures && def.closures == nil {
+			def.closures = me.compileDef(ExprFuncRef(i), engine)
+		}
+	}
+}
+
+func (me Prog) compiledDef(fn ExprFuncRef, engine Engine) *compiledDef {
+	if engine == EngineBytecode {
+		return &me[fn].bytecode.def
+	} else if engine == EngineParallel {
+		return me[fn].parallel // all compiled beforehand by `prepParallel`, never from spawned goroutines
+	}
+	return me[fn].closures // all compiled beforehand by `prepCompiled`
+}
+
+func (me Prog) compileDef(fn ExprFuncRef, engine Engine) *compiledDef {
+	def, ret := &me[fn], &compiledDef{body: me.compile(me[fn].Body, engine)}
+	if call, ok := def.Body.(*ExprCall); ok && call.IsClosure == 0 && len(def.Args) == 0 {
+		cc := me.compileCall(call, engine)
+		ret.splice = func() (Expr, []Expr) { return cc.callee(nil), cc.entries(0, nil) }
+	}
+	return ret
+}
+
+func (me Prog) compile(expr Expr, engine Engine) evalCode {
+	switch it := expr.(type) {
+	case ExprArgRef:
+		idx := int(-it) - 2
+		return func(args []Expr) Expr { return args[idx] }
+	case *ExprCall:
+		if it.IsClosure == 0 {
+			return me.compileCallCode(it, engine)
+		}
+	}
+	return func([]Expr) Expr { return expr } // nums, func-refs, closures: already values
+}
+
+func (me Prog) compileCall(call *ExprCall, engine Engine) *compiledCall {
+	ret := compiledCall{callee: me.compile(call.Callee, engine), args: make([]evalCode, len(call.Args)), atomic: make([]bool, len(call.Args))}
+	for i := range call.Args {
+		arg := call.Args[len(call.Args)-1-i]
+		subcall, issubcall := arg.(*ExprCall)
+		ret.args[i], ret.atomic[i] = me.compile(arg, engine), !(issubcall && subcall.IsClosure == 0)
+	}
+	return &ret
+}
+
+// entries prepares the args from index `from` onwards for `apply`.
+func (me *compiledCall) entries(from int, args []Expr) []Expr {
+	ret := make([]Expr, len(me.args)-from)
+	for i := range ret {
+		if code := me.args[from+i]; me.atomic[from+i] {
+			ret[i] = code(args)
+		} else {
+			ret[i] = &exprThunk{code: code, args: args}
+		}
+	}
+	return ret
+}
+
+// compileCallCode short-cuts the two most common kinds of calls, saturated
+// ones of prim-ops or known non-selector `FuncDef`s, into direct evaluation.
+// All others go through `apply`, just like any surplus args in the former.
+// With `EngineParallel`, the former may evaluate their args concurrently.
+func (me Prog) compileCallCode(call *ExprCall, engine Engine) evalCode {
+	cc := me.compileCall(call, engine)
+	fn, isfn := call.Callee.(ExprFuncRef)
+	if isfn && fn < 0 && len(cc.args) >= 2 {
+		if spawn := me.parallelSpawns(call, 2, nil, engine); spawn != nil {
+			return func(args []Expr) Expr {
+				var operands [2]Expr
+				evalArgs(cc.args[:2], nil, spawn, args, operands[:])
+				result := me.opResult(fn, operands[0], operands[1], engine)
+				if len(cc.args) == 2 {
+					return result
+				}
+				return me.apply(result, cc.entries(2, args), engine)
+			}
+		}
+		return func(args []Expr) Expr {
+			lhs := cc.args[0](args)
+			result := me.opResult(fn, lhs, cc.args[1](args), engine)
+			if len(cc.args) == 2 {
+				return result
+			}
+			return me.apply(result, cc.entries(2, args), engine)
+		}
+	} else if isfn && fn >= 0 && len(me[fn].Args) > 0 && me[fn].selector == 0 && len(cc.args) >= len(me[fn].Args) {
+		usage, spawn := me[fn].Args, me.parallelSpawns(call, len(me[fn].Args), me[fn].Args, engine)
+		return func(args []Expr) Expr {
+			fnargs := make([]Expr, len(usage))
+			if spawn != nil {
+				evalArgs(cc.args[:len(usage)], usage, spawn, args, fnargs)
+			} else {
+				for i := range fnargs {
+					if usage[i] != 0 { // unused args are never evaluated and passed as `nil`
+						fnargs[i] = cc.args[i](args)
+					}
+				}
+			}
+			result := me.compiledDef(fn, engine).body(fnargs)
+			if len(cc.args) == len(usage) {
+				return result
+			}
+			return me.apply(result, cc.entries(len(usage), args), engine)
+		}
+	}
+	return func(args []Expr) Expr {
+		return me.apply(cc.callee(args), cc.entries(0, args), engine)
+	}
+}
+
+// apply calls `callee` (in callee position, so forcing nullary func-refs) with
+// `args` (values or `exprThunk`s), mirroring each step of the interpreter's
+// `frame` handling: including its not-evaluating-args short-cut for selectors
+// and the `nil`ing of unused args (except those already held by a closure).
+// It is shared by `EngineClosures`, `EngineParallel` and `EngineBytecode`,
+// which only differ in their `compiledDef`s.
+func (me Prog) apply(callee Expr, args []Expr, engine Engine) Expr {
+	numdone := 0 // leading `args` stemming from an unrolled closure
+	for {
+		switch it := callee.(type) {
+		case *exprThunk:
+			callee, numdone = it.code(it.args), 0
+			continue
+		case *ExprCall:
+			if len(args) == 0 {
+				return it
+			}
+			closureargs := make([]Expr, len(it.Args), len(it.Args)+len(args))
+			for i := range it.Args {
+				closureargs[len(it.Args)-1-i] = it.Args[i]
+			}
+			callee, args, numdone = it.Callee, append(closureargs, args...), len(it.Args)
+			continue
+		case ExprFuncRef:
+			arity, usage := 2, []int(nil)
+			if it >= 0 {
+				def := &me[it]
+				if arity, usage = len(def.Args), def.Args; def.selector != 0 && len(args) >= arity {
+					pick, rest := func(argref Expr) Expr { return args[int(-argref.(ExprArgRef))-2] }, args[arity:]
+					if def.selector < 0 {
+						callee, args = pick(ExprArgRef(def.selector)), rest
+					} else {
+						call := def.Body.(*ExprCall)
+						selargs := make([]Expr, len(call.Args), len(call.Args)+len(rest))
+						for i := range call.Args {
+							selargs[len(call.Args)-1-i] = pick(call.Args[i])
+						}
+						callee, args = pick(call.Callee), append(selargs, rest...)
+					}
+					numdone = 0
+					continue
+				} else if arity == 0 && def.memoize {
+					callee = me.memoized(it, engine)
+					continue
+				} else if arity == 0 { // a shared global constant: splice in its `Body` call
+					if compiled := me.compiledDef(it, engine); compiled.splice != nil {
+						splicecallee, spliceargs := compiled.splice()
+						callee, args, numdone = splicecallee, append(spliceargs, args...), 0
+					} else {
+						callee = def.Body // a closure, so unrolled in the next iteration
+					}
+					continue
+				}
+			}
+			if len(args) == 0 {
+				return it
+			}
+			for i := numdone; i < arity && i < len(args); i++ {
+				if usage != nil && usage[i] == 0 {
+					args[i] = nil
+				} else if thunk, ok := args[i].(*exprThunk); ok {
+					args[i] = thunk.code(thunk.args)
+				}
+			}
+			if len(args) < arity {
+				closure := &ExprCall{IsClosure: arity - len(args), Callee: it, Args: make([]Expr, len(args))}
+				for i := range args {
+					closure.Args[len(args)-1-i] = args[i]
+				}
+				return closure
+			}
+			var result Expr
+			if it < 0 {
+				result = me.opResult(it, args[0], args[1], engine)
+			} else {
+				result = me.compiledDef(it, engine).body(args[:arity:arity])
+			}
+			if args = args[arity:]; len(args) == 0 {
+				return result
+			}
+			callee, numdone = result, 0
+		default:
+			if len(args) == 0 {
+				return it
+			}
+			panic(it) // not callable
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package atem_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	. "github.com/metaleap/atmo/old/atem"
+	"github.com/metaleap/atmo/old/atem/golden"
+)
+
+var testEngines = []struct {
+	name   string
+	engine Engine
+}{{"interp", EngineInterp}, {"closures", EngineClosures}, {"bytecode", EngineBytecode}, {"lazy", EngineLazy}, {"parallel", EngineParallel}}
+
+// testCases are those programs in `tmpdummies` with `.expected` files, as
+// run by `golden.Check`.
+func testCases(t testing.TB) (ret []golden.Case) {
+	cases, err := golden.Discover("tmpdummies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, it := range cases {
+		if it.Expected != nil {
+			ret = append(ret, it)
+		}
+	}
+	if len(ret) == 0 {
+		t.Fatal("no programs with .expected files in tmpdummies")
+	}
+	return
+}
+
+// TestEngines runs all `testCases` with every `Engine`, failing on any output
+// (including `OpPrt`s and `OpErr`s) differing from that of `EngineInterp`.
+func TestEngines(t *testing.T) {
+	for _, it := range testCases(t) {
+		want, err := it.Run(EngineInterp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, engine := range testEngines[1:] {
+			if got, err := it.Run(engine.engine); err != nil {
+				t.Errorf("%s with %s: %v", it.SrcFilePath, engine.name, err)
+			} else if diff := golden.Diff(want, got); diff != "" {
+				t.Errorf("%s with %s differs from interp:\n%s", it.SrcFilePath, engine.name, diff)
+			}
+		}
+	}
+}
+
+// TestEnginesConcurrentEvals has, for every `Engine` but `EngineInterp` (which
+// updates package-level stats on every step), each of `GOMAXPROCS` goroutines
+// start an evaluation of the same fresh `Prog` at once, so that these share
+// any on-first-use compilation. Best run with `-race`.
+func TestEnginesConcurrentEvals(t *testing.T) {
+	defer func(dst func([]byte) (int, error)) { OpPrtDst = dst }(OpPrtDst)
+	OpPrtDst = ioutil.Discard.Write
+	for _, it := range testCases(t) {
+		src, err := ioutil.ReadFile(it.SrcFilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := testEvalMain(LoadFromJson(src), &it, EngineInterp)
+		for _, engine := range testEngines[1:] {
+			prog := LoadFromJson(src)
+			var wait sync.WaitGroup
+			got := make([]string, runtime.GOMAXPROCS(0)+1)
+			for i := range got {
+				wait.Add(1)
+				go func(i int) {
+					defer wait.Done()
+					got[i] = testEvalMain(prog, &it, engine.engine)
+				}(i)
+			}
+			wait.Wait()
+			for i := range got {
+				if got[i] != want {
+					t.Errorf("%s with %s in goroutine %d: expected %s, got %s", it.SrcFilePath, engine.name, i, want, got[i])
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkEngines evaluates the main `FuncDef` of each of the `testCases`
+// (without `stdin` handling) with every `Engine`.
+func BenchmarkEngines(b *testing.B) {
+	olddst := OpPrtDst
+	OpPrtDst = ioutil.Discard.Write
+	defer func() { OpPrtDst = olddst }()
+	for _, it := range testCases(b) {
+		src, err := ioutil.ReadFile(it.SrcFilePath)
+		if err != nil {
+			b.Fatal(err)
+		}
+		prog := LoadFromJson(src)
+		for _, engine := range testEngines {
+			eval := func() {
+				defer func() {
+					if thrown := recover(); thrown != nil {
+						if _, ok := thrown.(ErrUser); !ok { // `OpErr` failures are expected outputs, too
+							panic(thrown)
+						}
+					}
+				}()
+				_ = prog.Eval(&ExprCall{Callee: ExprFuncRef(len(prog) - 1), Args: []Expr{ListsFrom(it.Env), ListsFrom(it.Args)}}, false, EvalWith(engine.engine))
+			}
+			b.Run(filepath.Base(it.SrcFilePath)+"/"+engine.name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					eval()
+				}
+			})
+		}
+	}
+}
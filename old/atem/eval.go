@@ -27,13 +27,27 @@ import (
 // Put simply, `true` is for full-program running, `false` is for smallish
 // "drive-by" / "side-car" expression evaluation attempts in the context of a
 // given `Prog` such as in REPLs, optimizers, compilers or similar tooling.
-func (me Prog) Eval(expr Expr, big bool) Expr {
-	maxFrames, maxStash, numSteps = 0, 0, 0
+//
+// The above describes the default `EngineInterp`, for others see `EvalWith`.
+func (me Prog) Eval(expr Expr, big bool, opts ...EvalOption) Expr {
+	var options evalOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
 	capframes := 64
-	if big {
-		capframes = 32 * 1024
+	if big { // only then are the stats reset (and reported, see below), so that other (such as concurrent non-`EngineInterp`) evaluations don't race on them
+		capframes, maxFrames, maxStash, numSteps = 32*1024, 0, 0, 0
+	}
+	var ret Expr
+	t := time.Now().UnixNano()
+	switch options.engine {
+	case EngineInterp:
+		ret, t = me.eval(expr, capframes)
+	case EngineClosures, EngineBytecode, EngineLazy, EngineParallel:
+		ret = me.evalCompiled(expr, options.engine)
+	default:
+		panic(options.engine)
 	}
-	ret, t := me.eval(expr, capframes)
 	t = time.Now().UnixNano() - t
 	if big {
 		println(fmt.Sprintf("%T", ret), time.Duration(t).String(), "\t\t\t", maxFrames, maxStash, numSteps, "\t\t", count1, count2, count3, count4)
@@ -41,6 +55,54 @@ func (me Prog) Eval(expr Expr, big bool) Expr {
 	return ret
 }
 
+// Engine denotes one of the available implementations of `Prog.Eval`, all
+// producing identical results (including `OpPrt` outputs and their order,
+// except for `EngineLazy`).
+type Engine int
+
+const (
+	// EngineInterp is the default: the call-stack machine described for `Prog.Eval`.
+	EngineInterp Engine = iota
+	// EngineClosures compiles all `FuncDef.Body`s once, on the first evaluation,
+	// into Go closures with resolved arg slots, instead of re-interpreting the
+	// `Expr` trees on every call. Any later modifications of a `FuncDef.Body` will
+	// thus not be seen by `EngineClosures` evaluations of the same `Prog`.
+	EngineClosures
+	// EngineBytecode compiles all `FuncDef.Body`s once, on the first evaluation,
+	// into `BytecodeFunc`s to then run in a small stack VM, see `BytecodeSpec`. As
+	// with `EngineClosures`, later `FuncDef.Body` modifications are not seen.
+	EngineBytecode
+	// EngineLazy evaluates call-by-need, rather than "mostly eager-ish": call
+	// args are passed on unevaluated (as thunks, updated in place once forced)
+	// even to `FuncDef`s using them, so that closure values can hold infinite
+	// structures such as endless lists, only ever evaluated as far as consumed.
+	// Only the final result (and any prim-op operands) are forced entirely,
+	// such that effect-free programs terminating under the other `Engine`s
+	// yield the very same results. (`OpPrt` outputs may differ in order and,
+	// as fewer calls overall get evaluated, also in number.)
+	EngineLazy
+	// EngineParallel is `EngineClosures` but evaluating the args of saturated
+	// calls (of prim-ops or non-selector `FuncDef`s) concurrently, in up to
+	// `GOMAXPROCS` goroutines at a time, where at least two of them are costly
+	// (see `ParallelMinArgCost`) and statically known to never reach `OpPrt`,
+	// `OpEval` or `OpErr`. All are joined, in order, before the callee runs, so
+	// results remain identical. All `FuncDef`s get compiled on the first
+	// evaluation.
+	EngineParallel
+)
+
+// EvalOption customizes a `Prog.Eval` call, such as via `EvalWith`.
+type EvalOption func(*evalOptions)
+
+type evalOptions struct {
+	engine Engine
+}
+
+// EvalWith selects the `Engine` to run a `Prog.Eval` call with.
+func EvalWith(engine Engine) EvalOption {
+	return func(opts *evalOptions) { opts.engine = engine }
+}
+
 var maxFrames int
 var maxStash int
 var numSteps int
@@ -155,7 +217,17 @@ restep:
 					cur.numArgs, cur.pos = 0, len(cur.stash)-1
 					goto restep
 				}
-				if cur.numArgs == 0 { // no args means a shared global constant:
+				if cur.numArgs == 0 && me[it].memoize { // a memoized shared global constant: unroll if closure, as below
+					value := me.memoized(it, EngineInterp)
+					if closure, isclosure := value.(*ExprCall); isclosure {
+						cur.stash = append(append(cur.stash[:idxcallee], closure.Args...), closure.Callee)
+						numargsdone += len(closure.Args)
+					} else {
+						cur.stash[idxcallee] = value
+					}
+					cur.pos = len(cur.stash) - 1
+					goto restep
+				} else if cur.numArgs == 0 { // no args means a shared global constant:
 					call, _ := me[it].Body.(*ExprCall) // also means *ExprCall because others were caught during post-load pre-processing
 					cur.stash = append(append(cur.stash[:idxcallee], call.Args...), call.Callee)
 					if cur.pos = len(cur.stash) - 1; call.IsClosure == 0 {
@@ -182,42 +254,7 @@ restep:
 			if isfn { // substitution
 				result = me[it].Body
 			} else { // prim-op instruction code: consume left-hand-side and right-hand-side operands
-				lhs, rhs := cur.stash[len(cur.stash)-2], cur.stash[len(cur.stash)-3]
-				switch OpCode(it) {
-				case OpAdd:
-					result = lhs.(ExprNumInt) + rhs.(ExprNumInt)
-				case OpSub:
-					result = lhs.(ExprNumInt) - rhs.(ExprNumInt)
-				case OpMul:
-					result = lhs.(ExprNumInt) * rhs.(ExprNumInt)
-				case OpDiv:
-					result = lhs.(ExprNumInt) / rhs.(ExprNumInt)
-				case OpMod:
-					result = lhs.(ExprNumInt) % rhs.(ExprNumInt)
-				case OpGt:
-					if result = StdFuncFalse; lhs.(ExprNumInt) > rhs.(ExprNumInt) {
-						result = StdFuncTrue
-					}
-				case OpLt:
-					if result = StdFuncFalse; lhs.(ExprNumInt) < rhs.(ExprNumInt) {
-						result = StdFuncTrue
-					}
-				case OpEq:
-					if result = StdFuncFalse; Eq(lhs, rhs) {
-						result = StdFuncTrue
-					}
-				case OpPrt:
-					result = rhs
-					_, _ = OpPrtDst(append(append(append(ListToBytes(ListOfExprs(lhs)), '\t'), ListOfExprsToString(rhs)...), '\n'))
-				case OpEval:
-					prog, jsonprog, jsonexpr := me, decodeJsonishProgForOpEval(lhs), decodeJsonishExprForOpEval(rhs)
-					if jsonprog != nil {
-						prog = loadFromJson(jsonprog)
-					}
-					result, _ = prog.eval(exprFromJson(jsonexpr, 0), 128)
-				default:
-					panic([3]Expr{it, lhs, rhs})
-				}
+				result = me.opResult(it, cur.stash[len(cur.stash)-2], cur.stash[len(cur.stash)-3], EngineInterp)
 			}
 			cur.calleeDone, cur.stash[idxcallee] = true, result
 			goto restep // whatever we got here now, reduce it further until no longer reducible
@@ -261,3 +298,49 @@ restep:
 allDoneThusReturn:
 	return frames[0].stash[0], starttime
 }
+
+// opResult performs the prim-op `op` on the operands (already evaluated).
+func (me Prog) opResult(op ExprFuncRef, lhs Expr, rhs Expr, engine Engine) (result Expr) {
+	switch OpCode(op) {
+	case OpAdd:
+		result = lhs.(ExprNumInt) + rhs.(ExprNumInt)
+	case OpSub:
+		result = lhs.(ExprNumInt) - rhs.(ExprNumInt)
+	case OpMul:
+		result = lhs.(ExprNumInt) * rhs.(ExprNumInt)
+	case OpDiv:
+		result = lhs.(ExprNumInt) / rhs.(ExprNumInt)
+	case OpMod:
+		result = lhs.(ExprNumInt) % rhs.(ExprNumInt)
+	case OpGt:
+		if result = StdFuncFalse; lhs.(ExprNumInt) > rhs.(ExprNumInt) {
+			result = StdFuncTrue
+		}
+	case OpLt:
+		if result = StdFuncFalse; lhs.(ExprNumInt) < rhs.(ExprNumInt) {
+			result = StdFuncTrue
+		}
+	case OpEq:
+		if result = StdFuncFalse; Eq(lhs, rhs) {
+			result = StdFuncTrue
+		}
+	case OpPrt:
+		result = rhs
+		_, _ = OpPrtDst(append(append(append(ListToBytes(ListOfExprs(lhs)), '\t'), ListOfExprsToString(rhs)...), '\n'))
+	case OpEval:
+		prog, jsonprog, jsonexpr := me, decodeJsonishProgForOpEval(lhs), decodeJsonishExprForOpEval(rhs)
+		if jsonprog != nil {
+			prog = loadFromJson(jsonprog)
+		}
+		if expr := exprFromJson(jsonexpr, 0); engine != EngineInterp {
+			result = prog.evalCompiled(expr, engine)
+		} else {
+			result, _ = prog.eval(expr, 128)
+		}
+	case OpErr:
+		panic(ErrUser{lhs, rhs})
+	default:
+		panic(fmt.Sprintf("unknown op-code %d", op))
+	}
+	return
+}
@@ -0,0 +1,246 @@
+// Package golden runs atem programs in-process against golden files of their
+// expected outputs, for both `atem test` and Go tests.
+//
+// Every `*.json` file (other than `*.prov.json` ones) in a directory is a
+// program to run, with optional side-car files named the same except for
+// their extension replacing `.json`:
+//
+// - `.args`: the process args to pass to the main `FuncDef`, one per line
+// - `.env`: the env vars to pass to the main `FuncDef`, one `NAME=Value` per line
+// - `.stdin`: the input to feed to its `stdin` handler, if it has one
+// - `.expected`: the golden output, as last written by `Update`
+//
+// Programs are run by the same conventions as `atem` itself does (see there),
+// except that none of the actual process args, env vars or `stdin` are used.
+// Their output combines, in order of writing, everything `atem` would write to
+// `stdout` and `stderr`, including `atem.OpPrt` outputs and failure messages.
+package golden
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/metaleap/atmo/old/atem"
+	"github.com/metaleap/atmo/old/atem/pretty"
+)
+
+// Case is a program found by `Discover`, along with its side-car files.
+type Case struct {
+	SrcFilePath string
+	Args        []string
+	Env         []string
+	Stdin       []byte
+	// Expected is `nil` if there is no `.expected` file yet.
+	Expected []byte
+}
+
+// T is the subset of `*testing.T` used by `Check`.
+type T interface {
+	Helper()
+	Errorf(string, ...interface{})
+}
+
+// Discover finds all programs in `dir` and reads their side-car files.
+func Discover(dir string) (ret []Case, err error) {
+	var srcfilepaths []string
+	if srcfilepaths, err = filepath.Glob(filepath.Join(dir, "*.json")); err == nil {
+		for _, srcfilepath := range srcfilepaths {
+			if !strings.HasSuffix(srcfilepath, ".prov.json") {
+				it := Case{SrcFilePath: srcfilepath}
+				if err = it.readSideCars(); err != nil {
+					return nil, err
+				}
+				ret = append(ret, it)
+			}
+		}
+	}
+	return
+}
+
+func (me *Case) readSideCars() error {
+	for ext, dst := range map[string]*[]byte{".stdin": &me.Stdin, ".expected": &me.Expected} {
+		if data, err := ioutil.ReadFile(me.SideCarFilePath(ext)); err == nil {
+			*dst = data
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for ext, dst := range map[string]*[]string{".args": &me.Args, ".env": &me.Env} {
+		if data, err := ioutil.ReadFile(me.SideCarFilePath(ext)); err == nil {
+			*dst = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// SideCarFilePath returns the path of the side-car file with extension `ext`.
+func (me *Case) SideCarFilePath(ext string) string {
+	return strings.TrimSuffix(me.SrcFilePath, ".json") + ext
+}
+
+// Run loads and runs the program with `engine`, returning its output. The
+// `err` is only non-`nil` if it could not be loaded or panicked other than by
+// failing via `atem.OpErr` (whose `atem.ErrUser` message goes into the
+// `output`). During the run, `atem.OpPrtDst` is redirected, so `Run`s must not
+// overlap.
+func (me *Case) Run(engine atem.Engine) (output []byte, err error) {
+	var buf bytes.Buffer
+	olddst := atem.OpPrtDst
+	atem.OpPrtDst = buf.Write
+	defer func() {
+		atem.OpPrtDst = olddst
+		if thrown := recover(); thrown != nil {
+			if fail, ok := thrown.(atem.ErrUser); ok {
+				buf.WriteString(fail.Error() + "\n")
+			} else {
+				err = fmt.Errorf("%s: %v", me.SrcFilePath, thrown)
+			}
+		}
+		output = buf.Bytes()
+	}()
+
+	src, err := ioutil.ReadFile(me.SrcFilePath)
+	if err != nil {
+		return nil, err
+	}
+	prog := atem.LoadFromJson(src)
+	if len(prog[len(prog)-1].Args) != 2 {
+		return nil, errors.New(me.SrcFilePath + ": main FuncDef needs exactly 2 Args")
+	}
+	eval := func(callee atem.Expr, args ...atem.Expr) (ret atem.Expr, retList []atem.Expr) {
+		ret = prog.Eval(&atem.ExprCall{Callee: callee, Args: args}, false, atem.EvalWith(engine)) // not `big`, which `println`s timings not belonging to `output`
+		return ret, atem.ListOfExprs(ret)
+	}
+	outexpr, outlist := eval(atem.ExprFuncRef(len(prog)-1), atem.ListsFrom(me.Env), atem.ListsFrom(me.Args))
+	if outbytes := atem.ListToBytes(outlist); outbytes != nil {
+		buf.Write(append(outbytes, '\n'))
+	} else if fnhandler, sepchar, state, initialoutput := stdinHandler(prog, outlist); initialoutput == nil {
+		buf.WriteString("RET-EXPR:\t" + pretty.Print(prog, outexpr) + "\n")
+	} else {
+		inputs := [][]byte{me.Stdin}
+		if sepchar != 0 {
+			if inputs = bytes.Split(me.Stdin, []byte{byte(sepchar)}); len(inputs[len(inputs)-1]) == 0 {
+				inputs = inputs[:len(inputs)-1]
+			}
+		}
+		buf.Write(initialoutput)
+		for _, input := range inputs {
+			retexpr, retlist := eval(fnhandler, atem.ListFrom(input), state)
+			if len(retlist) != 2 {
+				panic(retexpr.JsonSrc())
+			} else if outlist := atem.ListOfExprs(retlist[1]); outlist != nil {
+				buf.Write(atem.ListToBytes(outlist))
+			} else {
+				buf.WriteString("RET-EXPR:\t" + pretty.Print(prog, retlist[1]) + "\n")
+			}
+			if state = retlist[0]; state == atem.StdFuncId {
+				break
+			}
+		}
+	}
+	return
+}
+
+// stdinHandler dissects `retList` as per the `atem` `stdin` handler
+// convention, with `initialOutput` being `nil` if it doesn't match.
+func stdinHandler(prog atem.Prog, retList []atem.Expr) (fnHandler atem.ExprFuncRef, sepChar atem.ExprNumInt, initialState atem.Expr, initialOutput []byte) {
+	if len(retList) == 4 {
+		var okf, oks bool
+		if fnHandler, okf = retList[0].(atem.ExprFuncRef); okf && fnHandler > atem.StdFuncCons && int(fnHandler) < len(prog)-1 && len(prog[fnHandler].Args) == 2 {
+			if sepChar, oks = retList[1].(atem.ExprNumInt); oks && sepChar > -1 && sepChar < 256 {
+				if initialOutput = atem.ListToBytes(atem.ListOfExprs(retList[3])); initialOutput != nil {
+					initialState = retList[2]
+				}
+			}
+		}
+	}
+	return
+}
+
+// Diff returns a line-based diff of `want` and `got`: `-` lines only in the
+// former, `+` lines only in the latter, and ` ` lines in both. It returns ""
+// if they are identical.
+func Diff(want []byte, got []byte) string {
+	if bytes.Equal(want, got) {
+		return ""
+	}
+	a, b := strings.SplitAfter(string(want), "\n"), strings.SplitAfter(string(got), "\n")
+	lcs := make([][]int, len(a)+1) // lcs[i][j]: length of longest common subsequence of a[i:] and b[j:]
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i][j] = lcs[i+1][j]; lcs[i][j+1] > lcs[i][j] {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var buf strings.Builder
+	line := func(prefix string, text string) {
+		if text != "" {
+			buf.WriteString(prefix + strings.TrimSuffix(text, "\n") + "\n")
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i] == b[j] {
+			line(" ", a[i])
+			i, j = i+1, j+1
+		} else if lcs[i+1][j] >= lcs[i][j+1] {
+			line("-", a[i])
+			i++
+		} else {
+			line("+", b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		line("-", a[i])
+	}
+	for ; j < len(b); j++ {
+		line("+", b[j])
+	}
+	return buf.String()
+}
+
+// Update runs `me` and (re)writes its `.expected` file with the output.
+func (me *Case) Update(engine atem.Engine) error {
+	output, err := me.Run(engine)
+	if err == nil {
+		if err = ioutil.WriteFile(me.SideCarFilePath(".expected"), output, 0644); err == nil {
+			me.Expected = output
+		}
+	}
+	return err
+}
+
+// Check runs all programs in `dir` that have `.expected` files, failing `t`
+// for each whose output differs (or that fails to run). For use in Go tests:
+//
+//	func TestGolden(t *testing.T) { golden.Check(t, "tmpdummies", atem.EngineInterp) }
+func Check(t T, dir string, engine atem.Engine) {
+	t.Helper()
+	cases, err := Discover(dir)
+	if err != nil {
+		t.Errorf("%v", err)
+	}
+	for i := range cases {
+		if cases[i].Expected != nil {
+			if output, err := cases[i].Run(engine); err != nil {
+				t.Errorf("%v", err)
+			} else if diff := Diff(cases[i].Expected, output); diff != "" {
+				t.Errorf("%s: output differs from %s:\n%s", cases[i].SrcFilePath, cases[i].SideCarFilePath(".expected"), diff)
+			}
+		}
+	}
+}
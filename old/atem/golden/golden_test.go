@@ -0,0 +1,9 @@
+package golden
+
+import (
+	"testing"
+
+	"github.com/metaleap/atmo/old/atem"
+)
+
+func TestGolden(t *testing.T) { Check(t, "../tmpdummies", atem.EngineInterp) }
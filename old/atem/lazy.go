@@ -0,0 +1,151 @@
+package atem
+
+// exprLazy is an `EngineLazy` thunk: a not-yet-evaluated call `expr` over the
+// `args` of the `FuncDef` call it occurred in. Once forced, it is updated in
+// place to hold its `value` instead, shared by all holders of the thunk.
+// Unlike `exprThunk`s, these do occur inside closure values during `EngineLazy`
+// evaluations, but never in the `Prog.Eval` results (see `lazyDeep`).
+type exprLazy struct {
+	expr  Expr
+	args  []Expr
+	value Expr
+}
+
+// JsonSrc implements the `Expr` interface.
+func (me *exprLazy) JsonSrc() string {
+	if me.value != nil {
+		return me.value.JsonSrc()
+	}
+	return "null"
+}
+
+func (me Prog) evalLazy(expr Expr) Expr {
+	return me.lazyDeep(me.lazyApply(me.lazyEval(expr, nil), nil)) // the root `expr` is in callee position
+}
+
+// lazyForce evaluates `expr`, if a thunk, to weak head normal form: a number,
+// a func-ref or a closure value whose args may still be thunks.
+func (me Prog) lazyForce(expr Expr) Expr {
+	if thunk, ok := expr.(*exprLazy); ok {
+		if thunk.value == nil {
+			thunk.value = me.lazyEval(thunk.expr, thunk.args)
+			thunk.expr, thunk.args = nil, nil // no longer needed, so let go of them
+		}
+		return thunk.value
+	}
+	return expr
+}
+
+// lazyDeep forces all thunks in `expr`, the only place where infinite
+// structures would make `EngineLazy` run forever: like all other `Engine`s.
+func (me Prog) lazyDeep(expr Expr) Expr {
+	if expr = me.lazyForce(expr); expr != nil {
+		if closure, ok := expr.(*ExprCall); ok {
+			var args []Expr
+			for i, arg := range closure.Args {
+				if deep := me.lazyDeep(arg); deep != arg && args == nil {
+					args = make([]Expr, len(closure.Args))
+					copy(args, closure.Args[:i])
+					args[i] = deep
+				} else if args != nil {
+					args[i] = deep
+				}
+			}
+			if args != nil { // never modify in place: closures may be literals in `FuncDef` `Body`s
+				return &ExprCall{IsClosure: closure.IsClosure, Callee: closure.Callee, Args: args}
+			}
+		}
+	}
+	return expr
+}
+
+// lazyEval evaluates `expr` (of the `FuncDef` `Body` being called with
+// `args`) to weak head normal form, as does `lazyForce`. Call args are not
+// evaluated but passed on as thunks, with arg-refs sharing the caller's ones.
+func (me Prog) lazyEval(expr Expr, args []Expr) Expr {
+	switch it := expr.(type) {
+	case ExprArgRef:
+		return me.lazyForce(args[int(-it)-2])
+	case *ExprCall:
+		if it.IsClosure == 0 {
+			callargs := make([]Expr, len(it.Args))
+			for i, arg := range it.Args {
+				switch arg := arg.(type) {
+				case ExprArgRef:
+					callargs[len(it.Args)-1-i] = args[int(-arg)-2]
+				case *ExprCall:
+					if arg.IsClosure == 0 {
+						callargs[len(it.Args)-1-i] = &exprLazy{expr: arg, args: args}
+						continue
+					}
+					callargs[len(it.Args)-1-i] = arg
+				default:
+					callargs[len(it.Args)-1-i] = arg
+				}
+			}
+			return me.lazyApply(me.lazyEval(it.Callee, args), callargs)
+		}
+	}
+	return expr // nums, func-refs, closures: already values
+}
+
+// lazyApply calls `callee` (in callee position, so forcing nullary func-refs)
+// with `args` (in call order, thunks or values) as `apply` does, except that
+// no args are ever evaluated just for being passed to a `FuncDef`: only those
+// actually consumed by its `Body` (or by prim-ops) are, once forced.
+func (me Prog) lazyApply(callee Expr, args []Expr) Expr {
+	for {
+		switch it := me.lazyForce(callee).(type) {
+		case *ExprCall:
+			if len(args) == 0 {
+				return it
+			}
+			closureargs := make([]Expr, len(it.Args), len(it.Args)+len(args))
+			for i := range it.Args {
+				closureargs[len(it.Args)-1-i] = it.Args[i]
+			}
+			callee, args = it.Callee, append(closureargs, args...)
+		case ExprFuncRef:
+			arity, usage := 2, []int(nil)
+			if it >= 0 {
+				if arity, usage = len(me[it].Args), me[it].Args; arity == 0 && me[it].memoize {
+					callee = me.memoized(it, EngineLazy)
+					continue
+				} else if arity == 0 { // a shared global constant: its `Body` takes the callee position
+					callee = me.lazyEval(me[it].Body, nil)
+					continue
+				}
+			}
+			if len(args) == 0 {
+				return it
+			}
+			for i := 0; i < arity && i < len(args); i++ {
+				if usage != nil && usage[i] == 0 { // as in `apply`: for identical closure values
+					args[i] = nil
+				}
+			}
+			if len(args) < arity {
+				closure := &ExprCall{IsClosure: arity - len(args), Callee: it, Args: make([]Expr, len(args))}
+				for i := range args {
+					closure.Args[len(args)-1-i] = args[i]
+				}
+				return closure
+			}
+			var result Expr
+			if it < 0 { // prim-ops may well inspect entire structures, such as `OpEq`, `OpPrt`, `OpEval`
+				result = me.opResult(it, me.lazyDeep(args[0]), me.lazyDeep(args[1]), EngineLazy)
+			} else {
+				result = me.lazyEval(me[it].Body, args[:arity:arity])
+			}
+			if args = args[arity:]; len(args) == 0 {
+				return result
+			}
+			callee = result
+		default:
+			if len(args) == 0 {
+				return it
+			}
+			panic(it) // not callable
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package atem_test
+
+import (
+	"testing"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+// testLazyProg has `[5]nats n` for the infinite list `n, n+1, n+2, …`, `[6]take
+// n list` (via `[7]takeLink`) for the first `n` items of `list` and a nullary
+// `main` with the given `mainBody`.
+func testLazyProg(mainBody string) Prog {
+	return LoadFromJson([]byte(`[ [ ["[0]std.same","it"], [1], "0" ]
+, [ ["[1]std.True","t","f"], [1,0], "0" ]
+, [ ["[2]std.False","t","f"], [0,1], "1" ]
+, [ ["[3]std.ListEnd","e","l"], [1,0], "0" ]
+, [ ["[4]std.ListLink","h","t","e","l"], [1,1,0,1], ["3", "0", "1"] ]
+, [ ["[5]nats","n"], [2], [[4], "0", [[5], [[-1], "0", 1]]] ]
+, [ ["[6]take","n","list"], [2,1], [[-6], "0", 0, [3], ["1", [3], [[7], "0"]]] ]
+, [ ["[7]takeLink","n","head","tail"], [1,1,1], [[4], "1", [[6], [[-2], "0", 1], "2"]] ]
+, [ ["main"], [], ` + mainBody + ` ]
+]`))
+}
+
+// TestLazyInfiniteList takes a finite prefix of an infinite list, which only
+// `EngineLazy` does: the strict engines never get done building said list, so
+// aren't run on it (but do have to agree on the same prefix of a finite list).
+func TestLazyInfiniteList(t *testing.T) {
+	want := ListFrom([]byte{0, 1, 2}).JsonSrc()
+	for _, engine := range testEngines {
+		prog := testLazyProg(`[[6], 3, [[4], 0, [[4], 1, [[4], 2, [[4], 3, [3]]]]]]`)
+		if got := prog.Eval(ExprFuncRef(len(prog)-1), false, EvalWith(engine.engine)).JsonSrc(); got != want {
+			t.Errorf("finite list with %s: expected %s, got %s", engine.name, want, got)
+		}
+	}
+
+	prog := testLazyProg(`[[6], 3, [[5], 0]]`)
+	if got := prog.Eval(ExprFuncRef(len(prog)-1), false, EvalWith(EngineLazy)).JsonSrc(); got != want {
+		t.Errorf("infinite list with lazy: expected %s, got %s", want, got)
+	}
+}
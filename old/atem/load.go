@@ -2,6 +2,7 @@ package atem
 
 import (
 	"encoding/json"
+	"fmt"
 	"strconv"
 )
 
@@ -44,6 +45,53 @@ func LoadFromJson(src []byte) Prog {
 	return loadFromJson(arr)
 }
 
+// ExprFromJson parses and decodes a JSON `src` into a single `Expr` in the
+// context of `me`, in the same format as a `FuncDef` `body` for `LoadFromJson`,
+// except that no `ExprArgRef`s can occur. It is meant for "side-car" uses of
+// `Prog.Eval` such as REPLs. A `panic` occurs on any sort of error. The result
+// is already `ExprPrep`ared.
+func (me Prog) ExprFromJson(src []byte) Expr {
+	var it any
+	if e := json.Unmarshal(src, &it); e != nil {
+		panic(e)
+	}
+	var walk func(any)
+	walk = func(from any) {
+		switch it := from.(type) {
+		case string:
+			panic("ExprFromJson: encountered ExprArgRef of " + strconv.Quote(it) + " outside of any FuncDef")
+		case []any:
+			for _, sub := range it {
+				walk(sub)
+			}
+		}
+	}
+	walk(it)
+	return me.ExprPrep(exprFromJson(it, 0))
+}
+
+// ExprPrep applies to `expr`, constructed in the context of `me` other than by
+// `LoadFromJson` (eg. in REPLs), the same post-load fixups that the latter
+// applies to all `FuncDef` bodies: the pre-reduction of refs to mere aliases
+// and the marking of closures as per `ExprCall.IsClosure`. As for
+// `ExprFromJson`, a `panic` occurs if `expr` contains any `ExprArgRef`s.
+func (me Prog) ExprPrep(expr Expr) Expr {
+	var walk func(Expr)
+	walk = func(expr Expr) {
+		switch it := expr.(type) {
+		case ExprArgRef:
+			panic("ExprPrep: encountered ExprArgRef of " + it.JsonSrc() + " outside of any FuncDef")
+		case *ExprCall:
+			walk(it.Callee)
+			for _, arg := range it.Args {
+				walk(arg)
+			}
+		}
+	}
+	walk(expr)
+	return me.detectAndMarkClosures(expr)
+}
+
 func loadFromJson(arr [][]interface{}) Prog {
 	me := make(Prog, 0, len(arr))
 	for _, it := range arr {
@@ -85,7 +133,12 @@ func exprFromJson(from any, curFnNumArgs int64) Expr {
 		}
 	case []any:
 		if len(it) == 1 { // func-ref literal
-			return ExprFuncRef(int(it[0].(float64)))
+			if n, ok := it[0].(float64); ok {
+				return ExprFuncRef(int(n))
+			}
+			panic("LoadFromJson: expected a number in func-ref literal, got " + strconv.Quote(fmt.Sprintf("%v", it[0])))
+		} else if len(it) == 0 {
+			panic("LoadFromJson: encountered empty ExprCall")
 		}
 		callee, args := exprFromJson(it[0], curFnNumArgs), make([]Expr, 0, len(it))
 		for i := len(it) - 1; i > 0; i-- {
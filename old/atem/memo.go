@@ -0,0 +1,72 @@
+package atem
+
+import (
+	"sync"
+)
+
+// MetaNoMemo, if among a nullary `FuncDef`'s `Meta` strings, opts it out of
+// `Prog.Memoize`: as should be done by code emitters for all those `FuncDef`s
+// whose evaluation performs `OpPrt` side effects meant to happen on every use.
+const MetaNoMemo = "nomemo"
+
+// memosMu guards all `FuncDef.memo`s of all `Prog`s.
+var memosMu sync.RWMutex
+
+// Memoize enables (or disables) for all nullary `FuncDef`s in `me` (except those
+// marked with `MetaNoMemo`) that their `Body` is fully evaluated only once,
+// upon first being reached in callee position, with the resulting value then
+// being reused by all later `Prog.Eval`s (with any `Engine`) of `me` instead of
+// expanding the `Body` anew every time. Evaluations running concurrently may
+// share these memos safely, but `Memoize` must not be called during any.
+func (me Prog) Memoize(enable bool) {
+	for i := range me {
+		me[i].memoize = enable && len(me[i].Args) == 0 && !me[i].hasMeta(MetaNoMemo)
+	}
+	if !enable {
+		me.ClearMemos()
+	}
+}
+
+// ClearMemos discards all values memoized so far via `Prog.Memoize`, such as
+// to free their memory or when an `OpEval` or the host app changed conditions
+// that any nullary `FuncDef` evaluations might depend on.
+func (me Prog) ClearMemos() {
+	memosMu.Lock()
+	for i := range me {
+		me[i].memo = nil
+	}
+	memosMu.Unlock()
+}
+
+// memoized returns the memoized value of the nullary `FuncDef` at `fn`,
+// evaluating its `Body` first if not done before. When that happens in
+// concurrent evaluations at the same time, the first to finish prevails.
+func (me Prog) memoized(fn ExprFuncRef, engine Engine) (ret Expr) {
+	memosMu.RLock()
+	ret = me[fn].memo
+	memosMu.RUnlock()
+	if ret == nil {
+		if engine == EngineInterp {
+			ret, _ = me.eval(me[fn].Body, 64)
+		} else {
+			ret = me.evalCompiled(me[fn].Body, engine)
+		}
+		memosMu.Lock()
+		if me[fn].memo == nil {
+			me[fn].memo = ret
+		} else {
+			ret = me[fn].memo
+		}
+		memosMu.Unlock()
+	}
+	return
+}
+
+func (me *FuncDef) hasMeta(meta string) bool {
+	for _, it := range me.Meta {
+		if it == meta {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package atem_test
+
+import (
+	"testing"
+
+	. "github.com/metaleap/atmo/old/atem"
+)
+
+// TestMemoize counts the `OpPrt`s of `[5]loud` and (marked `MetaNoMemo`)
+// `[6]quiet`, each called twice per evaluation, for every `Engine`.
+func TestMemoize(t *testing.T) {
+	defer func(dst func([]byte) (int, error)) { OpPrtDst = dst }(OpPrtDst)
+	var numprts int
+	OpPrtDst = func(out []byte) (int, error) {
+		numprts++
+		return len(out), nil
+	}
+	for _, engine := range testEngines {
+		prog := LoadFromJson([]byte(`[ [ ["[0]std.same","it"], [1], "0" ]
+, [ ["[1]std.True","t","f"], [1,0], "0" ]
+, [ ["[2]std.False","t","f"], [0,1], "1" ]
+, [ ["[3]std.ListEnd","e","l"], [1,0], "0" ]
+, [ ["[4]std.ListLink","h","t","e","l"], [1,1,0,1], ["3", "0", "1"] ]
+, [ ["[5]loud"], [], [[-42], 0, [0]] ]
+, [ ["[6]quiet", "` + MetaNoMemo + `"], [], [[-42], 0, [0]] ]
+]`))
+		eval := func(fn ExprFuncRef, wantPrts int) {
+			numprts = 0
+			twice := &ExprCall{Callee: ExprFuncRef(OpAdd), Args: []Expr{&ExprCall{Callee: fn, Args: []Expr{ExprNumInt(1)}}, &ExprCall{Callee: fn, Args: []Expr{ExprNumInt(2)}}}}
+			if got := prog.Eval(twice, false, EvalWith(engine.engine)).JsonSrc(); got != "3" {
+				t.Errorf("%s: %v: expected 3, got %s", engine.name, prog[fn].Meta, got)
+			}
+			if numprts != wantPrts {
+				t.Errorf("%s: %v: expected %d OpPrts, got %d", engine.name, prog[fn].Meta, wantPrts, numprts)
+			}
+		}
+
+		eval(5, 2) // not memoized yet
+		prog.Memoize(true)
+		eval(5, 1) // the 2nd call reuses the memo of the 1st
+		eval(5, 0) // both reuse the memo of the previous `Eval`
+		eval(6, 2) // `MetaNoMemo`, so never memoized
+		prog.ClearMemos()
+		eval(5, 1)
+		prog.Memoize(false)
+		eval(5, 2)
+	}
+}
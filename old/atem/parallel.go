@@ -0,0 +1,251 @@
+package atem
+
+import (
+	"runtime"
+	"sync"
+)
+
+// ParallelMinArgCost is the estimated evaluation cost from which on a call arg
+// is considered worth evaluating in its own goroutine by `EngineParallel`. The
+// cost of an arg is the size of its `Expr` tree, except that any reference to
+// a recursive `FuncDef` alone already meets this threshold.
+var ParallelMinArgCost = 32
+
+// parallelSlots bounds the number of goroutines spawned by `EngineParallel`
+// evaluations and not yet done, across all `Prog`s, to `GOMAXPROCS`.
+var parallelSlots chan struct{}
+var parallelSlotsInit sync.Once
+
+// parallelPrepMu guards `prepParallel`, so that concurrent first `Prog.Eval`s
+// with `EngineParallel` of the same `Prog` don't race in preparing it.
+var parallelPrepMu sync.Mutex
+
+// parallelArg is a call arg being evaluated in its own goroutine.
+type parallelArg struct {
+	done   chan struct{}
+	result Expr
+	thrown interface{}
+}
+
+// prepParallel compiles all `FuncDef`s for `EngineParallel` (unless done so
+// before), after first determining which ones are recursive and which ones
+// might (transitively) perform `OpPrt`, `OpEval` or `OpErr`. The latter also
+// applies to all `FuncDef`s calling any arg or call result whenever any such
+// effectful callables are referenced as values (rather than callees) anywhere
+// in `me`.
+func (me Prog) prepParallel() {
+	parallelSlotsInit.Do(func() { parallelSlots = make(chan struct{}, runtime.GOMAXPROCS(0)) })
+	parallelPrepMu.Lock()
+	defer parallelPrepMu.Unlock()
+	if len(me) == 0 || me[0].parallel != nil {
+		return
+	}
+
+	refs, direct, dynamic, valuerefs := make([][]ExprFuncRef, len(me)), make([]bool, len(me)), make([]bool, len(me)), []ExprFuncRef{}
+	for i := range me {
+		var walk func(Expr, bool)
+		walk = func(expr Expr, isCallee bool) {
+			switch it := expr.(type) {
+			case ExprFuncRef:
+				if refs[i] = append(refs[i], it); opHasEffects(it) {
+					direct[i] = true
+				}
+				if !isCallee {
+					valuerefs = append(valuerefs, it)
+				}
+			case *ExprCall:
+				if !me.callIsStatic(it) {
+					dynamic[i] = true
+				}
+				walk(it.Callee, it.IsClosure == 0)
+				for _, arg := range it.Args {
+					walk(arg, false)
+				}
+			}
+		}
+		walk(me[i].Body, false)
+	}
+
+	reach := func(from int) []bool {
+		seen, todo := make([]bool, len(me)), []int{from}
+		for len(todo) > 0 {
+			cur := todo[len(todo)-1]
+			todo = todo[:len(todo)-1]
+			for _, fn := range refs[cur] {
+				if fn >= 0 && !seen[fn] {
+					seen[fn], todo = true, append(todo, int(fn))
+				}
+			}
+		}
+		return seen
+	}
+	directeffects, dyncalls := make([]bool, len(me)), make([]bool, len(me))
+	for i := range me {
+		seen := reach(i)
+		me[i].recursive, directeffects[i], dyncalls[i] = seen[i], direct[i], dynamic[i]
+		for j := range seen {
+			if seen[j] {
+				directeffects[i], dyncalls[i] = directeffects[i] || direct[j], dyncalls[i] || dynamic[j]
+			}
+		}
+	}
+	escapes := false
+	for _, fn := range valuerefs {
+		escapes = escapes || opHasEffects(fn) || (fn >= 0 && directeffects[fn])
+	}
+	for i := range me {
+		me[i].effects = directeffects[i] || (escapes && dyncalls[i])
+	}
+
+	for i := range me {
+		me[i].parallel = me.compileDef(ExprFuncRef(i), EngineParallel)
+	}
+}
+
+// opHasEffects reports whether `fn` is a prim-op with side effects beyond its
+// result: `OpPrt`, `OpEval` or `OpErr` (the latter aborting evaluation, so in
+// parallel evaluations it could otherwise preempt earlier such effects).
+func opHasEffects(fn ExprFuncRef) bool {
+	return fn == ExprFuncRef(OpPrt) || fn == ExprFuncRef(OpEval) || fn == ExprFuncRef(OpErr)
+}
+
+// parallelSpawns returns, for `EngineParallel`, which of the first `n` args
+// (in call order) of `call` to evaluate in their own goroutines: all those
+// used (as per `usage`, if any) that are `exprPure` and reach a `exprCost` of
+// `ParallelMinArgCost`, except the last such one, which the calling goroutine
+// evaluates itself rather than idling. If that leaves none, returns `nil`.
+func (me Prog) parallelSpawns(call *ExprCall, n int, usage []int, engine Engine) (ret []bool) {
+	if engine != EngineParallel {
+		return nil
+	}
+	last := -1
+	for i := 0; i < n; i++ {
+		if arg := call.Args[len(call.Args)-1-i]; (usage == nil || usage[i] != 0) && me.exprPure(arg) && me.exprCost(arg) >= ParallelMinArgCost {
+			if last >= 0 {
+				if ret == nil {
+					ret = make([]bool, n)
+				}
+				ret[last] = true
+			}
+			last = i
+		}
+	}
+	return
+}
+
+// exprPure reports whether `expr` only ever calls prim-ops and `FuncDef`s
+// known to not perform `OpPrt`, `OpEval` or `OpErr`, and never any args or call
+// results.
+func (me Prog) exprPure(expr Expr) bool {
+	switch it := expr.(type) {
+	case ExprFuncRef:
+		return !((it >= 0 && me[it].effects) || opHasEffects(it))
+	case *ExprCall:
+		pure := me.callIsStatic(it) && me.exprPure(it.Callee)
+		for i := 0; pure && i < len(it.Args); i++ {
+			pure = me.exprPure(it.Args[i])
+		}
+		return pure
+	}
+	return true
+}
+
+// callIsStatic reports whether `call` is a closure value or else calls a
+// known prim-op or `FuncDef` with no surplus args (to call its result with).
+func (me Prog) callIsStatic(call *ExprCall) bool {
+	fn, isfn := call.Callee.(ExprFuncRef)
+	return call.IsClosure != 0 || (isfn && ((fn < 0 && len(call.Args) <= 2) || (fn >= 0 && len(call.Args) <= len(me[fn].Args))))
+}
+
+// exprCost estimates the evaluation cost of `expr` as per `ParallelMinArgCost`.
+func (me Prog) exprCost(expr Expr) (cost int) {
+	switch it := expr.(type) {
+	case ExprFuncRef:
+		if it >= 0 && me[it].recursive {
+			return ParallelMinArgCost
+		}
+	case *ExprCall:
+		cost = me.exprCost(it.Callee)
+		for _, arg := range it.Args {
+			cost += me.exprCost(arg)
+		}
+	}
+	return cost + 1
+}
+
+// evalArgs evaluates into `dst` all `codes` whose `usage` (if any) isn't 0,
+// spawning goroutines for those marked in `spawn` while slots are free.
+func evalArgs(codes []evalCode, usage []int, spawn []bool, args []Expr, dst []Expr) {
+	for i := range codes {
+		if usage != nil && usage[i] == 0 {
+			continue
+		} else if spawn[i] {
+			if spawned := spawnArg(codes[i], args); spawned != nil {
+				evalArgsAfterSpawn(codes, usage, spawn, args, dst, i, spawned)
+				return
+			}
+		}
+		dst[i] = codes[i](args)
+	}
+}
+
+// evalArgsAfterSpawn continues `evalArgs` from `codes[idx]`, just `spawned`,
+// on. A panic is only re-raised after joining all spawned ones preceding it,
+// so that the same one prevails as would in sequential evaluation.
+func evalArgsAfterSpawn(codes []evalCode, usage []int, spawn []bool, args []Expr, dst []Expr, idx int, spawned *parallelArg) {
+	all, cur := make([]*parallelArg, len(codes)), idx
+	all[idx] = spawned
+	defer func() {
+		if thrown := recover(); thrown != nil {
+			for _, it := range all[:cur] {
+				if it != nil {
+					_ = it.join()
+				}
+			}
+			panic(thrown)
+		}
+	}()
+	for cur = idx + 1; cur < len(codes); cur++ {
+		if usage != nil && usage[cur] == 0 {
+			continue
+		} else if spawn[cur] {
+			if all[cur] = spawnArg(codes[cur], args); all[cur] != nil {
+				continue
+			}
+		}
+		dst[cur] = codes[cur](args)
+	}
+	for cur = idx; cur < len(codes); cur++ {
+		if all[cur] != nil {
+			dst[cur] = all[cur].join()
+		}
+	}
+}
+
+// spawnArg starts evaluating `code` in a new goroutine, unless all
+// `parallelSlots` are taken, in which case it returns `nil`.
+func spawnArg(code evalCode, args []Expr) *parallelArg {
+	select {
+	case parallelSlots <- struct{}{}:
+	default:
+		return nil
+	}
+	ret := &parallelArg{done: make(chan struct{})}
+	go func() {
+		defer func() {
+			ret.thrown = recover()
+			<-parallelSlots
+			close(ret.done)
+		}()
+		ret.result = code(args)
+	}()
+	return ret
+}
+
+func (me *parallelArg) join() Expr {
+	<-me.done
+	if me.thrown != nil {
+		panic(me.thrown)
+	}
+	return me.result
+}
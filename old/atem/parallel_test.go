@@ -0,0 +1,78 @@
+package atem_test
+
+import (
+	"io/ioutil"
+	"runtime"
+	"sync"
+	"testing"
+
+	. "github.com/metaleap/atmo/old/atem"
+	"github.com/metaleap/atmo/old/atem/golden"
+)
+
+// TestParallel runs all `testCases` repeatedly with `EngineParallel`, with a
+// `ParallelMinArgCost` low enough for most any call args to be spawned, failing
+// on any output differing from that of `EngineInterp`. Best run with `-race`.
+func TestParallel(t *testing.T) {
+	defer func(cost int) { ParallelMinArgCost = cost }(ParallelMinArgCost)
+	ParallelMinArgCost = 1
+	for _, it := range testCases(t) {
+		want, err := it.Run(EngineInterp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 8; i++ {
+			if got, err := it.Run(EngineParallel); err != nil {
+				t.Fatalf("%s: %v", it.SrcFilePath, err)
+			} else if diff := golden.Diff(want, got); diff != "" {
+				t.Fatalf("%s run %d differs from interp:\n%s", it.SrcFilePath, i, diff)
+			}
+		}
+	}
+}
+
+// TestParallelConcurrentEvals has each of `GOMAXPROCS` goroutines start an
+// `EngineParallel` evaluation of the same fresh `Prog` at once, so that these
+// share its on-first-use preparation. Best run with `-race`.
+func TestParallelConcurrentEvals(t *testing.T) {
+	defer func(dst func([]byte) (int, error), cost int) { OpPrtDst, ParallelMinArgCost = dst, cost }(OpPrtDst, ParallelMinArgCost)
+	OpPrtDst, ParallelMinArgCost = ioutil.Discard.Write, 1
+	for _, it := range testCases(t) {
+		src, err := ioutil.ReadFile(it.SrcFilePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := testEvalMain(LoadFromJson(src), &it, EngineInterp)
+		prog := LoadFromJson(src)
+		var wait sync.WaitGroup
+		got := make([]string, runtime.GOMAXPROCS(0)+1)
+		for i := range got {
+			wait.Add(1)
+			go func(i int) {
+				defer wait.Done()
+				got[i] = testEvalMain(prog, &it, EngineParallel)
+			}(i)
+		}
+		wait.Wait()
+		for i := range got {
+			if got[i] != want {
+				t.Errorf("%s in goroutine %d: expected %s, got %s", it.SrcFilePath, i, want, got[i])
+			}
+		}
+	}
+}
+
+// testEvalMain returns the `JsonSrc` of the main `FuncDef` result, or the
+// `ErrUser` message if it fails via `OpErr`, without any `stdin` handling.
+func testEvalMain(prog Prog, it *golden.Case, engine Engine) (ret string) {
+	defer func() {
+		if thrown := recover(); thrown != nil {
+			err, ok := thrown.(ErrUser)
+			if !ok {
+				panic(thrown)
+			}
+			ret = "ErrUser: " + err.Error()
+		}
+	}()
+	return prog.Eval(&ExprCall{Callee: ExprFuncRef(len(prog) - 1), Args: []Expr{ListsFrom(it.Env), ListsFrom(it.Args)}}, false, EvalWith(engine)).JsonSrc()
+}
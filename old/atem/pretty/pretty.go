@@ -0,0 +1,264 @@
+// Package pretty renders (mostly evaluated) `atem.Expr` values for human
+// consumption, rather than as `atem.Expr.JsonSrc` does for machines. It
+// recognizes the value encodings decreed by the `atem.StdFuncTrue`,
+// `atem.StdFuncFalse`, `atem.StdFuncNil` and `atem.StdFuncCons` conventions:
+// Church booleans print as `true` / `false`, linked lists of any elements
+// (including further lists) as `[a, b, c]` and those consisting entirely of
+// printable text bytes as quoted strings. Closures print as `name(a, b, ?)`,
+// `name` from `atem.FuncDef.Meta` and one `?` per missing arg, unused (never
+// evaluated) args as `_`, prim-op func-refs as `ADD`, `EQ` etc.
+//
+// Values too wide for `Printer.Width` are broken over multiple indented lines,
+// those nested deeper than `Printer.MaxDepth` elided as `…`, and lists longer
+// than `Printer.MaxItems` truncated. Any `atem.ExprCall` occurring more than
+// once (whether shared or, in theory, cyclic) is rendered only the first time,
+// labeled `#n=`, and thereafter referred to as `#n#`.
+package pretty
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/metaleap/atmo/old/atem"
+)
+
+// Printer renders `atem.Expr`s as per its settings. The zero `Printer` renders
+// single-line, unlimited output, with `FuncDef` names shown as `[idx]`.
+type Printer struct {
+	// Prog is the `atem.Prog` whose `FuncDef.Meta` names `FuncDef` refs.
+	Prog atem.Prog
+	// Name, if not `nil`, names `FuncDef` refs instead of `Prog`.
+	Name func(atem.ExprFuncRef) string
+	// Width is the line width to fit values into, if possible. If `0`, no
+	// line breaks are ever written.
+	Width int
+	// Indent is written once per nesting level on broken lines.
+	Indent string
+	// MaxDepth, if not `0`, limits the nesting depth of rendered values.
+	MaxDepth int
+	// MaxItems, if not `0`, limits the number of rendered list elements.
+	MaxItems int
+}
+
+// Default is the `Printer` used by `Print`.
+var Default = Printer{Width: 80, Indent: "  ", MaxDepth: 32, MaxItems: 256}
+
+// Print renders `expr` via the `Default` `Printer` using `prog`.
+func Print(prog atem.Prog, expr atem.Expr) string {
+	printer := Default
+	printer.Prog = prog
+	return printer.Print(expr)
+}
+
+// Print renders `expr` as per `me` settings.
+func (me *Printer) Print(expr atem.Expr) string {
+	var buf strings.Builder
+	ctx := printing{Printer: me, counts: map[*atem.ExprCall]int{}, labels: map[*atem.ExprCall]int{}}
+	ctx.count(expr, 0)
+	ctx.write(&buf, ctx.doc(expr, 0), "", 0, 0)
+	return buf.String()
+}
+
+// doc is a value rendering prior to layout: either an atom of just `open`,
+// or a group of `items` enclosed in `open` and `close`.
+type doc struct {
+	open  string
+	close string
+	items []*doc
+	flat  string
+}
+
+func atom(text string) *doc { return &doc{open: text, flat: text} }
+
+type printing struct {
+	*Printer
+	counts map[*atem.ExprCall]int
+	labels map[*atem.ExprCall]int
+}
+
+// count records how often every `atem.ExprCall` to be rendered occurs,
+// without descending into those already seen.
+func (me *printing) count(expr atem.Expr, depth int) {
+	call, ok := expr.(*atem.ExprCall)
+	if !ok || (me.MaxDepth > 0 && depth >= me.MaxDepth) {
+		return
+	}
+	if me.counts[call]++; me.counts[call] == 1 {
+		list, callee, args := parts(call)
+		if list == nil {
+			list = append([]atem.Expr{callee}, args...)
+		} else if _, ok = text(list); ok {
+			return
+		} else if me.MaxItems > 0 && len(list) > me.MaxItems {
+			list = list[:me.MaxItems]
+		}
+		for _, item := range list {
+			me.count(item, depth+1)
+		}
+	}
+}
+
+func (me *printing) doc(expr atem.Expr, depth int) *doc {
+	switch it := expr.(type) {
+	case nil:
+		return atom("_")
+	case atem.ExprNumInt:
+		return atom(strconv.FormatInt(int64(it), 10))
+	case atem.ExprArgRef:
+		return atom("@" + strconv.Itoa(int(-it)-2))
+	case atem.ExprFuncRef:
+		return atom(me.name(it))
+	case *atem.ExprCall:
+		if me.MaxDepth > 0 && depth >= me.MaxDepth {
+			return atom("…")
+		}
+		label := ""
+		if me.counts[it] > 1 {
+			if n, done := me.labels[it]; done {
+				return atom("#" + strconv.Itoa(n) + "#")
+			}
+			me.labels[it] = len(me.labels) + 1
+			label = "#" + strconv.Itoa(len(me.labels)) + "="
+		}
+		ret := &doc{close: ")"}
+		if list, callee, args := parts(it); list != nil {
+			if str, ok := text(list); ok {
+				return atom(label + strconv.Quote(str))
+			}
+			ret.open, ret.close = label+"[", "]"
+			for i, item := range list {
+				if me.MaxItems > 0 && i == me.MaxItems {
+					ret.items = append(ret.items, atom("…(+"+strconv.Itoa(len(list)-i)+" more)"))
+					break
+				}
+				ret.items = append(ret.items, me.doc(item, depth+1))
+			}
+		} else {
+			ret.open = label + me.doc(callee, depth+1).flat + "("
+			for _, arg := range args {
+				ret.items = append(ret.items, me.doc(arg, depth+1))
+			}
+			for i := 0; i < it.IsClosure; i++ {
+				ret.items = append(ret.items, atom("?"))
+			}
+		}
+		flat := make([]string, len(ret.items))
+		for i := range ret.items {
+			flat[i] = ret.items[i].flat
+		}
+		ret.flat = ret.open + strings.Join(flat, ", ") + ret.close
+		return ret
+	}
+	return atom(expr.JsonSrc())
+}
+
+// write lays out `it` starting at column `col`, breaking it over multiple
+// lines if its flat form (plus `trail` more chars to follow) exceeds `Width`.
+func (me *printing) write(buf *strings.Builder, it *doc, indent string, col int, trail int) {
+	if it.items == nil || me.Width <= 0 || col+utf8.RuneCountInString(it.flat)+trail <= me.Width {
+		buf.WriteString(it.flat)
+		return
+	}
+	buf.WriteString(it.open)
+	inner := indent + me.Indent
+	for i, item := range it.items {
+		buf.WriteString("\n" + inner)
+		if i < len(it.items)-1 {
+			me.write(buf, item, inner, len(inner), 1)
+			buf.WriteByte(',')
+		} else {
+			me.write(buf, item, inner, len(inner), 0)
+		}
+	}
+	buf.WriteString("\n" + indent + it.close)
+}
+
+func (me *printing) name(fn atem.ExprFuncRef) string {
+	switch {
+	case fn == atem.StdFuncTrue:
+		return "true"
+	case fn == atem.StdFuncFalse:
+		return "false"
+	case fn == atem.StdFuncNil:
+		return "[]"
+	case fn < 0:
+		return OpName(atem.OpCode(fn))
+	case me.Name != nil:
+		return me.Name(fn)
+	case int(fn) < len(me.Prog) && len(me.Prog[fn].Meta) > 0:
+		name := me.Prog[fn].Meta[0]
+		if name = name[strings.IndexByte(name, ']')+1:]; name != "" {
+			return name
+		}
+	}
+	return "[" + strconv.Itoa(int(fn)) + "]"
+}
+
+// OpName returns the upper-case mnemonic of `op`, such as `ADD` for
+// `atem.OpAdd`, or `OP` followed by the number for unknown ones.
+func OpName(op atem.OpCode) string {
+	switch op {
+	case atem.OpAdd:
+		return "ADD"
+	case atem.OpSub:
+		return "SUB"
+	case atem.OpMul:
+		return "MUL"
+	case atem.OpDiv:
+		return "DIV"
+	case atem.OpMod:
+		return "MOD"
+	case atem.OpEq:
+		return "EQ"
+	case atem.OpGt:
+		return "GT"
+	case atem.OpLt:
+		return "LT"
+	case atem.OpPrt:
+		return "PRT"
+	case atem.OpEval:
+		return "EVAL"
+	case atem.OpErr:
+		return "ERR"
+	}
+	return "OP" + strconv.Itoa(int(op))
+}
+
+// parts dissects `call` into the elements of the linked list it is, if so,
+// else (`list` being `nil`) into its `callee` and `args` in call order. Unlike
+// `atem.ListOfExprs`, never loops forever on cyclic lists.
+func parts(call *atem.ExprCall) (list []atem.Expr, callee atem.Expr, args []atem.Expr) {
+	seen := map[*atem.ExprCall]bool{}
+	for next := atem.Expr(call); ; {
+		if fn, _ := next.(atem.ExprFuncRef); fn == atem.StdFuncNil {
+			return
+		} else if cell, ok := next.(*atem.ExprCall); !(ok && len(cell.Args) == 2 && cell.Callee == atem.StdFuncCons && !seen[cell]) {
+			break
+		} else {
+			seen[cell], list, next = true, append(list, cell.Args[1]), cell.Args[0]
+		}
+	}
+	args = make([]atem.Expr, len(call.Args))
+	for i := range args {
+		args[i] = call.Args[len(call.Args)-1-i]
+	}
+	return nil, call.Callee, args
+}
+
+// text returns the string that `list` consists of, if all its elements are
+// `atem.ExprNumInt` bytes forming valid UTF-8 of printable (or white-space)
+// chars only. Empty lists aren't considered strings.
+func text(list []atem.Expr) (string, bool) {
+	bytes := atem.ListToBytes(list)
+	if len(bytes) == 0 || !utf8.Valid(bytes) {
+		return "", false
+	}
+	for _, r := range string(bytes) {
+		if !(unicode.IsPrint(r) || r == '\n' || r == '\t' || r == '\r') {
+			return "", false
+		}
+	}
+	return string(bytes), true
+}
@@ -5,6 +5,7 @@ type Ast struct {
 	toks  []Token
 	defs  []AstDef
 	scope AstScopes
+	diags *Diags
 	anns  struct {
 		num_def_toks int
 	}
@@ -48,6 +49,9 @@ type AstExprLitList []AstExpr
 
 type AstExprLitObj []AstExpr
 
+// in place of a malformed expr, as recorded (usually) in `Ast.diags`
+type AstExprErr DiagCode
+
 type AstScopes struct {
 	cur    []AstNameRef
 	parent *AstScopes
@@ -74,6 +78,15 @@ func astNodeMsg(msg_prefix string, node *AstNode, ast *Ast) Str {
 	return strConcat([]Str{str_line_nr, Str(":\n"), toksSrc(node_toks, ast.src)})
 }
 
+func astNodeDiag(node *AstNode, code DiagCode, msg string, ast *Ast) DiagCode {
+	diagsAddAtTok(ast.diags, code, &ast.toks[node.toks_idx], msg)
+	return code
+}
+
+func astExprErr(node_base AstNode, code DiagCode, msg string, ast *Ast) AstExpr {
+	return AstExpr{base: node_base, variant: AstExprErr(astNodeDiag(&node_base, code, msg, ast))}
+}
+
 func astNodeSrc(node *AstNode, ast *Ast) Str {
 	node_toks := astNodeToks(node, ast)
 	return toksSrc(node_toks, ast.src)
@@ -130,12 +143,19 @@ func astExprFormSplit(expr *AstExpr, ident string, must bool, must_lhs bool, mus
 }
 func astPopulateScopes(ast *Ast) {
 	ast.scope.cur = ªAstNameRef(len(ast.defs))
+	num_names := 0
 	for i := range ast.defs {
 		def := &ast.defs[i]
-		ast.scope.cur[i] = AstNameRef{name: def.anns.name, param_idx: -1, top_def: def, ref_def: def}
+		if def.anns.name != nil { // else it failed to `parseDef`
+			ast.scope.cur[num_names] = AstNameRef{name: def.anns.name, param_idx: -1, top_def: def, ref_def: def}
+			num_names++
+		}
 	}
+	ast.scope.cur = ast.scope.cur[0:num_names]
 	for i := range ast.defs {
-		astDefPopulateScopes(&ast.defs[i], &ast.defs[i], ast, &ast.scope)
+		if ast.defs[i].anns.name != nil {
+			astDefPopulateScopes(&ast.defs[i], &ast.defs[i], ast, &ast.scope)
+		}
 	}
 }
 
@@ -148,32 +168,42 @@ func astDefPopulateScopes(top_def *AstDef, cur_def *AstDef, ast *Ast, parent *As
 
 	cur_def.scope.parent = parent
 	cur_def.scope.cur = ªAstNameRef(len(cur_def.defs) + num_args)
+	num_names := 0
 	for i := range cur_def.defs {
 		sub_def := &cur_def.defs[i]
-		if nil != astScopesResolve(&cur_def.scope, sub_def.anns.name, i) {
-			fail(astNodeMsg("shadowing of '"+string(sub_def.anns.name)+"' in line ", &sub_def.base, ast))
+		if sub_def.anns.name == nil {
+			continue // failed to `parseDef`
+		} else if nil != astScopesResolve(&cur_def.scope, sub_def.anns.name, num_names) {
+			astNodeDiag(&sub_def.base, diag_code_scope_shadowing, "shadowing of '"+string(sub_def.anns.name)+"'", ast)
+		} else {
+			cur_def.scope.cur[num_names] = AstNameRef{name: sub_def.anns.name, param_idx: -1, top_def: top_def, ref_def: sub_def}
+			num_names++
 		}
-		cur_def.scope.cur[i] = AstNameRef{name: sub_def.anns.name, param_idx: -1, top_def: top_def, ref_def: sub_def}
 	}
 	if head_form != nil {
 		for i := 1; i < len(head_form); i++ {
-			param_idx := len(cur_def.defs) + (i - 1)
-			param_name := head_form[i].variant.(AstExprIdent)
-			if nil != astScopesResolve(&cur_def.scope, param_name, param_idx) {
-				fail(astNodeMsg("shadowing of '"+string(param_name)+"' in line ", &cur_def.head.base, ast))
-			}
-			cur_def.scope.cur[param_idx] = AstNameRef{
-				name:      param_name,
-				param_idx: i - 1,
-				top_def:   top_def,
-				ref_def:   cur_def,
+			if param_name, is := head_form[i].variant.(AstExprIdent); !is {
+				continue // an `AstExprErr` from `parseDef`
+			} else if nil != astScopesResolve(&cur_def.scope, param_name, num_names) {
+				astNodeDiag(&head_form[i].base, diag_code_scope_shadowing, "shadowing of '"+string(param_name)+"'", ast)
+			} else {
+				cur_def.scope.cur[num_names] = AstNameRef{
+					name:      param_name,
+					param_idx: i - 1,
+					top_def:   top_def,
+					ref_def:   cur_def,
+				}
+				num_names++
 			}
 		}
 	}
+	cur_def.scope.cur = cur_def.scope.cur[0:num_names]
 
 	for i := range cur_def.defs {
 		sub_def := &cur_def.defs[i]
-		astDefPopulateScopes(top_def, sub_def, ast, &cur_def.scope)
+		if sub_def.anns.name != nil {
+			astDefPopulateScopes(top_def, sub_def, ast, &cur_def.scope)
+		}
 	}
 }
 
@@ -199,3 +229,4 @@ func (AstExprLitList) implementsAstExprVariant() {}
 func (AstExprLitObj) implementsAstExprVariant()  {}
 func (AstExprLitInt) implementsAstExprVariant()  {}
 func (AstExprLitStr) implementsAstExprVariant()  {}
+func (AstExprErr) implementsAstExprVariant()     {}
@@ -0,0 +1,84 @@
+package main
+
+type DiagCode int
+
+const (
+	diag_code_none DiagCode = iota
+
+	diag_code_tok_str_unterminated
+	diag_code_tok_char_stray
+	diag_code_tok_bracket_mismatch
+	diag_code_tok_indent_inconsistent
+
+	diag_code_parse_def_malformed
+	diag_code_parse_def_head_unsupported
+	diag_code_parse_param_name
+	diag_code_parse_lit_int_malformed
+	diag_code_parse_lit_str_escape
+	diag_code_parse_lit_char_len
+	diag_code_parse_input_empty
+
+	diag_code_scope_shadowing
+)
+
+type Diag struct {
+	code     DiagCode
+	byte_idx int
+	line_nr  int
+	pos_col  int
+	msg      Str
+}
+
+// over-sized like the `tokenize` output, any diags beyond `len(all)` are dropped
+type Diags struct {
+	all []Diag
+	num int
+}
+
+func diagsAdd(diags *Diags, code DiagCode, byte_idx int, line_nr int, line_start_byte_idx int, msg string) {
+	for i := 0; i < diags.num; i++ {
+		if diags.all[i].code == code && diags.all[i].byte_idx == byte_idx {
+			return // such as from `toksIndentBasedChunks` on both a def and its sub-defs
+		}
+	}
+	if diags.num < len(diags.all) {
+		diags.all[diags.num] = Diag{
+			code:     code,
+			byte_idx: byte_idx,
+			line_nr:  line_nr,
+			pos_col:  byte_idx - line_start_byte_idx,
+			msg:      Str(msg),
+		}
+		diags.num++
+	}
+}
+
+func diagsAddAtTok(diags *Diags, code DiagCode, tok *Token, msg string) {
+	diagsAdd(diags, code, tok.byte_idx, tok.line_nr, tok.line_start_byte_idx, msg)
+}
+
+// by `byte_idx`, else in order of adding (as `tokenize` and `toksCheckBrackets`
+// and `parse` each add theirs in source order, but one after the other)
+func diagsSort(diags *Diags) {
+	for i := 1; i < diags.num; i++ {
+		diag := diags.all[i]
+		j := i - 1
+		for ; j >= 0 && diags.all[j].byte_idx > diag.byte_idx; j-- {
+			diags.all[j+1] = diags.all[j]
+		}
+		diags.all[j+1] = diag
+	}
+}
+
+// renders as `line:col: msg [code @byte_idx]`, with 1-based line and col
+func diagMsg(diag *Diag) Str {
+	return strConcat([]Str{
+		uintToStr(uint64(1+diag.line_nr), 10, 1, nil),
+		uintToStr(uint64(1+diag.pos_col), 10, 1, Str(":")),
+		Str(": "),
+		diag.msg,
+		uintToStr(uint64(diag.code), 10, 1, Str(" [")),
+		uintToStr(uint64(diag.byte_idx), 10, 1, Str(" @")),
+		Str("]"),
+	})
+}
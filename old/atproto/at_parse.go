@@ -1,12 +1,18 @@
 package main
 
-func parse(all_toks []Token, full_src Str) Ast {
-	chunks := toksIndentBasedChunks(all_toks)
+func parse(all_toks []Token, full_src Str, diags *Diags) Ast {
 	ret_ast := Ast{
-		src:  full_src,
-		toks: all_toks,
-		defs: ªAstDef(len(chunks)),
+		src:   full_src,
+		toks:  all_toks,
+		diags: diags,
 	}
+	if len(all_toks) == 0 { // such as when `toksCheckBrackets` dropped them all
+		diagsAdd(diags, diag_code_parse_input_empty, 0, 0, 0, "no defs in input")
+		ret_ast.defs = ªAstDef(0)
+		return ret_ast
+	}
+	chunks := toksIndentBasedChunks(all_toks, full_src, diags)
+	ret_ast.defs = ªAstDef(len(chunks))
 	ret_ast.anns.num_def_toks = toksCount(all_toks, Str(":="), full_src)
 	toks_idx := 0
 	for i, this_chunk_toks := range chunks {
@@ -22,11 +28,14 @@ func parse(all_toks []Token, full_src Str) Ast {
 	return ret_ast
 }
 
+// on malformed defs, records a `Diag` and leaves `dst_def` an `AstExprErr`-headed
+// nameless one, so that parsing carries on with the next (indentation-based) chunk
 func parseDef(dst_def *AstDef, dst_ast *Ast) {
 	toks := astNodeToks(&dst_def.base, dst_ast)
 	tok_idx_def := toksIndexOfIdent(toks, Str(":="), dst_ast.src)
 	if tok_idx_def <= 0 || tok_idx_def == len(toks)-1 {
-		fail(astNodeMsg("expected '<head_expr> := <body_expr>' in line ", &dst_def.base, dst_ast))
+		parseDefErr(dst_def, &dst_def.base, diag_code_parse_def_malformed, "expected '<head_expr> := <body_expr>'", dst_ast)
+		return
 	}
 
 	dst_def.head = parseExpr(toks[0:tok_idx_def], dst_def.base.toks_idx, dst_ast)
@@ -35,22 +44,30 @@ func parseDef(dst_def *AstDef, dst_ast *Ast) {
 		case AstExprIdent:
 			dst_def.anns.name = head_expr
 		case AstExprForm:
-			dst_def.anns.name = head_expr[0].variant.(AstExprIdent)
+			name, is_ident := head_expr[0].variant.(AstExprIdent)
+			if !is_ident {
+				parseDefErr(dst_def, &head_expr[0].base, diag_code_parse_def_head_unsupported, "unsupported def header", dst_ast)
+				return
+			}
+			dst_def.anns.name = name
 			for i := 1; i < len(head_expr); i++ {
 				switch param_name := head_expr[i].variant.(type) {
 				case AstExprIdent:
-					if param_name[0] != '_' || param_name[1] == '_' {
-						fail(astNodeMsg("param name doesn't begin with exactly one underscore in line ", &head_expr[i].base, dst_ast))
+					if param_name[0] != '_' || len(param_name) == 1 || param_name[1] == '_' {
+						head_expr[i] = astExprErr(head_expr[i].base, diag_code_parse_param_name, "param name doesn't begin with exactly one underscore", dst_ast)
 					}
+				case AstExprErr:
+					// already recorded by `parseExpr`
 				default:
-					fail(astNodeMsg("unsupported def header in line ", &head_expr[i].base, dst_ast))
+					head_expr[i] = astExprErr(head_expr[i].base, diag_code_parse_def_head_unsupported, "unsupported def header", dst_ast)
 				}
 			}
 		default:
-			fail(astNodeMsg("unsupported def header in line ", &dst_def.head.base, dst_ast))
+			parseDefErr(dst_def, &dst_def.head.base, diag_code_parse_def_head_unsupported, "unsupported def header", dst_ast)
+			return
 		}
 	}
-	chunks_body := toksIndentBasedChunks(toks[tok_idx_def+1:])
+	chunks_body := toksIndentBasedChunks(toks[tok_idx_def+1:], dst_ast.src, dst_ast.diags)
 	dst_def.defs = ªAstDef(len(chunks_body) - 1)
 	toks_idx := dst_def.base.toks_idx + tok_idx_def + 1
 	for i, this_chunk_toks := range chunks_body {
@@ -67,6 +84,13 @@ func parseDef(dst_def *AstDef, dst_ast *Ast) {
 	}
 }
 
+func parseDefErr(dst_def *AstDef, err_node *AstNode, code DiagCode, msg string, ast *Ast) {
+	dst_def.head = astExprErr(*err_node, code, msg, ast)
+	dst_def.body = dst_def.head
+	dst_def.defs = ªAstDef(0)
+	dst_def.anns.name = nil
+}
+
 func parseExpr(expr_toks []Token, all_toks_idx int, ast *Ast) AstExpr {
 	assert(len(expr_toks) != 0)
 	acc_ret := ªAstExpr(len(expr_toks))
@@ -85,32 +109,31 @@ func parseExpr(expr_toks []Token, all_toks_idx int, ast *Ast) AstExpr {
 			switch tok_kind := expr_toks[i].kind; tok_kind {
 			case tok_kind_lit_int:
 				tok_str := toksSrc(expr_toks[i:i+1], ast.src)
-				node_base := astNodeFrom(all_toks_idx+i, 1)
-				acc_ret[acc_len] = AstExpr{
-					base:    node_base,
-					variant: AstExprLitInt(parseExprLitInt(&node_base, ast, tok_str)),
-				}
+				acc_ret[acc_len] = parseExprLitInt(astNodeFrom(all_toks_idx+i, 1), ast, tok_str)
 			case tok_kind_lit_str_double:
 				tok_str := toksSrc(expr_toks[i:i+1], ast.src)
 				node_base := astNodeFrom(all_toks_idx+i, 1)
-				acc_ret[acc_len] = AstExpr{
-					base:    node_base,
-					variant: AstExprLitStr(parseExprLitStr(&node_base, ast, tok_str, '"')),
+				str, err := parseExprLitStr(&node_base, ast, tok_str, '"')
+				if err != diag_code_none {
+					acc_ret[acc_len] = AstExpr{base: node_base, variant: AstExprErr(err)}
+				} else {
+					acc_ret[acc_len] = AstExpr{base: node_base, variant: AstExprLitStr(str)}
 				}
 			case tok_kind_lit_str_single:
 				tok_str := toksSrc(expr_toks[i:i+1], ast.src)
 				node_base := astNodeFrom(all_toks_idx+i, 1)
-				char_str := parseExprLitStr(&node_base, ast, tok_str, '\'')
-				char_rune := rune(-1)
+				char_str, err := parseExprLitStr(&node_base, ast, tok_str, '\'')
+				char_rune, num_runes := rune(-1), 0
 				for _, r := range string(char_str) {
-					if char_rune < 0 {
-						char_rune = r
-					} else {
-						fail(astNodeMsg("character literal too long in line ", &node_base, ast))
-					}
+					char_rune = r
+					num_runes++
 				}
-				if char_rune < 0 {
-					fail(astNodeMsg("character literal too short in line ", &node_base, ast))
+				if err != diag_code_none {
+					acc_ret[acc_len] = AstExpr{base: node_base, variant: AstExprErr(err)}
+				} else if num_runes > 1 {
+					acc_ret[acc_len] = astExprErr(node_base, diag_code_parse_lit_char_len, "character literal too long", ast)
+				} else if num_runes == 0 {
+					acc_ret[acc_len] = astExprErr(node_base, diag_code_parse_lit_char_len, "character literal too short", ast)
 				} else {
 					acc_ret[acc_len] = AstExpr{base: node_base, variant: AstExprLitInt(char_rune)}
 				}
@@ -165,16 +188,18 @@ func parseExpr(expr_toks []Token, all_toks_idx int, ast *Ast) AstExpr {
 	}
 }
 
-func parseExprLitInt(node_base *AstNode, ast *Ast, lit_src Str) uint64 {
+func parseExprLitInt(node_base AstNode, ast *Ast, lit_src Str) AstExpr {
 	r, ok := uintFromStr(lit_src)
 	if !ok {
-		fail(astNodeMsg("malformed integer literal in line ", node_base, ast))
+		return astExprErr(node_base, diag_code_parse_lit_int_malformed, "malformed integer literal", ast)
 	}
-	return r
+	return AstExpr{base: node_base, variant: AstExprLitInt(r)}
 }
 
-func parseExprLitStr(node_base *AstNode, ast *Ast, lit_src Str, delim_char byte) Str {
-	assert(len(lit_src) >= 2 && lit_src[0] == delim_char && lit_src[len(lit_src)-1] == delim_char) // tokenizer-guaranteed
+func parseExprLitStr(node_base *AstNode, ast *Ast, lit_src Str, delim_char byte) (Str, DiagCode) {
+	if len(lit_src) < 2 || lit_src[0] != delim_char || lit_src[len(lit_src)-1] != delim_char {
+		return nil, astNodeDiag(node_base, diag_code_tok_str_unterminated, "unterminated literal", ast) // usually already recorded by `tokenize`
+	}
 	ret_str := ªbyte(len(lit_src) - 2)
 	ret_len := 0
 	for i, i_cry := 1, false; i < len(lit_src)-1; i++ {
@@ -192,11 +217,11 @@ func parseExprLitStr(node_base *AstNode, ast *Ast, lit_src Str, delim_char byte)
 			}
 		}
 		if i_cry {
-			fail(astNodeMsg("expected 3-digit base-10 integer decimal 000..256 following escape in line ", node_base, ast))
+			return nil, astNodeDiag(node_base, diag_code_parse_lit_str_escape, "expected 3-digit base-10 integer decimal 000..256 following escape", ast)
 		}
 		ret_len++
 	}
-	return ret_str[0:ret_len]
+	return ret_str[0:ret_len], diag_code_none
 }
 
 func parseExprsDelimited(toks []Token, all_toks_idx int, tok_kind_sep TokenKind, ast *Ast) []AstExpr {
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+type parseTestDiag struct {
+	code DiagCode
+	line int // 1-based, as by `diagMsg`
+	col  int // 1-based, as by `diagMsg`
+}
+
+var parseTests = []struct {
+	name   string
+	src    string
+	diags  []parseTestDiag
+	errs   []string // src of every `AstExprErr`, in def (then head, then body) order
+	scopes []string // the top-level `AstScopes`, then each non-erroneous def's as "name: names..."
+}{
+	{name: "valid",
+		src:    "foo _x := bar _x\n  bar := 1\nbaz := foo 2\n",
+		scopes: []string{"foo baz", "foo: bar _x", "bar:", "baz:"}},
+	{name: "missing def",
+		src:    "foo 1\nbar := 2\n",
+		diags:  []parseTestDiag{{diag_code_parse_def_malformed, 1, 1}},
+		errs:   []string{"foo 1"},
+		scopes: []string{"bar", "bar:"}},
+	{name: "missing body",
+		src:    "foo :=\nbar := 2\n",
+		diags:  []parseTestDiag{{diag_code_parse_def_malformed, 1, 1}},
+		errs:   []string{"foo :="},
+		scopes: []string{"bar", "bar:"}},
+	{name: "non-ident head",
+		src:    "1 := 2\nbar := 3\n",
+		diags:  []parseTestDiag{{diag_code_parse_def_head_unsupported, 1, 1}},
+		errs:   []string{"1"},
+		scopes: []string{"bar", "bar:"}},
+	{name: "non-ident head form",
+		src:    "\"foo\" _x := 2\nbar := 3\n",
+		diags:  []parseTestDiag{{diag_code_parse_def_head_unsupported, 1, 1}},
+		errs:   []string{"\"foo\""},
+		scopes: []string{"bar", "bar:"}},
+	{name: "non-ident param",
+		src:    "foo _a 1 _b := _a\n",
+		diags:  []parseTestDiag{{diag_code_parse_def_head_unsupported, 1, 8}},
+		errs:   []string{"1"},
+		scopes: []string{"foo", "foo: _a _b"}},
+	{name: "underscore-only param",
+		src:    "foo _ _b := _b\n",
+		diags:  []parseTestDiag{{diag_code_parse_param_name, 1, 5}},
+		errs:   []string{"_"},
+		scopes: []string{"foo", "foo: _b"}},
+	{name: "param names",
+		src:    "foo __a b := 1\n",
+		diags:  []parseTestDiag{{diag_code_parse_param_name, 1, 5}, {diag_code_parse_param_name, 1, 9}},
+		errs:   []string{"__a", "b"},
+		scopes: []string{"foo", "foo:"}},
+	{name: "bad int",
+		src:    "foo := bar 12x\n  bar := 3\n",
+		diags:  []parseTestDiag{{diag_code_parse_lit_int_malformed, 1, 12}},
+		errs:   []string{"12x"},
+		scopes: []string{"foo", "foo: bar", "bar:"}},
+	{name: "bad chars",
+		src:    "foo := ['ab', '', 'c']\n",
+		diags:  []parseTestDiag{{diag_code_parse_lit_char_len, 1, 9}, {diag_code_parse_lit_char_len, 1, 15}},
+		errs:   []string{"'ab'", "''"},
+		scopes: []string{"foo", "foo:"}},
+	{name: "bad escapes",
+		src:    "foo := \"a\\999\" \"b\\12\"\n",
+		diags:  []parseTestDiag{{diag_code_parse_lit_str_escape, 1, 8}, {diag_code_parse_lit_str_escape, 1, 16}},
+		errs:   []string{"\"a\\999\"", "\"b\\12\""},
+		scopes: []string{"foo", "foo:"}},
+	{name: "unterminated str",
+		src:    "foo := \"abc\nbar := 1\n",
+		diags:  []parseTestDiag{{diag_code_tok_str_unterminated, 1, 8}},
+		errs:   []string{"\"abc"},
+		scopes: []string{"foo bar", "foo:", "bar:"}},
+	{name: "shadowing sub-def",
+		src:    "foo _x := z\n  z := 1\n  z := 2\n",
+		diags:  []parseTestDiag{{diag_code_scope_shadowing, 3, 3}},
+		scopes: []string{"foo", "foo: z _x", "z:", "z:"}},
+	{name: "shadowing param",
+		src:    "foo _x := _x\n  bar _x := _x\n",
+		diags:  []parseTestDiag{{diag_code_scope_shadowing, 2, 7}},
+		scopes: []string{"foo", "foo: bar _x", "bar:"}},
+	{name: "close paren only",
+		src:    ")",
+		diags:  []parseTestDiag{{diag_code_tok_bracket_mismatch, 1, 1}, {diag_code_parse_input_empty, 1, 1}},
+		scopes: []string{""}},
+	{name: "errs between valid defs",
+		src:    "foo := 1\nbar\nbaz := (qux 'xy')\n  qux := 1\nend := foo\n",
+		diags:  []parseTestDiag{{diag_code_parse_def_malformed, 2, 1}, {diag_code_parse_lit_char_len, 3, 13}},
+		errs:   []string{"bar", "'xy'"},
+		scopes: []string{"foo baz end", "foo:", "baz: qux", "qux:", "end:"}},
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range parseTests {
+		src := Str(test.src)
+		diags := Diags{all: ªDiag(1 + len(src))}
+		toks := toksCheckBrackets(tokenize(src, false, &diags), &diags)
+		ast := parse(toks, src, &diags)
+		astPopulateScopes(&ast)
+		diagsSort(&diags)
+
+		if diags.num != len(test.diags) {
+			t.Errorf("%s: expected %d diags, got %d: %v", test.name, len(test.diags), diags.num, diags.all[:diags.num])
+		} else {
+			for i, expect := range test.diags {
+				diag := &diags.all[i]
+				if diag.code != expect.code || 1+diag.line_nr != expect.line || 1+diag.pos_col != expect.col {
+					t.Errorf("%s: expected diag %v, got %s", test.name, expect, diagMsg(diag))
+				}
+			}
+		}
+
+		var errs []string
+		for i := range ast.defs {
+			errs = parseTestErrs(&ast.defs[i], &ast, errs)
+		}
+		if strings.Join(errs, "\n") != strings.Join(test.errs, "\n") {
+			t.Errorf("%s: expected AstExprErrs %q, got %q", test.name, test.errs, errs)
+		}
+
+		scopes := []string{parseTestScopeNames(&ast.scope)}
+		for i := range ast.defs {
+			scopes = parseTestScopes(&ast.defs[i], scopes)
+		}
+		if strings.Join(scopes, "\n") != strings.Join(test.scopes, "\n") {
+			t.Errorf("%s: expected AstScopes %q, got %q", test.name, test.scopes, scopes)
+		}
+	}
+}
+
+func parseTestErrs(def *AstDef, ast *Ast, errs []string) []string {
+	var walk func(*AstExpr)
+	walk = func(expr *AstExpr) {
+		switch it := expr.variant.(type) {
+		case AstExprErr:
+			errs = append(errs, string(astNodeSrc(&expr.base, ast)))
+		case AstExprForm:
+			for i := range it {
+				walk(&it[i])
+			}
+		case AstExprLitList:
+			for i := range it {
+				walk(&it[i])
+			}
+		case AstExprLitObj:
+			for i := range it {
+				walk(&it[i])
+			}
+		}
+	}
+	walk(&def.head)
+	if def.anns.name != nil { // else `body` is the same as `head`
+		walk(&def.body)
+	}
+	for i := range def.defs {
+		errs = parseTestErrs(&def.defs[i], ast, errs)
+	}
+	return errs
+}
+
+func parseTestScopes(def *AstDef, scopes []string) []string {
+	if def.anns.name == nil {
+		return scopes
+	}
+	scopes = append(scopes, strings.TrimSpace(string(def.anns.name)+": "+parseTestScopeNames(&def.scope)))
+	for i := range def.defs {
+		scopes = parseTestScopes(&def.defs[i], scopes)
+	}
+	return scopes
+}
+
+func parseTestScopeNames(scope *AstScopes) string {
+	names := make([]string, len(scope.cur))
+	for i := range scope.cur {
+		names[i] = string(scope.cur[i].name)
+	}
+	return strings.Join(names, " ")
+}
@@ -50,7 +50,15 @@ func isSepChar(char byte) bool {
 	return false
 }
 
-func tokenize(full_src Str, keep_comment_toks bool) []Token {
+func isStrayChar(full_src Str, idx int) bool {
+	c := full_src[idx]
+	if c == '\r' {
+		return idx == len(full_src)-1 || full_src[idx+1] != '\n'
+	}
+	return c == 127 || (c < ' ' && c != '\t' && c != '\n')
+}
+
+func tokenize(full_src Str, keep_comment_toks bool, diags *Diags) []Token {
 	i, cur_line_nr, cur_line_idx, toks_count := 0, 0, 0, 0
 	tok_start, tok_last := -1, -1
 	var state TokenKind = tok_kind_none
@@ -65,7 +73,8 @@ func tokenize(full_src Str, keep_comment_toks bool) []Token {
 
 		if c == '\n' {
 			if state == tok_kind_lit_str_double || state == tok_kind_lit_str_single {
-				fail(uintToStr(uint64(1+cur_line_nr), 10, 1, Str("line-break in literal in line ")), ":\n", full_src[tok_start:i])
+				// keep the literal as-is up to the line-break and go on with the next line
+				diagsAdd(diags, diag_code_tok_str_unterminated, tok_start, cur_line_nr, cur_line_idx, "line-break in literal")
 			}
 			if tok_start != -1 && tok_last == -1 {
 				tok_last = i - 1
@@ -73,7 +82,7 @@ func tokenize(full_src Str, keep_comment_toks bool) []Token {
 		} else {
 			switch state {
 			case tok_kind_lit_int, tok_kind_ident:
-				if c == ' ' || c == '\t' || c == '"' || c == '\'' || isSepChar(c) ||
+				if c == ' ' || c == '\t' || c == '\r' || c == '"' || c == '\'' || isSepChar(c) || isStrayChar(full_src, i) ||
 					(isOpChar(c) && !isOpChar(full_src[i-1])) || (isOpChar(full_src[i-1]) && !isOpChar(c)) {
 					i--
 					tok_last = i
@@ -129,7 +138,10 @@ func tokenize(full_src Str, keep_comment_toks bool) []Token {
 					} else if c >= '0' && c <= '9' {
 						tok_start = i
 						state = tok_kind_lit_int
-					} else if c == ' ' || c == '\t' {
+					} else if isStrayChar(full_src, i) {
+						// skipped, as if white-space
+						diagsAdd(diags, diag_code_tok_char_stray, i, cur_line_nr, cur_line_idx, "stray control character")
+					} else if c == ' ' || c == '\t' || c == '\r' {
 						if tok_start != -1 && tok_last == -1 {
 							tok_last = i - 1
 						}
@@ -168,6 +180,9 @@ func tokenize(full_src Str, keep_comment_toks bool) []Token {
 		}
 	}
 	if tok_start != -1 {
+		if state == tok_kind_lit_str_double || state == tok_kind_lit_str_single {
+			diagsAdd(diags, diag_code_tok_str_unterminated, tok_start, cur_line_nr, cur_line_idx, "end of input in literal")
+		}
 		if state == tok_kind_none {
 			unreachable()
 		} else if state != tok_kind_comment || keep_comment_toks {
@@ -243,60 +258,93 @@ func toksCountUnnested(toks []Token, tok_kind TokenKind) int {
 	return ret_num
 }
 
-func toksCheckBrackets(toks []Token) {
-	level_bparen, level_bsquare, level_bcurly := 0, 0, 0
-	line_bparen, line_bsquare, line_bcurly := -1, -1, -1
+func tokClosingBracketFor(tok_kind_open TokenKind) TokenKind {
+	switch tok_kind_open {
+	case tok_kind_sep_bcurly_open:
+		return tok_kind_sep_bcurly_close
+	case tok_kind_sep_bparen_open:
+		return tok_kind_sep_bparen_close
+	case tok_kind_sep_bsquare_open:
+		return tok_kind_sep_bsquare_close
+	}
+	return tok_kind_none
+}
+
+// reports all unmatched or mismatched brackets and returns `toks` without them, so always balanced
+func toksCheckBrackets(toks []Token, diags *Diags) []Token {
+	drop := ªbool(len(toks))
+	open_idxs := ªint(len(toks)) // stack of not-yet-closed opening brackets
+	num_open := 0
 	for i := range toks {
-		switch toks[i].kind {
-		case tok_kind_sep_bcurly_open:
-			level_bcurly++
-			if line_bcurly == -1 {
-				line_bcurly = toks[i].line_nr
-			}
-		case tok_kind_sep_bparen_open:
-			level_bparen++
-			if line_bparen == -1 {
-				line_bparen = toks[i].line_nr
-			}
-		case tok_kind_sep_bsquare_open:
-			level_bsquare++
-			if line_bsquare == -1 {
-				line_bsquare = toks[i].line_nr
-			}
-		case tok_kind_sep_bcurly_close:
-			level_bcurly--
-			if level_bcurly == 0 {
-				line_bcurly = -1
-			}
-		case tok_kind_sep_bparen_close:
-			level_bparen--
-			if level_bparen == 0 {
-				line_bparen = -1
+		tok := &toks[i]
+		if tokIsOpeningBracket(tok.kind) {
+			open_idxs[num_open] = i
+			num_open++
+		} else if tokIsClosingBracket(tok.kind) {
+			idx_match := num_open - 1
+			for idx_match >= 0 && tokClosingBracketFor(toks[open_idxs[idx_match]].kind) != tok.kind {
+				idx_match--
 			}
-		case tok_kind_sep_bsquare_close:
-			level_bsquare--
-			if level_bsquare == 0 {
-				line_bsquare = -1
+			if idx_match < 0 { // no opener at all for this one: drop it
+				drop[i] = true
+				diagsAddAtTok(diags, diag_code_tok_bracket_mismatch, tok, "unmatched closing "+tokBracketName(tok.kind))
+			} else { // all openers nested inside the matching one were never closed: drop those
+				for j := idx_match + 1; j < num_open; j++ {
+					drop[open_idxs[j]] = true
+					diagsAddAtTok(diags, diag_code_tok_bracket_mismatch, &toks[open_idxs[j]], "unmatched opening "+tokBracketName(toks[open_idxs[j]].kind))
+				}
+				num_open = idx_match
 			}
 		}
-		if level_bparen < 0 {
-			fail("unmatched closing parenthesis in line ", uintToStr(uint64(1+toks[i].line_nr), 10, 1, nil))
-		} else if level_bcurly < 0 {
-			fail("unmatched closing curly brace in line ", uintToStr(uint64(1+toks[i].line_nr), 10, 1, nil))
-		} else if level_bsquare < 0 {
-			fail("unmatched closing square bracket in line ", uintToStr(uint64(1+toks[i].line_nr), 10, 1, nil))
+	}
+	for j := 0; j < num_open; j++ {
+		drop[open_idxs[j]] = true
+		diagsAddAtTok(diags, diag_code_tok_bracket_mismatch, &toks[open_idxs[j]], "unmatched opening "+tokBracketName(toks[open_idxs[j]].kind))
+	}
+
+	ret_toks := ªToken(len(toks))
+	ret_len := 0
+	for i := range toks {
+		if !drop[i] {
+			ret_toks[ret_len] = toks[i]
+			ret_len++
 		}
 	}
-	if level_bparen > 0 {
-		fail("unmatched opening parenthesis in line ", uintToStr(uint64(1+line_bparen), 10, 1, nil))
-	} else if level_bcurly > 0 {
-		fail("unmatched opening curly brace in line ", uintToStr(uint64(1+line_bcurly), 10, 1, nil))
-	} else if level_bsquare > 0 {
-		fail("unmatched opening square bracket in line ", uintToStr(uint64(1+line_bsquare), 10, 1, nil))
+	return ret_toks[0:ret_len]
+}
+
+func tokBracketName(tok_kind TokenKind) string {
+	switch tok_kind {
+	case tok_kind_sep_bcurly_open, tok_kind_sep_bcurly_close:
+		return "curly brace"
+	case tok_kind_sep_bparen_open, tok_kind_sep_bparen_close:
+		return "parenthesis"
+	case tok_kind_sep_bsquare_open, tok_kind_sep_bsquare_close:
+		return "square bracket"
+	}
+	unreachable()
+	return ""
+}
+
+// returns the leading white-space of `tok`'s line if `tok` is the first one in it, else `nil`
+func tokIndent(tok *Token, full_src Str) Str {
+	for i := tok.line_start_byte_idx; i < tok.byte_idx; i++ {
+		if full_src[i] != ' ' && full_src[i] != '\t' {
+			return nil
+		}
 	}
+	return full_src[tok.line_start_byte_idx:tok.byte_idx]
 }
 
-func toksIndentBasedChunks(toks []Token) [][]Token {
+// whether the shorter one of both indents is a prefix of the other, ie. they don't mix tabs and spaces differently
+func indentsConsistent(one Str, two Str) bool {
+	if len(two) < len(one) {
+		one, two = two, one
+	}
+	return strEql(one, two[0:len(one)])
+}
+
+func toksIndentBasedChunks(toks []Token, full_src Str, diags *Diags) [][]Token {
 	cmp_pos_col := tokPosCol(&toks[0])
 	level := 0
 	for i := range toks {
@@ -332,9 +380,19 @@ func toksIndentBasedChunks(toks []Token) [][]Token {
 	ret := ªTokens(num_chunks)
 	{
 		start_from, next_idx := -1, 0
+		var cmp_indent Str // of the line of the last chunk start at the beginning of its line
 		for i := range toks {
 			tok := &toks[i]
-			if i == 0 || (level == 0 && tokPosCol(tok) <= cmp_pos_col) {
+			is_chunk_start := i == 0 || (level == 0 && tokPosCol(tok) <= cmp_pos_col)
+			if indent := tokIndent(tok, full_src); level == 0 && indent != nil {
+				if cmp_indent != nil && !indentsConsistent(cmp_indent, indent) {
+					diagsAddAtTok(diags, diag_code_tok_indent_inconsistent, tok, "indentation mixes tabs and spaces inconsistently with that of the lines before")
+				}
+				if is_chunk_start || cmp_indent == nil {
+					cmp_indent = indent
+				}
+			}
+			if is_chunk_start {
 				if start_from != -1 {
 					ret[next_idx] = toks[start_from:i]
 					next_idx++
@@ -367,15 +425,7 @@ func toksIndexOfIdent(toks []Token, ident Str, full_src Str) int {
 
 func toksIndexOfMatchingBracket(toks []Token) int {
 	tok_open := toks[0].kind
-	tok_close := tok_kind_none
-	switch tok_open {
-	case tok_kind_sep_bcurly_open:
-		tok_close = tok_kind_sep_bcurly_close
-	case tok_kind_sep_bparen_open:
-		tok_close = tok_kind_sep_bparen_close
-	case tok_kind_sep_bsquare_open:
-		tok_close = tok_kind_sep_bsquare_close
-	}
+	tok_close := tokClosingBracketFor(tok_open)
 	assert(tok_close != tok_kind_none)
 	level := 0
 	for i := range toks {
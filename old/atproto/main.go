@@ -8,6 +8,8 @@ begin most limited and low-levelish at first:
 
 - program input and output remain as `type Str = []byte`, no use of `string`s
 - no proper `error` handling, immediate `panic`s upon detecting a problem
+  (except for collecting `Diags` of lexical and syntax errors, to report them
+  all at once, with `parse` skipping malformed defs and exprs as `AstExprErr`s)
 - no 3rd-party imports whatsoever
 - no stdlib imports for core processing (just here in main.go for setup & I/O)
   (hence manual implementations like uintToStr, uintFromStr, strEql etc)
@@ -37,14 +39,25 @@ func main() {
 		panic(err)
 	}
 
-	toks := tokenize(input_src_file_bytes, false)
-	assert(len(toks) != 0)
-	toksCheckBrackets(toks)
+	diags := Diags{all: ªDiag(1 + len(input_src_file_bytes))}
+	toks := tokenize(input_src_file_bytes, false, &diags)
+	toks = toksCheckBrackets(toks, &diags)
 
-	ast := parse(toks, input_src_file_bytes)
-	assert(len(ast.defs) != 0)
+	ast := parse(toks, input_src_file_bytes, &diags)
 	astPopulateScopes(&ast)
+	failIfDiags(&diags) // lexical, syntax and scoping errors get all reported at once
+	assert(len(ast.defs) != 0)
 
 	ir_hl := irHLFrom(&ast)
 	irHLPrint(&ir_hl)
 }
+
+func failIfDiags(diags *Diags) {
+	if diags.num > 0 {
+		diagsSort(diags)
+		for i := 0; i < diags.num; i++ {
+			os.Stderr.Write(append(diagMsg(&diags.all[i]), '\n'))
+		}
+		os.Exit(1)
+	}
+}
@@ -137,3 +137,4 @@ func ªAstNameRef(len int) []AstNameRef { return make([]AstNameRef, len) }
 func ªIrLLExpr(len int) []IrLLExpr     { return make([]IrLLExpr, len) }
 func ªIrHLDef(len int) []IrHLDef       { return make([]IrHLDef, len) }
 func ªIrHLExpr(len int) []IrHLExpr     { return make([]IrHLExpr, len) }
+func ªDiag(len int) []Diag             { return make([]Diag, len) }
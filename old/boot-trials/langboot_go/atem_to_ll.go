@@ -0,0 +1,1005 @@
+package main
+
+import (
+	atem "github.com/metaleap/atmo/old/atem"
+)
+
+/*
+
+lowers an atem `Prog` (see ../../atem) to an `LLModule`, for `llEmit` just like
+with `.at` inputs: `cat prog.json | langboot_go atem > prog.ll`
+
+every atem value is boxed behind an `i64*` to a run of words: tag (0 for nums,
+1 for func-refs and op-codes, 2 for closures), num (the num, or the func-ref or
+op-code), nargs (for closures) and then said closure args as `ptrtoint`s. args
+never used by their callee are never evaluated and passed as `null` instead.
+
+every `FuncDef` becomes an `LLFunc` taking its args as such an `i64*` array.
+saturated calls to statically known non-selector `FuncDef`s become direct calls
+and prim-op calls become `LLInstrBinOp`s / `LLInstrCmpI`s, all others go through
+the runtime's `atem_apply` (which creates the closures for partial
+applications and short-cuts selectors just like the interpreter), with
+non-atomic args compiled into separate thunk `LLFunc`s to likewise only ever
+evaluate those that end up being needed. the runtime (also generated here) is
+written against libc only: `malloc` (never `free`d, atem programs run to
+completion and then exit), `fputc`, `fwrite` and `exit`.
+
+`main` passes process args and env (the latter via libc's `environ`) and writes
+the result, both just like `cmd/atem` (but without its `stdin` handler
+protocol). so the `.ll` runs as-is via `lli prog.ll`, or natively via
+`llc -relocation-model=pic -filetype=obj prog.ll` and then `cc prog.o`.
+
+*/
+
+var (
+	atem_ll_ty_word = LLTypeInt{bit_width: 64}
+	atem_ll_ty_val  = LLTypePtr{ty: atem_ll_ty_word}
+	atem_ll_ty_bool = LLTypeInt{bit_width: 1}
+	atem_ll_ty_i32  = LLTypeInt{bit_width: 32}
+	atem_ll_ty_i8   = LLTypeInt{bit_width: 8}
+	atem_ll_ty_cstr = LLTypePtr{ty: atem_ll_ty_i8}
+	atem_ll_ty_void = LLTypeVoid{}
+)
+
+type CtxAtemToLL struct {
+	prog           atem.Prog
+	ll_mod         *LLModule
+	num_funcs      int
+	num_globals    int
+	thunks         []atem.Expr // bodies of thunk funcs, generated only after the current func is done
+	num_thunks     int
+	cur_func       *LLFunc
+	cur_num_blocks int
+	cur_num_instrs int
+	cur_num_temps  int
+}
+
+func llModuleFromAtem(prog atem.Prog) LLModule {
+	ret_mod := LLModule{
+		target_datalayout: Str(llmodule_default_target_datalayout),
+		target_triple:     Str(llmodule_default_target_triple),
+		globals:           ªLLGlobal(16),
+		funcs:             ªLLFunc(64 + 2*len(prog)),
+	}
+	ctx := CtxAtemToLL{prog: prog, ll_mod: &ret_mod, thunks: make([]atem.Expr, 64)}
+
+	atemLLRuntime(&ctx)
+	atemLLDispatchers(&ctx)
+	for i := range prog {
+		atemLLFuncBegin(&ctx, uintToStr(uint64(i), 10, 1, Str("atem_f")), atem_ll_ty_val, []LLFuncParam{{name: Str("a"), ty: atem_ll_ty_val}})
+		meta := ªbyte(0)
+		for _, str := range prog[i].Meta {
+			meta = strConcat([]Str{meta, Str(" "), Str(str)})
+		}
+		for j := range meta {
+			if meta[j] == '\n' || meta[j] == '\r' {
+				meta[j] = ' '
+			}
+		}
+		atemLLInstr(&ctx, LLInstrComment{comment_text: meta})
+		atemLLRet(&ctx, atemLLExpr(&ctx, prog[i].Body))
+		atemLLFuncEnd(&ctx)
+	}
+	for i := 0; i < ctx.num_thunks; i++ { // thunk bodies may well add further thunks
+		atemLLFuncBegin(&ctx, uintToStr(uint64(i), 10, 1, Str("atem_t")), atem_ll_ty_val, []LLFuncParam{{name: Str("a"), ty: atem_ll_ty_val}})
+		atemLLRet(&ctx, atemLLExpr(&ctx, ctx.thunks[i]))
+		atemLLFuncEnd(&ctx)
+	}
+	atemLLThunkDispatcher(&ctx)
+
+	ret_mod.globals = ret_mod.globals[0:ctx.num_globals]
+	ret_mod.funcs = ret_mod.funcs[0:ctx.num_funcs]
+	return ret_mod
+}
+
+// atemLLExpr emits the instructions computing `expr`, call args being evaluated left-to-right as in the interpreter.
+func atemLLExpr(ctx *CtxAtemToLL, expr atem.Expr) LLExprTyped {
+	switch it := expr.(type) {
+	case atem.ExprNumInt:
+		return atemLLBox(ctx, 0, atemLLWord(int64(it)), 0)
+	case atem.ExprArgRef:
+		return atemLLCall(ctx, atem_ll_ty_val, "atem_get", atemLLLocal("a", atem_ll_ty_val), atemLLWord(int64(-it)-2))
+	case atem.ExprFuncRef:
+		return atemLLBox(ctx, 1, atemLLWord(int64(it)), 0)
+	case *atem.ExprCall:
+		num_args := len(it.Args)
+		arg := func(i int) atem.Expr { return it.Args[num_args-1-i] } // `it.Args` are in reverse call order
+		if it.IsClosure > 0 {
+			closure := atemLLBox(ctx, 2, atemLLWord(int64(it.Callee.(atem.ExprFuncRef))), num_args)
+			for i := 0; i < num_args; i++ {
+				atemLLCall(ctx, atem_ll_ty_void, "atem_set", closure, atemLLWord(int64(3+i)), atemLLExpr(ctx, arg(i)))
+			}
+			return closure
+		}
+
+		var callee LLExprTyped
+		num_done := 0
+		if fn, is_fn := it.Callee.(atem.ExprFuncRef); is_fn && fn < 0 && num_args >= 2 {
+			num_done = 2
+			lhs_val, rhs_val := atemLLExpr(ctx, arg(0)), atemLLExpr(ctx, arg(1))
+			bin_op, cmp := LLBinOpKind(0), LLCmpIKind(0)
+			switch atem.OpCode(fn) {
+			case atem.OpAdd:
+				bin_op = ll_bin_op_add
+			case atem.OpSub:
+				bin_op = ll_bin_op_sub
+			case atem.OpMul:
+				bin_op = ll_bin_op_mul
+			case atem.OpLt:
+				cmp = ll_cmp_i_slt
+			case atem.OpGt:
+				cmp = ll_cmp_i_sgt
+			default: // the others need non-num operands or further checks, so are left to the runtime
+				callee = atemLLCall(ctx, atem_ll_ty_val, "atem_op", atemLLWord(int64(fn)), lhs_val, rhs_val)
+			}
+			if callee.ty == nil {
+				lhs, rhs := atemLLCall(ctx, atem_ll_ty_word, "atem_num", lhs_val), atemLLCall(ctx, atem_ll_ty_word, "atem_num", rhs_val)
+				if cmp != 0 {
+					callee = atemLLCall(ctx, atem_ll_ty_val, "atem_bool", atemLLCmp(ctx, cmp, lhs, rhs))
+				} else {
+					callee = atemLLBox(ctx, 0, atemLLOp(ctx, bin_op, lhs, rhs), 0)
+				}
+			}
+		} else if is_fn && fn >= 0 && len(ctx.prog[fn].Args) > 0 && !ctx.prog[fn].IsSelector() && num_args >= len(ctx.prog[fn].Args) {
+			num_done = len(ctx.prog[fn].Args)
+			args := atemLLCall(ctx, atem_ll_ty_val, "atem_alloc", atemLLWord(int64(num_done)))
+			for i := 0; i < num_done; i++ {
+				if ctx.prog[fn].Args[i] == 0 { // unused, so never evaluated
+					atemLLCall(ctx, atem_ll_ty_void, "atem_set_word", args, atemLLWord(int64(i)), atemLLWord(0))
+				} else {
+					atemLLCall(ctx, atem_ll_ty_void, "atem_set", args, atemLLWord(int64(i)), atemLLExpr(ctx, arg(i)))
+				}
+			}
+			callee = atemLLCall(ctx, atem_ll_ty_val, string(uintToStr(uint64(fn), 10, 1, Str("atem_f"))), args)
+		} else {
+			callee = atemLLExpr(ctx, it.Callee)
+		}
+		if num_done == num_args {
+			return callee
+		}
+
+		num_lazy := num_args - num_done
+		entries := atemLLCall(ctx, atem_ll_ty_val, "atem_alloc", atemLLWord(int64(3*num_lazy)))
+		for i := 0; i < num_lazy; i++ {
+			if call, is_call := arg(num_done + i).(*atem.ExprCall); is_call && call.IsClosure == 0 {
+				if ctx.num_thunks == len(ctx.thunks) {
+					thunks := make([]atem.Expr, 2*len(ctx.thunks))
+					for j := range ctx.thunks {
+						thunks[j] = ctx.thunks[j]
+					}
+					ctx.thunks = thunks
+				}
+				ctx.thunks[ctx.num_thunks] = call
+				ctx.num_thunks++
+				atemLLCall(ctx, atem_ll_ty_void, "atem_set_word", entries, atemLLWord(int64(3*i)), atemLLWord(0))
+				atemLLCall(ctx, atem_ll_ty_void, "atem_set_word", entries, atemLLWord(int64(3*i+1)), atemLLWord(int64(ctx.num_thunks)))
+				atemLLCall(ctx, atem_ll_ty_void, "atem_set", entries, atemLLWord(int64(3*i+2)), atemLLLocal("a", atem_ll_ty_val))
+			} else {
+				atemLLCall(ctx, atem_ll_ty_void, "atem_set", entries, atemLLWord(int64(3*i)), atemLLExpr(ctx, arg(num_done+i)))
+				atemLLCall(ctx, atem_ll_ty_void, "atem_set_word", entries, atemLLWord(int64(3*i+1)), atemLLWord(0))
+			}
+		}
+		return atemLLCall(ctx, atem_ll_ty_val, "atem_apply", callee, atemLLWord(int64(num_lazy)), entries)
+	}
+	fail("unexpected atem expr: ", expr.JsonSrc())
+	return LLExprTyped{}
+}
+
+// atemLLDispatchers emits `atem_call_def`, `atem_def_nargs`, `atem_def_arg_used`, `atem_def_nsels` and `atem_def_sel`: switches over all `FuncDef`s.
+func atemLLDispatchers(ctx *CtxAtemToLL) {
+	ty_val, ty_word, fn := atem_ll_ty_val, atem_ll_ty_word, atemLLLocal("fn", atem_ll_ty_word)
+
+	atemLLFuncBegin(ctx, Str("atem_call_def"), ty_val, []LLFuncParam{{name: Str("fn"), ty: ty_word}, {name: Str("args"), ty: ty_val}})
+	cases := ªLLSwitchCase(len(ctx.prog))
+	for i := range ctx.prog {
+		cases[i] = LLSwitchCase{expr: atemLLWord(int64(i)), block_name: uintToStr(uint64(i), 10, 1, Str("f"))}
+	}
+	atemLLInstr(ctx, LLInstrSwitch{comparee: fn, default_block_name: Str("none"), cases: cases})
+	for i := range ctx.prog {
+		atemLLBlock(ctx, string(cases[i].block_name))
+		atemLLRet(ctx, atemLLCall(ctx, ty_val, string(uintToStr(uint64(i), 10, 1, Str("atem_f"))), atemLLLocal("args", ty_val)))
+	}
+	atemLLBlock(ctx, "none")
+	atemLLInstr(ctx, LLInstrUnreachable{})
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_def_nargs"), ty_word, []LLFuncParam{{name: Str("fn"), ty: ty_word}})
+	max_nargs := 0
+	for i := range ctx.prog {
+		if len(ctx.prog[i].Args) > max_nargs {
+			max_nargs = len(ctx.prog[i].Args)
+		}
+	}
+	have_block := ªbool(max_nargs + 1)
+	cases = ªLLSwitchCase(len(ctx.prog))
+	for i := range ctx.prog {
+		cases[i] = LLSwitchCase{expr: atemLLWord(int64(i)), block_name: uintToStr(uint64(len(ctx.prog[i].Args)), 10, 1, Str("n"))}
+		have_block[len(ctx.prog[i].Args)] = true
+	}
+	atemLLInstr(ctx, LLInstrSwitch{comparee: fn, default_block_name: Str("none"), cases: cases})
+	for nargs := range have_block {
+		if have_block[nargs] {
+			atemLLBlock(ctx, string(uintToStr(uint64(nargs), 10, 1, Str("n"))))
+			atemLLRet(ctx, atemLLWord(int64(nargs)))
+		}
+	}
+	atemLLBlock(ctx, "none")
+	atemLLInstr(ctx, LLInstrUnreachable{})
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_def_arg_used"), atem_ll_ty_bool, []LLFuncParam{{name: Str("fn"), ty: ty_word}, {name: Str("idx"), ty: ty_word}})
+	cases, num_cases := ªLLSwitchCase(len(ctx.prog)), 0
+	for i := range ctx.prog {
+		for _, arg_usage := range ctx.prog[i].Args {
+			if arg_usage == 0 {
+				cases[num_cases] = LLSwitchCase{expr: atemLLWord(int64(i)), block_name: uintToStr(uint64(i), 10, 1, Str("f"))}
+				num_cases++
+				break
+			}
+		}
+	}
+	atemLLInstr(ctx, LLInstrSwitch{comparee: fn, default_block_name: Str("used"), cases: cases[0:num_cases]})
+	for _, fn_case := range cases[0:num_cases] {
+		def := &ctx.prog[fn_case.expr.expr.(LLExprLitInt)]
+		idx_cases, num_idx_cases := ªLLSwitchCase(len(def.Args)), 0
+		for i, arg_usage := range def.Args {
+			if arg_usage == 0 {
+				idx_cases[num_idx_cases] = LLSwitchCase{expr: atemLLWord(int64(i)), block_name: Str("unused")}
+				num_idx_cases++
+			}
+		}
+		atemLLBlock(ctx, string(fn_case.block_name))
+		atemLLInstr(ctx, LLInstrSwitch{comparee: atemLLLocal("idx", ty_word), default_block_name: Str("used"), cases: idx_cases[0:num_idx_cases]})
+	}
+	atemLLBlock(ctx, "used")
+	atemLLRet(ctx, atemLLInt(atem_ll_ty_bool, 1))
+	atemLLBlock(ctx, "unused")
+	atemLLRet(ctx, atemLLInt(atem_ll_ty_bool, 0))
+	atemLLFuncEnd(ctx)
+
+	// for selectors (see `atem.FuncDef.SelectorArgs`) the number of selected args, else 0
+	atemLLFuncBegin(ctx, Str("atem_def_nsels"), ty_word, []LLFuncParam{{name: Str("fn"), ty: ty_word}})
+	have_block = ªbool(max_nargs + 2)
+	cases, num_cases = ªLLSwitchCase(len(ctx.prog)), 0
+	for i := range ctx.prog {
+		if num_sels := len(ctx.prog[i].SelectorArgs()); num_sels > 0 {
+			cases[num_cases] = LLSwitchCase{expr: atemLLWord(int64(i)), block_name: uintToStr(uint64(num_sels), 10, 1, Str("n"))}
+			num_cases++
+			have_block[num_sels] = true
+		}
+	}
+	have_block[0] = true
+	atemLLInstr(ctx, LLInstrSwitch{comparee: fn, default_block_name: Str("n0"), cases: cases[0:num_cases]})
+	for num_sels := range have_block {
+		if have_block[num_sels] {
+			atemLLBlock(ctx, string(uintToStr(uint64(num_sels), 10, 1, Str("n"))))
+			atemLLRet(ctx, atemLLWord(int64(num_sels)))
+		}
+	}
+	atemLLFuncEnd(ctx)
+
+	// for selectors the arg index of their `idx`th selected arg
+	atemLLFuncBegin(ctx, Str("atem_def_sel"), ty_word, []LLFuncParam{{name: Str("fn"), ty: ty_word}, {name: Str("idx"), ty: ty_word}})
+	fn_cases := ªLLSwitchCase(num_cases)
+	for i := range fn_cases {
+		fn_cases[i] = LLSwitchCase{expr: cases[i].expr, block_name: uintToStr(uint64(cases[i].expr.expr.(LLExprLitInt)), 10, 1, Str("f"))}
+	}
+	atemLLInstr(ctx, LLInstrSwitch{comparee: fn, default_block_name: Str("none"), cases: fn_cases})
+	have_block = ªbool(max_nargs)
+	for i := range fn_cases {
+		sels := ctx.prog[fn_cases[i].expr.expr.(LLExprLitInt)].SelectorArgs()
+		idx_cases := ªLLSwitchCase(len(sels))
+		for j, arg_idx := range sels {
+			idx_cases[j] = LLSwitchCase{expr: atemLLWord(int64(j)), block_name: uintToStr(uint64(arg_idx), 10, 1, Str("a"))}
+			have_block[arg_idx] = true
+		}
+		atemLLBlock(ctx, string(fn_cases[i].block_name))
+		atemLLInstr(ctx, LLInstrSwitch{comparee: atemLLLocal("idx", ty_word), default_block_name: Str("none"), cases: idx_cases})
+	}
+	for arg_idx := range have_block {
+		if have_block[arg_idx] {
+			atemLLBlock(ctx, string(uintToStr(uint64(arg_idx), 10, 1, Str("a"))))
+			atemLLRet(ctx, atemLLWord(int64(arg_idx)))
+		}
+	}
+	atemLLBlock(ctx, "none")
+	atemLLInstr(ctx, LLInstrUnreachable{})
+	atemLLFuncEnd(ctx)
+}
+
+// atemLLThunkDispatcher emits `atem_call_thunk`, a switch over all thunks (numbered from 1, as 0 denotes "no thunk").
+func atemLLThunkDispatcher(ctx *CtxAtemToLL) {
+	ty_val := atem_ll_ty_val
+	atemLLFuncBegin(ctx, Str("atem_call_thunk"), ty_val, []LLFuncParam{{name: Str("thunk"), ty: atem_ll_ty_word}, {name: Str("env"), ty: ty_val}})
+	cases := ªLLSwitchCase(ctx.num_thunks)
+	for i := range cases {
+		cases[i] = LLSwitchCase{expr: atemLLWord(int64(i + 1)), block_name: uintToStr(uint64(i), 10, 1, Str("t"))}
+	}
+	atemLLInstr(ctx, LLInstrSwitch{comparee: atemLLLocal("thunk", atem_ll_ty_word), default_block_name: Str("none"), cases: cases})
+	for i := range cases {
+		atemLLBlock(ctx, string(cases[i].block_name))
+		atemLLRet(ctx, atemLLCall(ctx, ty_val, string(uintToStr(uint64(i), 10, 1, Str("atem_t"))), atemLLLocal("env", ty_val)))
+	}
+	atemLLBlock(ctx, "none")
+	atemLLInstr(ctx, LLInstrUnreachable{})
+	atemLLFuncEnd(ctx)
+}
+
+func atemLLRuntime(ctx *CtxAtemToLL) {
+	ty_val, ty_word, ty_bool, ty_cstr, ty_void := atem_ll_ty_val, atem_ll_ty_word, atem_ll_ty_bool, atem_ll_ty_cstr, atem_ll_ty_void
+	val, word, num, f, null := atemLLLocal("v", ty_val), atemLLWord, atemLLLocal("n", ty_word), atemLLLocal("f", ty_cstr), LLExprTyped{}
+
+	atemLLDeclare(ctx, "malloc", ty_cstr, ty_word)
+	atemLLDeclare(ctx, "fputc", atem_ll_ty_i32, atem_ll_ty_i32, ty_cstr)
+	atemLLDeclare(ctx, "fwrite", ty_word, ty_cstr, ty_word, ty_word, ty_cstr)
+	atemLLDeclare(ctx, "exit", ty_void, atem_ll_ty_i32)
+	for _, name := range []string{"stdout", "stderr"} {
+		ctx.ll_mod.globals[ctx.num_globals] = LLGlobal{name: Str(name), external: true, ty: ty_cstr}
+		ctx.num_globals++
+	}
+	ctx.ll_mod.globals[ctx.num_globals] = LLGlobal{name: Str("environ"), external: true, ty: LLTypePtr{ty: ty_cstr}} // rather than a 3rd `main` param, which `lli` doesn't pass
+	ctx.num_globals++
+	for _, msg := range [][2]string{{"atem_msg_ret_expr", "RET-EXPR:\t"}, {"atem_msg_null", "null"}, {"atem_msg_not_num", "not a num: "},
+		{"atem_msg_not_callable", "not callable: "}, {"atem_msg_div_zero", "integer divide by zero"}, {"atem_msg_op_eval", "OpEval not supported"}, {"atem_msg_op_unknown", "unknown op-code"}} {
+		ctx.ll_mod.globals[ctx.num_globals] = LLGlobal{name: Str(msg[0]), constant: true, ty: LLTypeArr{size: len(msg[1]), ty: atem_ll_ty_i8}, initializer: LLExprLitStr(msg[1])}
+		ctx.num_globals++
+	}
+
+	// memory & boxes
+
+	atemLLFuncBegin(ctx, Str("atem_alloc"), ty_val, []LLFuncParam{{name: Str("n"), ty: ty_word}})
+	mem := atemLLCall(ctx, ty_cstr, "malloc", atemLLOp(ctx, ll_bin_op_mul, num, word(8)))
+	atemLLRet(ctx, atemLLConv(ctx, ll_convert_int_to_ptr, atemLLConv(ctx, ll_convert_ptr_to_int, mem, ty_word), ty_val))
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_word"), ty_word, []LLFuncParam{{name: Str("v"), ty: ty_val}, {name: Str("idx"), ty: ty_word}})
+	ptr := atemLLLet(ctx, ty_val, LLInstrGep{ty: ty_word, base_ptr: val, indices: []LLExprTyped{atemLLLocal("idx", ty_word)}})
+	atemLLRet(ctx, atemLLLet(ctx, ty_word, LLInstrLoad{ty: ty_word, expr: ptr}))
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_set_word"), ty_void, []LLFuncParam{{name: Str("v"), ty: ty_val}, {name: Str("idx"), ty: ty_word}, {name: Str("w"), ty: ty_word}})
+	ptr = atemLLLet(ctx, ty_val, LLInstrGep{ty: ty_word, base_ptr: val, indices: []LLExprTyped{atemLLLocal("idx", ty_word)}})
+	atemLLInstr(ctx, LLInstrStore{dst: ptr, expr: atemLLLocal("w", ty_word)})
+	atemLLRetVoid(ctx)
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_get"), ty_val, []LLFuncParam{{name: Str("v"), ty: ty_val}, {name: Str("idx"), ty: ty_word}})
+	atemLLRet(ctx, atemLLConv(ctx, ll_convert_int_to_ptr, atemLLCall(ctx, ty_word, "atem_word", val, atemLLLocal("idx", ty_word)), ty_val))
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_set"), ty_void, []LLFuncParam{{name: Str("v"), ty: ty_val}, {name: Str("idx"), ty: ty_word}, {name: Str("val"), ty: ty_val}})
+	atemLLCall(ctx, ty_void, "atem_set_word", val, atemLLLocal("idx", ty_word), atemLLConv(ctx, ll_convert_ptr_to_int, atemLLLocal("val", ty_val), ty_word))
+	atemLLRetVoid(ctx)
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_box"), ty_val, []LLFuncParam{{name: Str("tag"), ty: ty_word}, {name: Str("n"), ty: ty_word}, {name: Str("nargs"), ty: ty_word}})
+	box := atemLLCall(ctx, ty_val, "atem_alloc", atemLLOp(ctx, ll_bin_op_add, atemLLLocal("nargs", ty_word), word(3)))
+	for i, name := range []string{"tag", "n", "nargs"} {
+		atemLLCall(ctx, ty_void, "atem_set_word", box, word(int64(i)), atemLLLocal(name, ty_word))
+	}
+	atemLLRet(ctx, box)
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_link"), ty_val, []LLFuncParam{{name: Str("head"), ty: ty_val}, {name: Str("tail"), ty: ty_val}})
+	box = atemLLBox(ctx, 2, word(int64(atem.StdFuncCons)), 2)
+	atemLLCall(ctx, ty_void, "atem_set", box, word(3), atemLLLocal("head", ty_val))
+	atemLLCall(ctx, ty_void, "atem_set", box, word(4), atemLLLocal("tail", ty_val))
+	atemLLRet(ctx, box)
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_bool"), ty_val, []LLFuncParam{{name: Str("b"), ty: ty_bool}})
+	atemLLBrIf(ctx, atemLLLocal("b", ty_bool), "true", "false")
+	atemLLBlock(ctx, "true")
+	atemLLRet(ctx, atemLLBox(ctx, 1, word(int64(atem.StdFuncTrue)), 0))
+	atemLLBlock(ctx, "false")
+	atemLLRet(ctx, atemLLBox(ctx, 1, word(int64(atem.StdFuncFalse)), 0))
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_num"), ty_word, []LLFuncParam{{name: Str("v"), ty: ty_val}})
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, atemLLCall(ctx, ty_word, "atem_word", val, word(0)), word(0)), "num", "fail")
+	atemLLBlock(ctx, "num")
+	atemLLRet(ctx, atemLLCall(ctx, ty_word, "atem_word", val, word(1)))
+	atemLLBlock(ctx, "fail")
+	atemLLFail(ctx, "atem_msg_not_num", val)
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_fail"), ty_void, []LLFuncParam{{name: Str("f"), ty: ty_cstr}, {name: Str("v"), ty: ty_val}})
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, atemLLConv(ctx, ll_convert_ptr_to_int, val, ty_word), word(0)), "end", "culprit")
+	atemLLBlock(ctx, "culprit")
+	atemLLCall(ctx, ty_void, "atem_write_json", f, val)
+	atemLLBr(ctx, "end")
+	atemLLBlock(ctx, "end")
+	atemLLPutc(ctx, f, '\n')
+	atemLLCall(ctx, ty_void, "exit", atemLLInt(atem_ll_ty_i32, 1))
+	atemLLInstr(ctx, LLInstrUnreachable{})
+	atemLLFuncEnd(ctx)
+
+	// prim-ops
+
+	atemLLFuncBegin(ctx, Str("atem_eq"), ty_bool, []LLFuncParam{{name: Str("v"), ty: ty_val}, {name: Str("w"), ty: ty_val}})
+	w := atemLLLocal("w", ty_val)
+	v_int, w_int := atemLLConv(ctx, ll_convert_ptr_to_int, val, ty_word), atemLLConv(ctx, ll_convert_ptr_to_int, w, ty_word)
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, v_int, w_int), "yes", "check_v")
+	atemLLBlock(ctx, "check_v")
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, v_int, word(0)), "no", "check_w")
+	atemLLBlock(ctx, "check_w")
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, w_int, word(0)), "no", "word0")
+	for i, next := range []string{"word1", "word2", "args"} {
+		atemLLBlock(ctx, string(uintToStr(uint64(i), 10, 1, Str("word"))))
+		atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, atemLLCall(ctx, ty_word, "atem_word", val, word(int64(i))), atemLLCall(ctx, ty_word, "atem_word", w, word(int64(i)))), next, "no")
+	}
+	atemLLBlock(ctx, "args")
+	atemLLRet(ctx, atemLLCall(ctx, ty_bool, "atem_eq_args", val, w, word(0), atemLLCall(ctx, ty_word, "atem_word", val, word(2))))
+	atemLLBlock(ctx, "yes")
+	atemLLRet(ctx, atemLLInt(ty_bool, 1))
+	atemLLBlock(ctx, "no")
+	atemLLRet(ctx, atemLLInt(ty_bool, 0))
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_eq_args"), ty_bool, []LLFuncParam{{name: Str("v"), ty: ty_val}, {name: Str("w"), ty: ty_val}, {name: Str("i"), ty: ty_word}, {name: Str("n"), ty: ty_word}})
+	idx := atemLLLocal("i", ty_word)
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, idx, num), "yes", "cmp")
+	atemLLBlock(ctx, "cmp")
+	arg_idx := atemLLOp(ctx, ll_bin_op_add, idx, word(3))
+	atemLLBrIf(ctx, atemLLCall(ctx, ty_bool, "atem_eq", atemLLCall(ctx, ty_val, "atem_get", val, arg_idx), atemLLCall(ctx, ty_val, "atem_get", w, arg_idx)), "next", "no")
+	atemLLBlock(ctx, "next")
+	atemLLRet(ctx, atemLLCall(ctx, ty_bool, "atem_eq_args", val, w, atemLLOp(ctx, ll_bin_op_add, idx, word(1)), num))
+	atemLLBlock(ctx, "yes")
+	atemLLRet(ctx, atemLLInt(ty_bool, 1))
+	atemLLBlock(ctx, "no")
+	atemLLRet(ctx, atemLLInt(ty_bool, 0))
+	atemLLFuncEnd(ctx)
+
+	lhs, rhs := atemLLLocal("lhs", ty_val), atemLLLocal("rhs", ty_val)
+	atemLLFuncBegin(ctx, Str("atem_op"), ty_val, []LLFuncParam{{name: Str("code"), ty: ty_word}, {name: Str("lhs"), ty: ty_val}, {name: Str("rhs"), ty: ty_val}})
+	ops := []struct {
+		code  atem.OpCode
+		block string
+		kind  LLBinOpKind
+	}{{atem.OpAdd, "add", ll_bin_op_add}, {atem.OpSub, "sub", ll_bin_op_sub}, {atem.OpMul, "mul", ll_bin_op_mul}, {atem.OpDiv, "div", ll_bin_op_sdiv}, {atem.OpMod, "mod", ll_bin_op_srem},
+		{atem.OpEq, "eq", 0}, {atem.OpLt, "lt", 0}, {atem.OpGt, "gt", 0}, {atem.OpPrt, "prt", 0}, {atem.OpEval, "eval", 0}, {atem.OpErr, "err", 0}}
+	cases := ªLLSwitchCase(len(ops))
+	for i := range ops {
+		cases[i] = LLSwitchCase{expr: atemLLWord(int64(ops[i].code)), block_name: Str(ops[i].block)}
+	}
+	atemLLInstr(ctx, LLInstrSwitch{comparee: atemLLLocal("code", ty_word), default_block_name: Str("unknown"), cases: cases})
+	for _, op := range ops[0:5] {
+		atemLLBlock(ctx, op.block)
+		l, r := atemLLCall(ctx, ty_word, "atem_num", lhs), atemLLCall(ctx, ty_word, "atem_num", rhs)
+		if op.code == atem.OpDiv || op.code == atem.OpMod {
+			atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, r, word(0)), "div_zero", op.block+"_ok")
+			atemLLBlock(ctx, op.block+"_ok")
+		}
+		atemLLRet(ctx, atemLLBox(ctx, 0, atemLLOp(ctx, op.kind, l, r), 0))
+	}
+	atemLLBlock(ctx, "div_zero")
+	atemLLFail(ctx, "atem_msg_div_zero", null)
+	atemLLBlock(ctx, "eq")
+	atemLLRet(ctx, atemLLCall(ctx, ty_val, "atem_bool", atemLLCall(ctx, ty_bool, "atem_eq", lhs, rhs)))
+	for _, op := range []struct {
+		block string
+		kind  LLCmpIKind
+	}{{"lt", ll_cmp_i_slt}, {"gt", ll_cmp_i_sgt}} {
+		atemLLBlock(ctx, op.block)
+		atemLLRet(ctx, atemLLCall(ctx, ty_val, "atem_bool", atemLLCmp(ctx, op.kind, atemLLCall(ctx, ty_word, "atem_num", lhs), atemLLCall(ctx, ty_word, "atem_num", rhs))))
+	}
+	atemLLBlock(ctx, "prt")
+	std_err := atemLLLoadStd(ctx, "stderr")
+	atemLLBrIf(ctx, atemLLCall(ctx, ty_bool, "atem_is_byte_list", lhs), "prt_lhs", "prt_rhs")
+	atemLLBlock(ctx, "prt_lhs")
+	atemLLCall(ctx, ty_void, "atem_write_bytes", std_err, lhs)
+	atemLLBr(ctx, "prt_rhs")
+	atemLLBlock(ctx, "prt_rhs")
+	atemLLPutc(ctx, std_err, '\t')
+	atemLLCall(ctx, ty_void, "atem_write_str", std_err, rhs)
+	atemLLPutc(ctx, std_err, '\n')
+	atemLLRet(ctx, rhs)
+	atemLLBlock(ctx, "eval")
+	atemLLFail(ctx, "atem_msg_op_eval", null)
+	atemLLBlock(ctx, "err") // as `cmd/atem` does for `atem.OpErr`
+	std_err = atemLLLoadStd(ctx, "stderr")
+	atemLLCall(ctx, ty_void, "atem_write_str", std_err, lhs)
+	atemLLPutc(ctx, std_err, '\t')
+	atemLLCall(ctx, ty_void, "atem_write_str", std_err, rhs)
+	atemLLPutc(ctx, std_err, '\n')
+	atemLLCall(ctx, ty_void, "exit", atemLLInt(atem_ll_ty_i32, 1))
+	atemLLInstr(ctx, LLInstrUnreachable{})
+	atemLLBlock(ctx, "unknown")
+	atemLLFail(ctx, "atem_msg_op_unknown", null)
+	atemLLFuncEnd(ctx)
+
+	// calls & closures
+
+	atemLLFuncBegin(ctx, Str("atem_force"), ty_val, []LLFuncParam{{name: Str("v"), ty: ty_val}})
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, atemLLConv(ctx, ll_convert_ptr_to_int, val, ty_word), word(0)), "done", "check_tag")
+	atemLLBlock(ctx, "check_tag")
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, atemLLCall(ctx, ty_word, "atem_word", val, word(0)), word(1)), "check_fn", "done")
+	atemLLBlock(ctx, "check_fn")
+	fn := atemLLCall(ctx, ty_word, "atem_word", val, word(1))
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_sge, fn, word(0)), "check_nargs", "done")
+	atemLLBlock(ctx, "check_nargs")
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, atemLLCall(ctx, ty_word, "atem_def_nargs", fn), word(0)), "call", "done")
+	atemLLBlock(ctx, "call")
+	atemLLRet(ctx, atemLLCall(ctx, ty_val, "atem_force", atemLLCall(ctx, ty_val, "atem_call_def", fn, val)))
+	atemLLBlock(ctx, "done")
+	atemLLRet(ctx, val)
+	atemLLFuncEnd(ctx)
+
+	// the `args` of `atem_apply` are `nargs` entries of 3 words each: the value, or else a thunk number (else 0) and its env
+	nargs, args := atemLLLocal("nargs", ty_word), atemLLLocal("args", ty_val)
+	atemLLFuncBegin(ctx, Str("atem_apply"), ty_val, []LLFuncParam{{name: Str("v"), ty: ty_val}, {name: Str("nargs"), ty: ty_word}, {name: Str("args"), ty: ty_val}})
+	callee := atemLLCall(ctx, ty_val, "atem_force", val)
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, nargs, word(0)), "ret_callee", "check_fn")
+	atemLLBlock(ctx, "ret_callee")
+	atemLLRet(ctx, callee)
+	atemLLBlock(ctx, "check_fn")
+	tag := atemLLCall(ctx, ty_word, "atem_word", callee, word(0))
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, tag, word(1)), "callable", "check_closure")
+	atemLLBlock(ctx, "check_closure")
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, tag, word(2)), "callable", "not_callable")
+	atemLLBlock(ctx, "not_callable")
+	atemLLFail(ctx, "atem_msg_not_callable", callee)
+	atemLLBlock(ctx, "callable")
+	fn = atemLLCall(ctx, ty_word, "atem_word", callee, word(1))
+	have := atemLLCall(ctx, ty_word, "atem_word", callee, word(2))
+	is_op := atemLLCmp(ctx, ll_cmp_i_slt, fn, word(0))
+	atemLLBrIf(ctx, is_op, "arity_op", "arity_def")
+	atemLLBlock(ctx, "arity_op")
+	atemLLBr(ctx, "arity")
+	atemLLBlock(ctx, "arity_def")
+	def_arity := atemLLCall(ctx, ty_word, "atem_def_nargs", fn)
+	atemLLBr(ctx, "arity")
+	atemLLBlock(ctx, "arity")
+	arity := atemLLLet(ctx, ty_word, LLInstrPhi{ty: ty_word, predecessors: []LLPhiPred{{block_name: Str("arity_op"), expr: LLExprLitInt(2)}, {block_name: Str("arity_def"), expr: def_arity.expr}}})
+	num_sels := atemLLCall(ctx, ty_word, "atem_def_nsels", fn)
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_sgt, num_sels, word(0)), "check_select", "apply")
+	atemLLBlock(ctx, "check_select")
+	num_given := atemLLOp(ctx, ll_bin_op_add, have, nargs)
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_sge, num_given, arity), "select", "apply")
+	atemLLBlock(ctx, "select") // saturated selector: short-cut just like the interpreter, never evaluating any of the args
+	selected := atemLLCall(ctx, ty_val, "atem_select", callee, fn, have, args, arity, num_sels, atemLLOp(ctx, ll_bin_op_sub, num_given, arity))
+	nargs_sel := atemLLOp(ctx, ll_bin_op_sub, atemLLOp(ctx, ll_bin_op_add, num_sels, num_given), atemLLOp(ctx, ll_bin_op_add, arity, word(1)))
+	args_sel := atemLLLet(ctx, ty_val, LLInstrGep{ty: ty_word, base_ptr: selected, indices: []LLExprTyped{word(3)}})
+	atemLLRet(ctx, atemLLCall(ctx, ty_val, "atem_apply", atemLLCall(ctx, ty_val, "atem_entry_val", selected), nargs_sel, args_sel))
+	atemLLBlock(ctx, "apply")
+	closure := atemLLCall(ctx, ty_val, "atem_box", word(2), fn, arity) // the new closure (if still not saturated), else its args become the callee's args
+	atemLLCall(ctx, ty_void, "atem_copy_args", closure, callee, word(0), have)
+	n := atemLLOp(ctx, ll_bin_op_sub, arity, have)
+	atemLLCall(ctx, ty_void, "atem_fill_args", closure, fn, have, word(0), n, nargs, args)
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_slt, nargs, n), "partial", "saturated")
+	atemLLBlock(ctx, "partial")
+	atemLLCall(ctx, ty_void, "atem_set_word", closure, word(2), atemLLOp(ctx, ll_bin_op_add, have, nargs))
+	atemLLRet(ctx, closure)
+	atemLLBlock(ctx, "saturated")
+	atemLLBrIf(ctx, is_op, "call_op", "call_def")
+	atemLLBlock(ctx, "call_op")
+	result_op := atemLLCall(ctx, ty_val, "atem_op", fn, atemLLCall(ctx, ty_val, "atem_get", closure, word(3)), atemLLCall(ctx, ty_val, "atem_get", closure, word(4)))
+	atemLLBr(ctx, "rest")
+	atemLLBlock(ctx, "call_def")
+	result_def := atemLLCall(ctx, ty_val, "atem_call_def", fn, atemLLLet(ctx, ty_val, LLInstrGep{ty: ty_word, base_ptr: closure, indices: []LLExprTyped{word(3)}}))
+	atemLLBr(ctx, "rest")
+	atemLLBlock(ctx, "rest")
+	result := atemLLLet(ctx, ty_val, LLInstrPhi{ty: ty_val, predecessors: []LLPhiPred{{block_name: Str("call_op"), expr: result_op.expr}, {block_name: Str("call_def"), expr: result_def.expr}}})
+	nargs_rest := atemLLOp(ctx, ll_bin_op_sub, nargs, n)
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, nargs_rest, word(0)), "ret_result", "more")
+	atemLLBlock(ctx, "ret_result")
+	atemLLRet(ctx, result)
+	atemLLBlock(ctx, "more") // over-saturated: the result gets the remaining args
+	args_rest := atemLLLet(ctx, ty_val, LLInstrGep{ty: ty_word, base_ptr: args, indices: []LLExprTyped{atemLLOp(ctx, ll_bin_op_mul, n, word(3))}})
+	atemLLRet(ctx, atemLLCall(ctx, ty_val, "atem_apply", result, nargs_rest, args_rest))
+	atemLLFuncEnd(ctx)
+
+	// the value of the `apply` args entry `v`, calling its thunk if any
+	atemLLFuncBegin(ctx, Str("atem_entry_val"), ty_val, []LLFuncParam{{name: Str("v"), ty: ty_val}})
+	thunk := atemLLCall(ctx, ty_word, "atem_word", val, word(1))
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, thunk, word(0)), "val", "thunk")
+	atemLLBlock(ctx, "val")
+	atemLLRet(ctx, atemLLCall(ctx, ty_val, "atem_get", val, word(0)))
+	atemLLBlock(ctx, "thunk")
+	atemLLRet(ctx, atemLLCall(ctx, ty_val, "atem_call_thunk", thunk, atemLLCall(ctx, ty_val, "atem_get", val, word(2))))
+	atemLLFuncEnd(ctx)
+
+	// the `apply` args entries for a saturated call of the selector `fn`: its selected callee, then the args it passes along, then the `nrest` excess args
+	atemLLFuncBegin(ctx, Str("atem_select"), ty_val, []LLFuncParam{{name: Str("v"), ty: ty_val}, {name: Str("fn"), ty: ty_word}, {name: Str("have"), ty: ty_word},
+		{name: Str("args"), ty: ty_val}, {name: Str("arity"), ty: ty_word}, {name: Str("n"), ty: ty_word}, {name: Str("nrest"), ty: ty_word}})
+	fn, have, arity, nrest := atemLLLocal("fn", ty_word), atemLLLocal("have", ty_word), atemLLLocal("arity", ty_word), atemLLLocal("nrest", ty_word)
+	selected = atemLLCall(ctx, ty_val, "atem_alloc", atemLLOp(ctx, ll_bin_op_mul, atemLLOp(ctx, ll_bin_op_add, num, nrest), word(3)))
+	atemLLCall(ctx, ty_void, "atem_select_args", selected, val, fn, have, args, word(0), num)
+	dst := atemLLLet(ctx, ty_val, LLInstrGep{ty: ty_word, base_ptr: selected, indices: []LLExprTyped{atemLLOp(ctx, ll_bin_op_mul, num, word(3))}})
+	src := atemLLLet(ctx, ty_val, LLInstrGep{ty: ty_word, base_ptr: args, indices: []LLExprTyped{atemLLOp(ctx, ll_bin_op_mul, atemLLOp(ctx, ll_bin_op_sub, arity, have), word(3))}})
+	atemLLCall(ctx, ty_void, "atem_copy_words", dst, src, word(0), atemLLOp(ctx, ll_bin_op_mul, nrest, word(3)))
+	atemLLRet(ctx, selected)
+	atemLLFuncEnd(ctx)
+
+	// sets entries `i` up to `n` of `s` to the args selected by `fn`, from the closure `v` if among its `have` args, else from the `apply` args
+	atemLLFuncBegin(ctx, Str("atem_select_args"), ty_void, []LLFuncParam{{name: Str("s"), ty: ty_val}, {name: Str("v"), ty: ty_val}, {name: Str("fn"), ty: ty_word},
+		{name: Str("have"), ty: ty_word}, {name: Str("args"), ty: ty_val}, {name: Str("i"), ty: ty_word}, {name: Str("n"), ty: ty_word}})
+	sels := atemLLLocal("s", ty_val)
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_sge, idx, num), "done", "select")
+	atemLLBlock(ctx, "select")
+	sel_idx, entry_idx := atemLLCall(ctx, ty_word, "atem_def_sel", fn, idx), atemLLOp(ctx, ll_bin_op_mul, idx, word(3))
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_slt, sel_idx, have), "closure_arg", "apply_arg")
+	atemLLBlock(ctx, "closure_arg")
+	atemLLCall(ctx, ty_void, "atem_set_word", sels, entry_idx, atemLLCall(ctx, ty_word, "atem_word", val, atemLLOp(ctx, ll_bin_op_add, sel_idx, word(3))))
+	atemLLCall(ctx, ty_void, "atem_set_word", sels, atemLLOp(ctx, ll_bin_op_add, entry_idx, word(1)), word(0))
+	atemLLBr(ctx, "next")
+	atemLLBlock(ctx, "apply_arg")
+	dst = atemLLLet(ctx, ty_val, LLInstrGep{ty: ty_word, base_ptr: sels, indices: []LLExprTyped{entry_idx}})
+	src = atemLLLet(ctx, ty_val, LLInstrGep{ty: ty_word, base_ptr: args, indices: []LLExprTyped{atemLLOp(ctx, ll_bin_op_mul, atemLLOp(ctx, ll_bin_op_sub, sel_idx, have), word(3))}})
+	atemLLCall(ctx, ty_void, "atem_copy_words", dst, src, word(0), word(3))
+	atemLLBr(ctx, "next")
+	atemLLBlock(ctx, "next")
+	atemLLCall(ctx, ty_void, "atem_select_args", sels, val, fn, have, args, atemLLOp(ctx, ll_bin_op_add, idx, word(1)), num)
+	atemLLRetVoid(ctx)
+	atemLLBlock(ctx, "done")
+	atemLLRetVoid(ctx)
+	atemLLFuncEnd(ctx)
+
+	// copies words `i` up to `n` from `w` to `v`
+	atemLLFuncBegin(ctx, Str("atem_copy_words"), ty_void, []LLFuncParam{{name: Str("v"), ty: ty_val}, {name: Str("w"), ty: ty_val}, {name: Str("i"), ty: ty_word}, {name: Str("n"), ty: ty_word}})
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_sge, idx, num), "done", "copy")
+	atemLLBlock(ctx, "copy")
+	atemLLCall(ctx, ty_void, "atem_set_word", val, idx, atemLLCall(ctx, ty_word, "atem_word", atemLLLocal("w", ty_val), idx))
+	atemLLCall(ctx, ty_void, "atem_copy_words", val, atemLLLocal("w", ty_val), atemLLOp(ctx, ll_bin_op_add, idx, word(1)), num)
+	atemLLRetVoid(ctx)
+	atemLLBlock(ctx, "done")
+	atemLLRetVoid(ctx)
+	atemLLFuncEnd(ctx)
+
+	// copies closure args `i` up to `n` from `src` to `dst`
+	atemLLFuncBegin(ctx, Str("atem_copy_args"), ty_void, []LLFuncParam{{name: Str("v"), ty: ty_val}, {name: Str("w"), ty: ty_val}, {name: Str("i"), ty: ty_word}, {name: Str("n"), ty: ty_word}})
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_sge, idx, num), "done", "copy")
+	atemLLBlock(ctx, "copy")
+	arg_idx = atemLLOp(ctx, ll_bin_op_add, idx, word(3))
+	atemLLCall(ctx, ty_void, "atem_set_word", val, arg_idx, atemLLCall(ctx, ty_word, "atem_word", w, arg_idx))
+	atemLLCall(ctx, ty_void, "atem_copy_args", val, w, atemLLOp(ctx, ll_bin_op_add, idx, word(1)), num)
+	atemLLRetVoid(ctx)
+	atemLLBlock(ctx, "done")
+	atemLLRetVoid(ctx)
+	atemLLFuncEnd(ctx)
+
+	// sets closure args `have+i` up to `have+n` from the `apply` args `i` up to `nargs`, evaluating only those used by `fn`
+	atemLLFuncBegin(ctx, Str("atem_fill_args"), ty_void, []LLFuncParam{{name: Str("v"), ty: ty_val}, {name: Str("fn"), ty: ty_word}, {name: Str("have"), ty: ty_word},
+		{name: Str("i"), ty: ty_word}, {name: Str("n"), ty: ty_word}, {name: Str("nargs"), ty: ty_word}, {name: Str("args"), ty: ty_val}})
+	fn, have = atemLLLocal("fn", ty_word), atemLLLocal("have", ty_word)
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_sge, idx, num), "done", "check_nargs")
+	atemLLBlock(ctx, "check_nargs")
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_sge, idx, nargs), "done", "fill")
+	atemLLBlock(ctx, "fill")
+	arg_idx = atemLLOp(ctx, ll_bin_op_add, have, idx)
+	dst_idx := atemLLOp(ctx, ll_bin_op_add, arg_idx, word(3))
+	atemLLBrIf(ctx, atemLLCall(ctx, ty_bool, "atem_def_arg_used", fn, arg_idx), "used", "unused")
+	atemLLBlock(ctx, "unused")
+	atemLLCall(ctx, ty_void, "atem_set_word", val, dst_idx, word(0))
+	atemLLBr(ctx, "next")
+	atemLLBlock(ctx, "used")
+	entry_idx = atemLLOp(ctx, ll_bin_op_mul, idx, word(3))
+	thunk = atemLLCall(ctx, ty_word, "atem_word", args, atemLLOp(ctx, ll_bin_op_add, entry_idx, word(1)))
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, thunk, word(0)), "val", "thunk")
+	atemLLBlock(ctx, "val")
+	atemLLCall(ctx, ty_void, "atem_set_word", val, dst_idx, atemLLCall(ctx, ty_word, "atem_word", args, entry_idx))
+	atemLLBr(ctx, "next")
+	atemLLBlock(ctx, "thunk")
+	env := atemLLCall(ctx, ty_val, "atem_get", args, atemLLOp(ctx, ll_bin_op_add, entry_idx, word(2)))
+	atemLLCall(ctx, ty_void, "atem_set", val, dst_idx, atemLLCall(ctx, ty_val, "atem_call_thunk", thunk, env))
+	atemLLBr(ctx, "next")
+	atemLLBlock(ctx, "next")
+	atemLLCall(ctx, ty_void, "atem_fill_args", val, fn, have, atemLLOp(ctx, ll_bin_op_add, idx, word(1)), num, nargs, args)
+	atemLLRetVoid(ctx)
+	atemLLBlock(ctx, "done")
+	atemLLRetVoid(ctx)
+	atemLLFuncEnd(ctx)
+
+	// lists & output
+
+	atemLLFuncBegin(ctx, Str("atem_list_from"), ty_val, []LLFuncParam{{name: Str("s"), ty: ty_cstr}})
+	str := atemLLLocal("s", ty_cstr)
+	char := atemLLLet(ctx, atem_ll_ty_i8, LLInstrLoad{ty: atem_ll_ty_i8, expr: str})
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, char, atemLLInt(atem_ll_ty_i8, 0)), "end", "link")
+	atemLLBlock(ctx, "end")
+	atemLLRet(ctx, atemLLBox(ctx, 1, word(int64(atem.StdFuncNil)), 0))
+	atemLLBlock(ctx, "link")
+	head := atemLLBox(ctx, 0, atemLLConv(ctx, ll_convert_zext, char, ty_word), 0)
+	tail := atemLLCall(ctx, ty_val, "atem_list_from", atemLLLet(ctx, ty_cstr, LLInstrGep{ty: atem_ll_ty_i8, base_ptr: str, indices: []LLExprTyped{word(1)}}))
+	atemLLRet(ctx, atemLLCall(ctx, ty_val, "atem_link", head, tail))
+	atemLLFuncEnd(ctx)
+
+	ty_cstrs := LLTypePtr{ty: ty_cstr}
+	atemLLFuncBegin(ctx, Str("atem_lists_from"), ty_val, []LLFuncParam{{name: Str("strs"), ty: ty_cstrs}})
+	strs := atemLLLocal("strs", ty_cstrs)
+	str = atemLLLet(ctx, ty_cstr, LLInstrLoad{ty: ty_cstr, expr: strs})
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, atemLLConv(ctx, ll_convert_ptr_to_int, str, ty_word), word(0)), "end", "link")
+	atemLLBlock(ctx, "end")
+	atemLLRet(ctx, atemLLBox(ctx, 1, word(int64(atem.StdFuncNil)), 0))
+	atemLLBlock(ctx, "link")
+	head = atemLLCall(ctx, ty_val, "atem_list_from", str)
+	tail = atemLLCall(ctx, ty_val, "atem_lists_from", atemLLLet(ctx, ty_cstrs, LLInstrGep{ty: ty_cstr, base_ptr: strs, indices: []LLExprTyped{word(1)}}))
+	atemLLRet(ctx, atemLLCall(ctx, ty_val, "atem_link", head, tail))
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_is_byte_list"), ty_bool, []LLFuncParam{{name: Str("v"), ty: ty_val}})
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, atemLLConv(ctx, ll_convert_ptr_to_int, val, ty_word), word(0)), "no", "check_tag")
+	atemLLBlock(ctx, "check_tag")
+	tag = atemLLCall(ctx, ty_word, "atem_word", val, word(0))
+	fn = atemLLCall(ctx, ty_word, "atem_word", val, word(1))
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, tag, word(1)), "check_end", "check_closure")
+	atemLLBlock(ctx, "check_end")
+	atemLLRet(ctx, atemLLCmp(ctx, ll_cmp_i_eq, fn, word(int64(atem.StdFuncNil))))
+	atemLLBlock(ctx, "check_closure")
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, tag, word(2)), "check_cons", "no")
+	atemLLBlock(ctx, "check_cons")
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, fn, word(int64(atem.StdFuncCons))), "check_nargs", "no")
+	atemLLBlock(ctx, "check_nargs")
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, atemLLCall(ctx, ty_word, "atem_word", val, word(2)), word(2)), "check_head", "no")
+	atemLLBlock(ctx, "check_head")
+	head = atemLLCall(ctx, ty_val, "atem_get", val, word(3))
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, atemLLCall(ctx, ty_word, "atem_word", head, word(0)), word(0)), "check_byte_min", "no")
+	atemLLBlock(ctx, "check_byte_min")
+	byte_val := atemLLCall(ctx, ty_word, "atem_word", head, word(1))
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_sge, byte_val, word(0)), "check_byte_max", "no")
+	atemLLBlock(ctx, "check_byte_max")
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_sle, byte_val, word(255)), "tail", "no")
+	atemLLBlock(ctx, "tail")
+	atemLLRet(ctx, atemLLCall(ctx, ty_bool, "atem_is_byte_list", atemLLCall(ctx, ty_val, "atem_get", val, word(4))))
+	atemLLBlock(ctx, "no")
+	atemLLRet(ctx, atemLLInt(ty_bool, 0))
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_write_bytes"), ty_void, []LLFuncParam{{name: Str("f"), ty: ty_cstr}, {name: Str("v"), ty: ty_val}})
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, atemLLCall(ctx, ty_word, "atem_word", val, word(0)), word(1)), "done", "write")
+	atemLLBlock(ctx, "write")
+	byte_val = atemLLCall(ctx, ty_word, "atem_word", atemLLCall(ctx, ty_val, "atem_get", val, word(3)), word(1))
+	atemLLCall(ctx, atem_ll_ty_i32, "fputc", atemLLConv(ctx, ll_convert_trunc, byte_val, atem_ll_ty_i32), f)
+	atemLLCall(ctx, ty_void, "atem_write_bytes", f, atemLLCall(ctx, ty_val, "atem_get", val, word(4)))
+	atemLLRetVoid(ctx)
+	atemLLBlock(ctx, "done")
+	atemLLRetVoid(ctx)
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_write_str"), ty_void, []LLFuncParam{{name: Str("f"), ty: ty_cstr}, {name: Str("v"), ty: ty_val}})
+	atemLLBrIf(ctx, atemLLCall(ctx, ty_bool, "atem_is_byte_list", val), "bytes", "json")
+	atemLLBlock(ctx, "bytes")
+	atemLLCall(ctx, ty_void, "atem_write_bytes", f, val)
+	atemLLRetVoid(ctx)
+	atemLLBlock(ctx, "json")
+	atemLLCall(ctx, ty_void, "atem_write_json", f, val)
+	atemLLRetVoid(ctx)
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_write_json"), ty_void, []LLFuncParam{{name: Str("f"), ty: ty_cstr}, {name: Str("v"), ty: ty_val}})
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_eq, atemLLConv(ctx, ll_convert_ptr_to_int, val, ty_word), word(0)), "null", "tag")
+	atemLLBlock(ctx, "null")
+	atemLLWriteMsg(ctx, f, "atem_msg_null")
+	atemLLRetVoid(ctx)
+	atemLLBlock(ctx, "tag")
+	num_val := atemLLCall(ctx, ty_word, "atem_word", val, word(1))
+	atemLLInstr(ctx, LLInstrSwitch{comparee: atemLLCall(ctx, ty_word, "atem_word", val, word(0)), default_block_name: Str("closure"),
+		cases: []LLSwitchCase{{expr: word(0), block_name: Str("num")}, {expr: word(1), block_name: Str("fn")}}})
+	atemLLBlock(ctx, "num")
+	atemLLCall(ctx, ty_void, "atem_write_num", f, num_val)
+	atemLLRetVoid(ctx)
+	atemLLBlock(ctx, "fn")
+	atemLLPutc(ctx, f, '[')
+	atemLLCall(ctx, ty_void, "atem_write_num", f, num_val)
+	atemLLPutc(ctx, f, ']')
+	atemLLRetVoid(ctx)
+	atemLLBlock(ctx, "closure")
+	atemLLPutc(ctx, f, '[')
+	atemLLPutc(ctx, f, '[')
+	atemLLCall(ctx, ty_void, "atem_write_num", f, num_val)
+	atemLLPutc(ctx, f, ']')
+	atemLLCall(ctx, ty_void, "atem_write_json_args", f, val, word(0), atemLLCall(ctx, ty_word, "atem_word", val, word(2)))
+	atemLLPutc(ctx, f, ']')
+	atemLLRetVoid(ctx)
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_write_json_args"), ty_void, []LLFuncParam{{name: Str("f"), ty: ty_cstr}, {name: Str("v"), ty: ty_val}, {name: Str("i"), ty: ty_word}, {name: Str("n"), ty: ty_word}})
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_sge, idx, num), "done", "write")
+	atemLLBlock(ctx, "write")
+	atemLLPutc(ctx, f, ',')
+	atemLLPutc(ctx, f, ' ')
+	atemLLCall(ctx, ty_void, "atem_write_json", f, atemLLCall(ctx, ty_val, "atem_get", val, atemLLOp(ctx, ll_bin_op_add, idx, word(3))))
+	atemLLCall(ctx, ty_void, "atem_write_json_args", f, val, atemLLOp(ctx, ll_bin_op_add, idx, word(1)), num)
+	atemLLRetVoid(ctx)
+	atemLLBlock(ctx, "done")
+	atemLLRetVoid(ctx)
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_write_num"), ty_void, []LLFuncParam{{name: Str("f"), ty: ty_cstr}, {name: Str("n"), ty: ty_word}})
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_slt, num, word(0)), "neg", "pos")
+	atemLLBlock(ctx, "neg")
+	atemLLPutc(ctx, f, '-')
+	atemLLCall(ctx, ty_void, "atem_write_digits", f, atemLLOp(ctx, ll_bin_op_sub, word(0), num))
+	atemLLRetVoid(ctx)
+	atemLLBlock(ctx, "pos")
+	atemLLCall(ctx, ty_void, "atem_write_digits", f, num)
+	atemLLRetVoid(ctx)
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("atem_write_digits"), ty_void, []LLFuncParam{{name: Str("f"), ty: ty_cstr}, {name: Str("n"), ty: ty_word}})
+	quot := atemLLOp(ctx, ll_bin_op_udiv, num, word(10))
+	atemLLBrIf(ctx, atemLLCmp(ctx, ll_cmp_i_ugt, quot, word(0)), "prefix", "digit")
+	atemLLBlock(ctx, "prefix")
+	atemLLCall(ctx, ty_void, "atem_write_digits", f, quot)
+	atemLLBr(ctx, "digit")
+	atemLLBlock(ctx, "digit")
+	digit := atemLLOp(ctx, ll_bin_op_sub, num, atemLLOp(ctx, ll_bin_op_mul, quot, word(10)))
+	atemLLCall(ctx, atem_ll_ty_i32, "fputc", atemLLConv(ctx, ll_convert_trunc, atemLLOp(ctx, ll_bin_op_add, digit, word('0')), atem_ll_ty_i32), f)
+	atemLLRetVoid(ctx)
+	atemLLFuncEnd(ctx)
+
+	atemLLFuncBegin(ctx, Str("main"), atem_ll_ty_i32, []LLFuncParam{{name: Str("argc"), ty: atem_ll_ty_i32}, {name: Str("argv"), ty: ty_cstrs}})
+	entries := atemLLCall(ctx, ty_val, "atem_alloc", word(6))
+	argv_rest := atemLLLet(ctx, ty_cstrs, LLInstrGep{ty: ty_cstr, base_ptr: atemLLLocal("argv", ty_cstrs), indices: []LLExprTyped{word(1)}})
+	atemLLCall(ctx, ty_void, "atem_set", entries, word(0), atemLLCall(ctx, ty_val, "atem_lists_from", argv_rest))
+	atemLLCall(ctx, ty_void, "atem_set_word", entries, word(1), word(0))
+	atemLLCall(ctx, ty_void, "atem_set", entries, word(3), atemLLCall(ctx, ty_val, "atem_lists_from", atemLLLet(ctx, ty_cstrs, LLInstrLoad{ty: ty_cstrs, expr: LLExprTyped{ty: LLTypePtr{ty: ty_cstrs}, expr: LLExprIdentGlobal("environ")}})))
+	atemLLCall(ctx, ty_void, "atem_set_word", entries, word(4), word(0))
+	main_fn := atemLLBox(ctx, 1, word(int64(len(ctx.prog)-1)), 0) // `main` is always last by convention
+	result = atemLLCall(ctx, ty_val, "atem_force", atemLLCall(ctx, ty_val, "atem_apply", main_fn, word(2), entries))
+	atemLLBrIf(ctx, atemLLCall(ctx, ty_bool, "atem_is_byte_list", result), "out_str", "out_expr")
+	atemLLBlock(ctx, "out_str")
+	std_out := atemLLLoadStd(ctx, "stdout")
+	atemLLCall(ctx, ty_void, "atem_write_bytes", std_out, result)
+	atemLLPutc(ctx, std_out, '\n')
+	atemLLRet(ctx, atemLLInt(atem_ll_ty_i32, 0))
+	atemLLBlock(ctx, "out_expr")
+	std_err = atemLLLoadStd(ctx, "stderr")
+	atemLLWriteMsg(ctx, std_err, "atem_msg_ret_expr")
+	atemLLCall(ctx, ty_void, "atem_write_json", std_err, result)
+	atemLLPutc(ctx, std_err, '\n')
+	atemLLRet(ctx, atemLLInt(atem_ll_ty_i32, 0))
+	atemLLFuncEnd(ctx)
+}
+
+// helpers for the above, all emitting into the current basic block of `ctx.cur_func`
+
+func atemLLFuncBegin(ctx *CtxAtemToLL, name Str, ty LLType, params []LLFuncParam) {
+	if ctx.num_funcs == len(ctx.ll_mod.funcs) {
+		funcs := ªLLFunc(2 * len(ctx.ll_mod.funcs))
+		for i := range ctx.ll_mod.funcs {
+			funcs[i] = ctx.ll_mod.funcs[i]
+		}
+		ctx.ll_mod.funcs = funcs
+	}
+	ctx.ll_mod.funcs[ctx.num_funcs] = LLFunc{name: name, ty: ty, params: params, basic_blocks: ªLLBasicBlock(8)}
+	ctx.cur_func = &ctx.ll_mod.funcs[ctx.num_funcs]
+	ctx.num_funcs++
+	ctx.cur_num_blocks, ctx.cur_num_instrs, ctx.cur_num_temps = 0, 0, 0
+	atemLLBlock(ctx, "begin")
+}
+
+func atemLLFuncEnd(ctx *CtxAtemToLL) {
+	block := &ctx.cur_func.basic_blocks[ctx.cur_num_blocks-1]
+	block.instrs = block.instrs[0:ctx.cur_num_instrs]
+	ctx.cur_func.basic_blocks = ctx.cur_func.basic_blocks[0:ctx.cur_num_blocks]
+	ctx.cur_func = nil
+}
+
+func atemLLBlock(ctx *CtxAtemToLL, name string) {
+	if ctx.cur_num_blocks > 0 {
+		block := &ctx.cur_func.basic_blocks[ctx.cur_num_blocks-1]
+		block.instrs = block.instrs[0:ctx.cur_num_instrs]
+	}
+	if ctx.cur_num_blocks == len(ctx.cur_func.basic_blocks) {
+		blocks := ªLLBasicBlock(2 * len(ctx.cur_func.basic_blocks))
+		for i := range ctx.cur_func.basic_blocks {
+			blocks[i] = ctx.cur_func.basic_blocks[i]
+		}
+		ctx.cur_func.basic_blocks = blocks
+	}
+	ctx.cur_func.basic_blocks[ctx.cur_num_blocks] = LLBasicBlock{name: Str(name), instrs: ªLLInstr(16)}
+	ctx.cur_num_blocks++
+	ctx.cur_num_instrs = 0
+}
+
+func atemLLInstr(ctx *CtxAtemToLL, instr LLInstr) {
+	block := &ctx.cur_func.basic_blocks[ctx.cur_num_blocks-1]
+	if ctx.cur_num_instrs == len(block.instrs) {
+		instrs := ªLLInstr(2 * len(block.instrs))
+		for i := range block.instrs {
+			instrs[i] = block.instrs[i]
+		}
+		block.instrs = instrs
+	}
+	block.instrs[ctx.cur_num_instrs] = instr
+	ctx.cur_num_instrs++
+}
+
+func atemLLDeclare(ctx *CtxAtemToLL, name string, ty LLType, param_tys ...LLType) {
+	params := ªLLFuncParam(len(param_tys))
+	for i := range param_tys {
+		params[i].ty = param_tys[i]
+	}
+	ctx.ll_mod.funcs[ctx.num_funcs] = LLFunc{external: true, name: Str(name), ty: ty, params: params}
+	ctx.num_funcs++
+}
+
+func atemLLTempName(num int) Str {
+	return uintToStr(uint64(num), 10, 1, Str("tmp"))
+}
+
+func atemLLLet(ctx *CtxAtemToLL, ty LLType, instr LLInstr) LLExprTyped {
+	ctx.cur_num_temps++
+	name := atemLLTempName(ctx.cur_num_temps)
+	atemLLInstr(ctx, LLInstrLet{name: name, instr: instr})
+	return LLExprTyped{ty: ty, expr: LLExprIdentLocal(name)}
+}
+
+func atemLLCall(ctx *CtxAtemToLL, ty LLType, callee string, args ...LLExprTyped) LLExprTyped {
+	call := LLInstrCall{ty: ty, callee: LLExprIdentGlobal(callee), args: args}
+	if _, is_void := ty.(LLTypeVoid); is_void {
+		atemLLInstr(ctx, call)
+		return LLExprTyped{ty: ty, expr: LLExprLitVoid{}}
+	}
+	return atemLLLet(ctx, ty, call)
+}
+
+func atemLLBox(ctx *CtxAtemToLL, tag int64, num LLExprTyped, nargs int) LLExprTyped {
+	return atemLLCall(ctx, atem_ll_ty_val, "atem_box", atemLLWord(tag), num, atemLLWord(int64(nargs)))
+}
+
+func atemLLOp(ctx *CtxAtemToLL, kind LLBinOpKind, lhs LLExprTyped, rhs LLExprTyped) LLExprTyped {
+	return atemLLLet(ctx, lhs.ty, LLInstrBinOp{ty: lhs.ty, lhs: lhs.expr, rhs: rhs.expr, op_kind: kind})
+}
+
+func atemLLCmp(ctx *CtxAtemToLL, kind LLCmpIKind, lhs LLExprTyped, rhs LLExprTyped) LLExprTyped {
+	return atemLLLet(ctx, atem_ll_ty_bool, LLInstrCmpI{ty: lhs.ty, lhs: lhs.expr, rhs: rhs.expr, cmp_kind: kind})
+}
+
+func atemLLConv(ctx *CtxAtemToLL, kind LLConvertKind, expr LLExprTyped, ty LLType) LLExprTyped {
+	return atemLLLet(ctx, ty, LLInstrConvert{ty: ty, expr: expr, convert_kind: kind})
+}
+
+func atemLLBr(ctx *CtxAtemToLL, block_name string) {
+	atemLLInstr(ctx, LLInstrBrTo{block_name: Str(block_name)})
+}
+
+func atemLLBrIf(ctx *CtxAtemToLL, cond LLExprTyped, if_true string, if_false string) {
+	atemLLInstr(ctx, LLInstrBrIf{cond: cond.expr, block_name_if_true: Str(if_true), block_name_if_false: Str(if_false)})
+}
+
+func atemLLRet(ctx *CtxAtemToLL, expr LLExprTyped) {
+	atemLLInstr(ctx, LLInstrRet{expr: expr})
+}
+
+func atemLLRetVoid(ctx *CtxAtemToLL) {
+	atemLLInstr(ctx, LLInstrRet{expr: LLExprTyped{ty: atem_ll_ty_void, expr: LLExprLitVoid{}}})
+}
+
+func atemLLLoadStd(ctx *CtxAtemToLL, name string) LLExprTyped {
+	return atemLLLet(ctx, atem_ll_ty_cstr, LLInstrLoad{ty: atem_ll_ty_cstr, expr: LLExprTyped{ty: LLTypePtr{ty: atem_ll_ty_cstr}, expr: LLExprIdentGlobal(name)}})
+}
+
+func atemLLPutc(ctx *CtxAtemToLL, file LLExprTyped, char byte) {
+	atemLLCall(ctx, atem_ll_ty_i32, "fputc", atemLLInt(atem_ll_ty_i32, int64(char)), file)
+}
+
+func atemLLWriteMsg(ctx *CtxAtemToLL, file LLExprTyped, msg_global_name string) {
+	ty := llTopLevelNameFind(ctx.ll_mod, Str(msg_global_name)).(*LLGlobal).ty
+	ptr := atemLLLet(ctx, atem_ll_ty_cstr, LLInstrGep{ty: ty, base_ptr: LLExprTyped{ty: LLTypePtr{ty: ty}, expr: LLExprIdentGlobal(msg_global_name)}, indices: []LLExprTyped{atemLLWord(0), atemLLWord(0)}})
+	atemLLCall(ctx, atem_ll_ty_word, "fwrite", ptr, atemLLWord(1), atemLLWord(int64(ty.(LLTypeArr).size)), file)
+}
+
+// atemLLFail writes the message, and the `culprit` unless a zero `LLExprTyped`, to stderr and exits.
+func atemLLFail(ctx *CtxAtemToLL, msg_global_name string, culprit LLExprTyped) {
+	std_err := atemLLLoadStd(ctx, "stderr")
+	atemLLWriteMsg(ctx, std_err, msg_global_name)
+	if culprit.ty == nil {
+		culprit = atemLLConv(ctx, ll_convert_int_to_ptr, atemLLWord(0), atem_ll_ty_val)
+	}
+	atemLLCall(ctx, atem_ll_ty_void, "atem_fail", std_err, culprit)
+	atemLLInstr(ctx, LLInstrUnreachable{})
+}
+
+func atemLLLocal(name string, ty LLType) LLExprTyped {
+	return LLExprTyped{ty: ty, expr: LLExprIdentLocal(name)}
+}
+
+func atemLLInt(ty LLType, n int64) LLExprTyped {
+	return LLExprTyped{ty: ty, expr: LLExprLitInt(n)}
+}
+
+func atemLLWord(n int64) LLExprTyped {
+	return atemLLInt(atem_ll_ty_word, n)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	atem "github.com/metaleap/atmo/old/atem"
+	"github.com/metaleap/atmo/old/atem/golden"
+)
+
+// testAtemCases returns all `.opt` programs in `atem/tmpdummies` that have `.expected` files.
+func testAtemCases(t *testing.T) (ret []golden.Case) {
+	cases, err := golden.Discover(filepath.Join("..", "..", "atem", "tmpdummies"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, it := range cases {
+		if it.Expected != nil && strings.HasSuffix(it.SrcFilePath, ".opt.json") {
+			ret = append(ret, it)
+		}
+	}
+	if len(ret) == 0 {
+		t.Fatal("no .opt programs found")
+	}
+	return
+}
+
+// testAtemToLL loads the atem program at `srcFilePath` and returns it along with the `llEmit`ted `.ll` text for it.
+func testAtemToLL(t *testing.T, srcFilePath string) (atem.Prog, string) {
+	src, err := ioutil.ReadFile(srcFilePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog := atem.LoadFromJson(src)
+	ll_mod := llModuleFromAtem(prog)
+
+	file, err := ioutil.TempFile(t.TempDir(), "*.ll")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	old_stdout := stdout
+	stdout = file
+	llEmit(&ll_mod)
+	stdout = old_stdout
+	out, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return prog, string(out)
+}
+
+// TestAtemToLL structurally checks the `.ll` text emitted for all `.opt` programs: every
+// `define` is closed and its basic blocks end in terminators, all branch targets are
+// blocks of the same func, all called funcs are defined or declared, every `FuncDef`
+// has its `LLFunc` and selectors are only ever called via the `atem_call_def` dispatcher.
+func TestAtemToLL(t *testing.T) {
+	for _, it := range testAtemCases(t) {
+		name := strings.TrimSuffix(filepath.Base(it.SrcFilePath), ".json")
+		prog, src := testAtemToLL(t, it.SrcFilePath)
+
+		funcs, declared := map[string][]string{}, map[string]bool{}
+		var cur_func string
+		for _, line := range strings.Split(src, "\n") {
+			switch {
+			case strings.HasPrefix(line, "declare "):
+				declared[testLLFuncName(line)] = true
+			case strings.HasPrefix(line, "define "):
+				if cur_func != "" {
+					t.Fatalf("%s: @%s not closed before: %s", name, cur_func, line)
+				}
+				if cur_func = testLLFuncName(line); funcs[cur_func] != nil {
+					t.Fatalf("%s: @%s defined more than once", name, cur_func)
+				}
+				funcs[cur_func] = []string{line}
+			case line == "}":
+				if cur_func == "" {
+					t.Fatalf("%s: unexpected closing brace", name)
+				}
+				funcs[cur_func], cur_func = append(funcs[cur_func], line), ""
+			case cur_func != "":
+				funcs[cur_func] = append(funcs[cur_func], line)
+			}
+		}
+		if cur_func != "" {
+			t.Fatalf("%s: @%s not closed", name, cur_func)
+		}
+
+		for fn_name, lines := range funcs {
+			blocks, targets, last_instr := map[string]bool{}, []string{}, ""
+			check_terminated := func(next string) {
+				if last_instr != "" && !(strings.HasPrefix(last_instr, "ret ") || strings.HasPrefix(last_instr, "br ") ||
+					strings.HasPrefix(last_instr, "switch ") || last_instr == "unreachable") {
+					t.Errorf("%s: in @%s, block before %q not terminated by: %s", name, fn_name, next, last_instr)
+				}
+			}
+			for _, line := range lines[1 : len(lines)-1] {
+				if strings.HasSuffix(line, ":") && !strings.HasPrefix(line, " ") {
+					check_terminated(line)
+					blocks[strings.TrimSuffix(line, ":")], last_instr = true, ""
+					continue
+				} else if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, ";") && !strings.HasPrefix(line, "    ") {
+					last_instr = trimmed
+					if idx := strings.Index(trimmed, "= "); idx > 0 && strings.HasPrefix(trimmed, "%") {
+						last_instr = trimmed[idx+2:]
+					}
+				}
+				for _, field := range strings.Split(line, "label %")[1:] {
+					targets = append(targets, strings.TrimRight(strings.FieldsFunc(field, func(r rune) bool { return r == ',' || r == ' ' })[0], "]"))
+				}
+				for _, field := range strings.Split(line, "call ")[1:] {
+					if idx := strings.Index(field, "@"); idx > 0 {
+						callee := field[idx+1 : idx+strings.IndexByte(field[idx:], '(')]
+						if funcs[callee] == nil && !declared[callee] {
+							t.Errorf("%s: in @%s, call of undefined @%s", name, fn_name, callee)
+						}
+						if callee_idx, err := strconv.Atoi(strings.TrimPrefix(callee, "atem_f")); err == nil && fn_name != "atem_call_def" && prog[callee_idx].IsSelector() {
+							t.Errorf("%s: in @%s, direct call of selector @%s", name, fn_name, callee)
+						}
+					}
+				}
+			}
+			check_terminated("}")
+			for _, target := range targets {
+				if !blocks[target] {
+					t.Errorf("%s: in @%s, branch to unknown block %%%s", name, fn_name, target)
+				}
+			}
+		}
+
+		for i := range prog {
+			if funcs["atem_f"+strconv.Itoa(i)] == nil {
+				t.Errorf("%s: no @atem_f%d for %v", name, i, prog[i].Meta)
+			}
+		}
+		for _, fn_name := range []string{"main", "atem_apply", "atem_call_def", "atem_call_thunk", "atem_def_nargs", "atem_def_arg_used", "atem_def_nsels", "atem_def_sel"} {
+			if funcs[fn_name] == nil {
+				t.Errorf("%s: no @%s", name, fn_name)
+			}
+		}
+		if main := funcs["main"]; main != nil && main[0] != "define i32 @main(i32 %argc, i8** %argv) {" {
+			t.Errorf("%s: unexpected `main` signature: %s", name, main[0])
+		}
+	}
+}
+
+// TestAtemToLLWithLli runs the `.ll` emitted for all `.opt` programs (other than those
+// reading `stdin`) via `lli`, failing on any output differing from that of `Prog.Eval`.
+// Skipped if there's no `lli`.
+func TestAtemToLLWithLli(t *testing.T) {
+	lli, err := exec.LookPath("lli")
+	if err != nil {
+		t.Skip("no lli on PATH")
+	}
+	dir_path := t.TempDir()
+	for _, it := range testAtemCases(t) {
+		if it.Stdin != nil { // no `stdin` handler protocol, see `atem_to_ll.go`
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(it.SrcFilePath), ".json")
+		want, err := it.Run(atem.EngineInterp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, src := testAtemToLL(t, it.SrcFilePath)
+		ll_file_path := filepath.Join(dir_path, name+".ll")
+		if err = ioutil.WriteFile(ll_file_path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		var got bytes.Buffer
+		cmd := exec.Command(lli, append([]string{ll_file_path}, it.Args...)...)
+		cmd.Env, cmd.Stdin, cmd.Stdout, cmd.Stderr = append([]string{}, it.Env...), bytes.NewReader(nil), &got, &got
+		if err = cmd.Run(); err != nil {
+			if _, failed := err.(*exec.ExitError); !failed {
+				t.Fatal(err)
+			}
+		}
+		if diff := golden.Diff(want, got.Bytes()); diff != "" {
+			t.Errorf("%s: lli output differs from Prog.Eval's:\n%s", name, diff)
+		}
+	}
+}
+
+func testLLFuncName(line string) string {
+	idx := strings.IndexByte(line, '@')
+	return line[idx+1 : idx+strings.IndexByte(line[idx:], '(')]
+}
@@ -296,6 +296,8 @@ func irToLLInstrConvert(ctx *CtxIrToLL, expr_form IrExprForm) LLInstrConvert {
 		if ty_src_int, is_ty_src_int := ty_src.(LLTypeInt); is_ty_src_int {
 			if ty_src_int.bit_width > ty_dst.bit_width {
 				ret_conv.convert_kind = ll_convert_trunc
+			} else if ty_src_int.bit_width < ty_dst.bit_width {
+				ret_conv.convert_kind = ll_convert_zext
 			}
 		} else if _, is_ty_src_ptr := ty_src.(LLTypePtr); is_ty_src_ptr {
 			ret_conv.convert_kind = ll_convert_ptr_to_int
@@ -322,6 +324,10 @@ func irToLLInstrBinOp(ctx *CtxIrToLL, expr_form IrExprForm) LLInstrBinOp {
 		ret_op2.op_kind = ll_bin_op_sub
 	} else if strEq(kind_tag, "udiv") {
 		ret_op2.op_kind = ll_bin_op_udiv
+	} else if strEq(kind_tag, "sdiv") {
+		ret_op2.op_kind = ll_bin_op_sdiv
+	} else if strEq(kind_tag, "srem") {
+		ret_op2.op_kind = ll_bin_op_srem
 	}
 	assert(ret_op2.op_kind != 0)
 	return ret_op2
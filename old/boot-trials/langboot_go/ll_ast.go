@@ -94,6 +94,7 @@ const (
 	ll_convert_int_to_ptr
 	ll_convert_ptr_to_int
 	ll_convert_trunc
+	ll_convert_zext
 )
 
 type LLInstrComment struct {
@@ -136,6 +137,8 @@ const (
 	ll_bin_op_mul
 	ll_bin_op_sub
 	ll_bin_op_udiv
+	ll_bin_op_sdiv
+	ll_bin_op_srem
 )
 
 type LLInstrCmpI struct {
@@ -278,12 +278,12 @@ func llEmitInstrSwitch(ll_instr_switch *LLInstrSwitch) {
 	write(ll_instr_switch.default_block_name)
 	write(Str(" ["))
 	for i := range ll_instr_switch.cases {
+		if i > 0 {
+			write(Str("\n    "))
+		}
 		llEmit(ll_instr_switch.cases[i].expr)
 		write(Str(", label %"))
 		write(ll_instr_switch.cases[i].block_name)
-		if i > 0 {
-			write(Str(",\n    "))
-		}
 	}
 	write(Str("]"))
 }
@@ -332,6 +332,8 @@ func llEmitInstrConvert(ll_instr_convert *LLInstrConvert) {
 		write(Str("ptrtoint "))
 	case ll_convert_trunc:
 		write(Str("trunc "))
+	case ll_convert_zext:
+		write(Str("zext "))
 	default:
 		panic(ll_instr_convert.convert_kind)
 	}
@@ -351,6 +353,10 @@ func llEmitInstrBinOp(ll_instr_bin_op *LLInstrBinOp) {
 		op_kind = "sub"
 	case ll_bin_op_udiv:
 		op_kind = "udiv"
+	case ll_bin_op_sdiv:
+		op_kind = "sdiv"
+	case ll_bin_op_srem:
+		op_kind = "srem"
 	default:
 		fail(ll_instr_bin_op.op_kind)
 	}
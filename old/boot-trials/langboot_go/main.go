@@ -26,6 +26,8 @@ import (
 	"os"
 	"runtime"
 	"runtime/debug"
+
+	atem "github.com/metaleap/atmo/old/atem"
 )
 
 func main() {
@@ -38,6 +40,11 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	if len(os.Args) > 1 && os.Args[1] == "atem" { // see atem_to_ll.go
+		ll_mod := llModuleFromAtem(atem.LoadFromJson(input_src_file_bytes))
+		llEmit(&ll_mod)
+		return
+	}
 
 	toks := tokenize(input_src_file_bytes, false)
 	assert(len(toks) != 0)